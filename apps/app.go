@@ -12,6 +12,31 @@ import (
 const MarathonConsulLabel = "consul"
 const MarathonConsulTagValue = "tag"
 
+// Overrides globally configured UnhealthyTaskPolicy for the app
+const UnhealthyTaskPolicyLabel = "consul-unhealthy-task-policy"
+
+// UnhealthyTaskPolicy decides what happens with services of a task failing Marathon health checks
+type UnhealthyTaskPolicy string
+
+const (
+	// Services are left untouched until the task is killed
+	UnhealthyTaskIgnore UnhealthyTaskPolicy = "ignore"
+	// Services are deregistered and registered again when the task recovers
+	UnhealthyTaskDeregister UnhealthyTaskPolicy = "deregister"
+	// Services are put into Consul maintenance mode until the task recovers
+	UnhealthyTaskMaintenance UnhealthyTaskPolicy = "maintenance"
+)
+
+func ParseUnhealthyTaskPolicy(value string) (UnhealthyTaskPolicy, error) {
+	switch policy := UnhealthyTaskPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case UnhealthyTaskIgnore, UnhealthyTaskDeregister, UnhealthyTaskMaintenance:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("Unknown unhealthy task policy %q, expected one of: %s, %s, %s",
+			value, UnhealthyTaskIgnore, UnhealthyTaskDeregister, UnhealthyTaskMaintenance)
+	}
+}
+
 type HealthCheck struct {
 	Path                   string `json:"path"`
 	PortIndex              int    `json:"portIndex"`
@@ -29,6 +54,8 @@ type HealthCheck struct {
 type PortDefinition struct {
 	Labels map[string]string `json:"labels"`
 	Name   string            `json:"name,omitempty"`
+	// Only present in port mappings
+	ContainerPort int `json:"containerPort,omitempty"`
 }
 
 type Container struct {
@@ -50,6 +77,9 @@ type App struct {
 	ID              AppID             `json:"id"`
 	Tasks           []Task            `json:"tasks"`
 	PortDefinitions []PortDefinition  `json:"portDefinitions"`
+	Networks        []Network         `json:"networks,omitempty"`
+	IPAddress       *IPAddressPerTask `json:"ipAddress,omitempty"`
+	Version         string            `json:"version"`
 }
 
 // Marathon Application Id (aka PathId)
@@ -66,6 +96,20 @@ func (app App) IsConsulApp() bool {
 	return ok
 }
 
+// UnhealthyTaskPolicy returns policy set with the app label, or given default when the label is missing or invalid
+func (app App) UnhealthyTaskPolicy(defaultPolicy UnhealthyTaskPolicy) UnhealthyTaskPolicy {
+	value, ok := app.Labels[UnhealthyTaskPolicyLabel]
+	if !ok {
+		return defaultPolicy
+	}
+	policy, err := ParseUnhealthyTaskPolicy(value)
+	if err != nil {
+		log.WithError(err).WithField("Id", app.ID).Warn("Invalid unhealthy task policy label, using default")
+		return defaultPolicy
+	}
+	return policy
+}
+
 func (app App) labelsToRawName(labels map[string]string) string {
 	if value, ok := labels[MarathonConsulLabel]; ok && !isSpecialConsulNameValue(value) {
 		return value
@@ -92,9 +136,12 @@ func ParseApp(jsonBlob []byte) (*App, error) {
 }
 
 type RegistrationIntent struct {
-	Name string
-	Port int
-	Tags []string
+	Name    string            `json:"name"`
+	Port    int               `json:"port"`
+	Tags    []string          `json:"tags"`
+	Meta    map[string]string `json:"meta,omitempty"`
+	Weights *Weights          `json:"weights,omitempty"`
+	Connect *ConnectIntent    `json:"connect,omitempty"`
 }
 
 func (app App) RegistrationIntentsNumber() int {
@@ -111,19 +158,29 @@ func (app App) RegistrationIntentsNumber() int {
 }
 
 func (app App) RegistrationIntents(task *Task, nameSeparator string) []RegistrationIntent {
-	taskPortsCount := len(task.Ports)
+	return app.RegistrationIntentsWithOptions(task, RegistrationOptions{Separator: nameSeparator})
+}
+
+func (app App) RegistrationIntentsWithOptions(task *Task, options RegistrationOptions) []RegistrationIntent {
+	ports := app.ServicePorts(task)
+	taskPortsCount := len(ports)
 	indexedPortDefinitions := app.extractIndexedPortDefinitions()
 	consulPortDefinitions := app.filterConsulDefinitions(indexedPortDefinitions)
-	tagPlaceholderMapping := createTagPlaceholderMapping(indexedPortDefinitions, task.Ports)
+	tagPlaceholderMapping := createTagPlaceholderMapping(indexedPortDefinitions, ports)
 	commonTags := labelsToTags(app.Labels, tagPlaceholderMapping)
+	commonMeta := app.labelsToMeta(app.Labels)
 	if len(consulPortDefinitions) == 0 && taskPortsCount != 0 {
-		return []RegistrationIntent{
-			{
-				Name: app.labelsToName(app.Labels, nameSeparator),
-				Port: task.Ports[0],
-				Tags: commonTags,
-			},
+		portName := app.firstPortName(indexedPortDefinitions)
+		intent := RegistrationIntent{
+			Name:    app.labelsToName(app.Labels, options, portName, 0),
+			Port:    ports[0],
+			Tags:    commonTags,
+			Meta:    mergeMeta(commonMeta),
+			Weights: app.labelsToWeights(app.Labels),
+			Connect: app.labelsToConnect(app.Labels, tagPlaceholderMapping),
 		}
+		intent.Tags = app.renderTags(intent, task, app.Labels, portName, 0, options.Tags)
+		return []RegistrationIntent{intent}
 	}
 
 	var intents []RegistrationIntent
@@ -132,11 +189,16 @@ func (app App) RegistrationIntents(task *Task, nameSeparator string) []Registrat
 			log.WithField("Id", task.ID.String()).Warnf("Port index (%d) out of bounds should be from range [0,%d)", d.Index, taskPortsCount)
 			continue
 		}
-		intents = append(intents, RegistrationIntent{
-			Name: app.labelsToName(d.Labels, nameSeparator),
-			Port: task.Ports[d.Index],
-			Tags: append(labelsToTags(d.Labels, tagPlaceholderMapping), commonTags...),
-		})
+		intent := RegistrationIntent{
+			Name:    app.labelsToName(d.Labels, options, d.PortName, d.Index),
+			Port:    ports[d.Index],
+			Tags:    append(labelsToTags(d.Labels, tagPlaceholderMapping), commonTags...),
+			Meta:    mergeMeta(commonMeta, app.labelsToMeta(d.Labels)),
+			Weights: app.labelsToWeights(d.Labels),
+			Connect: app.labelsToConnect(d.Labels, tagPlaceholderMapping),
+		}
+		intent.Tags = app.renderTags(intent, task, d.Labels, d.PortName, d.Index, options.Tags)
+		intents = append(intents, intent)
 	}
 	return intents
 }
@@ -148,7 +210,7 @@ func marathonAppNameToServiceName(name string, nameSeparator string) string {
 func labelsToTags(labels map[string]string, tagPlaceholderMapping map[string]string) []string {
 	tags := make([]string, 0, len(labels))
 	for key, value := range labels {
-		if value == MarathonConsulTagValue {
+		if value == MarathonConsulTagValue && !isMetaLabel(key) {
 			tags = append(tags, resolvePlaceholders(key, tagPlaceholderMapping))
 		}
 	}
@@ -174,8 +236,12 @@ func resolvePlaceholders(value string, tagPlaceholderMapping map[string]string)
 	return value
 }
 
-func (app App) labelsToName(labels map[string]string, nameSeparator string) string {
+func (app App) labelsToName(labels map[string]string, options RegistrationOptions, portName string, portIndex int) string {
+	nameSeparator := options.Separator
 	appConsulName := app.labelsToRawName(labels)
+	if tmpl := app.nameTemplate(options); tmpl != nil && !app.hasExplicitName(labels) {
+		appConsulName = app.templatedName(tmpl, labels, portName, portIndex, nameSeparator)
+	}
 	serviceName := marathonAppNameToServiceName(appConsulName, nameSeparator)
 	if serviceName == "" {
 		log.WithField("AppId", app.ID.String()).WithField("ConsulServiceName", appConsulName).
@@ -185,10 +251,24 @@ func (app App) labelsToName(labels map[string]string, nameSeparator string) stri
 	return serviceName
 }
 
+func (app App) hasExplicitName(labels map[string]string) bool {
+	value, ok := labels[MarathonConsulLabel]
+	return ok && !isSpecialConsulNameValue(value)
+}
+
+func (app App) firstPortName(portDefinitions []indexedPortDefinition) string {
+	if len(portDefinitions) == 0 {
+		return ""
+	}
+	return portDefinitions[0].Name
+}
+
 type indexedPortDefinition struct {
 	Index  int
 	Labels map[string]string
 	Name   string
+	// Name of the port definition, Name holds service name for definitions filtered by the consul label
+	PortName string
 }
 
 func (app App) extractIndexedPortDefinitions() []indexedPortDefinition {
@@ -213,9 +293,10 @@ func (app App) filterConsulDefinitions(all []indexedPortDefinition) []indexedPor
 			for _, name := range multipleDefinitions {
 				labels := extractLabelsForService(name, d.Labels)
 				consulDefinitions = append(consulDefinitions, indexedPortDefinition{
-					Index:  d.Index,
-					Labels: labels,
-					Name:   name,
+					Index:    d.Index,
+					Labels:   labels,
+					Name:     name,
+					PortName: d.Name,
 				})
 			}
 		}
@@ -229,7 +310,7 @@ func extractLabelsForService(serviceName string, labels map[string]string) map[s
 
 	for key, value := range labels {
 		valueAndSelector := strings.Split(value, ":")
-		if len(valueAndSelector) > 1 {
+		if len(valueAndSelector) > 1 && !isConnectLabel(key) && !isMetaLabel(key) {
 			extractedValue := valueAndSelector[0]
 			serviceSelector := valueAndSelector[1]
 
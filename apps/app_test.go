@@ -3,6 +3,7 @@ package apps
 import (
 	"io/ioutil"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -46,7 +47,8 @@ func TestParseApps(t *testing.T) {
 					MaxConsecutiveFailures: 3,
 				},
 			},
-			ID: "/bridged-webapp",
+			ID:      "/bridged-webapp",
+			Version: "2014-09-25T02:26:59.256Z",
 			Tasks: []Task{
 				{
 					ID:                 "test.47de43bd-1a81-11e5-bdb6-e6cb6734eaf8",
@@ -54,12 +56,16 @@ func TestParseApps(t *testing.T) {
 					Host:               "192.168.2.114",
 					Ports:              []int{31315},
 					HealthCheckResults: []HealthCheckResult{{Alive: true}},
+					StartedAt:          timestamp("2015-06-24T14:57:06.466Z"),
+					Version:            "2015-06-24T14:56:57.466Z",
 				},
 				{
-					ID:    "test.4453212c-1a81-11e5-bdb6-e6cb6734eaf8",
-					AppID: "/test",
-					Host:  "192.168.2.114",
-					Ports: []int{31797},
+					ID:        "test.4453212c-1a81-11e5-bdb6-e6cb6734eaf8",
+					AppID:     "/test",
+					Host:      "192.168.2.114",
+					Ports:     []int{31797},
+					StartedAt: timestamp("2015-06-24T14:57:00.611Z"),
+					Version:   "2015-06-24T14:56:57.466Z",
 				},
 			},
 		},
@@ -113,7 +119,8 @@ func TestParseApp(t *testing.T) {
 				MaxConsecutiveFailures: 3,
 			},
 		},
-		ID: "/myapp",
+		ID:      "/myapp",
+		Version: "2015-12-01T10:03:32.003Z",
 		Tasks: []Task{{
 			ID:    "myapp.cc49ccc1-9812-11e5-a06e-56847afe9799",
 			AppID: "/myapp",
@@ -122,7 +129,9 @@ func TestParseApp(t *testing.T) {
 				31679,
 				31680,
 				31681},
-			HealthCheckResults: []HealthCheckResult{{Alive: true}}},
+			HealthCheckResults: []HealthCheckResult{{Alive: true}},
+			StartedAt:          timestamp("2015-12-01T10:03:40.966Z"),
+			Version:            "2015-12-01T10:03:32.003Z"},
 			{
 				ID:    "myapp.c8b449f0-9812-11e5-a06e-56847afe9799",
 				AppID: "/myapp",
@@ -131,7 +140,9 @@ func TestParseApp(t *testing.T) {
 					31308,
 					31309,
 					31310},
-				HealthCheckResults: []HealthCheckResult{{Alive: true}}}}}
+				HealthCheckResults: []HealthCheckResult{{Alive: true}},
+				StartedAt:          timestamp("2015-12-01T10:03:34.945Z"),
+				Version:            "2015-12-01T10:03:32.003Z"}}}
 
 	app, err := ParseApp(appBlob)
 	assert.NoError(t, err)
@@ -166,6 +177,490 @@ func TestConsulApp(t *testing.T) {
 	assert.False(t, app.IsConsulApp())
 }
 
+func TestParseUnhealthyTaskPolicy(t *testing.T) {
+	t.Parallel()
+
+	// expect
+	for value, expected := range map[string]UnhealthyTaskPolicy{
+		"ignore":       UnhealthyTaskIgnore,
+		"deregister":   UnhealthyTaskDeregister,
+		" Maintenance": UnhealthyTaskMaintenance,
+	} {
+		policy, err := ParseUnhealthyTaskPolicy(value)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, policy)
+	}
+	_, err := ParseUnhealthyTaskPolicy("kill")
+	assert.Error(t, err)
+}
+
+func TestUnhealthyTaskPolicy(t *testing.T) {
+	t.Parallel()
+
+	// when
+	app := &App{Labels: map[string]string{"consul": "", "consul-unhealthy-task-policy": "maintenance"}}
+
+	// then
+	assert.Equal(t, UnhealthyTaskMaintenance, app.UnhealthyTaskPolicy(UnhealthyTaskIgnore))
+
+	// when
+	app = &App{Labels: map[string]string{"consul": "", "consul-unhealthy-task-policy": "unknown"}}
+
+	// then
+	assert.Equal(t, UnhealthyTaskDeregister, app.UnhealthyTaskPolicy(UnhealthyTaskDeregister))
+
+	// when
+	app = &App{Labels: map[string]string{"consul": ""}}
+
+	// then
+	assert.Equal(t, UnhealthyTaskIgnore, app.UnhealthyTaskPolicy(UnhealthyTaskIgnore))
+}
+
+func TestRegistrationIntent_ConnectFromAppLabels(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := &App{
+		ID: "app-name",
+		Labels: map[string]string{
+			"consul":                    "true",
+			"consul-connect":            "proxy",
+			"consul-connect-proxy-port": "21000",
+			"consul-connect-upstreams":  "db:9191, cache:9192,invalid",
+		},
+	}
+	task := &Task{Ports: []int{1234}}
+
+	// when
+	intents := app.RegistrationIntents(task, "-")
+
+	// then
+	assert.Len(t, intents, 1)
+	assert.Equal(t, &ConnectIntent{
+		ProxyPort: 21000,
+		Upstreams: []ConnectUpstream{{DestinationName: "db", LocalBindPort: 9191}, {DestinationName: "cache", LocalBindPort: 9192}},
+	}, intents[0].Connect)
+}
+
+func TestRegistrationIntent_ConnectFromPortDefinitionLabels(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := &App{
+		ID:     "app-name",
+		Labels: map[string]string{"consul": "true"},
+		PortDefinitions: []PortDefinition{
+			{
+				Labels: map[string]string{
+					"consul":                    "web",
+					"consul-connect":            "proxy",
+					"consul-connect-proxy-port": "{port:proxy}",
+					"consul-connect-upstreams":  "db:9191",
+				},
+			},
+			{
+				Labels: map[string]string{"consul": "native-svc", "consul-connect": "native"},
+			},
+			{
+				Name: "proxy",
+			},
+		},
+	}
+	task := &Task{Ports: []int{1234, 5678, 9012}}
+
+	// when
+	intents := app.RegistrationIntents(task, "-")
+
+	// then
+	assert.Len(t, intents, 2)
+	assert.Equal(t, &ConnectIntent{ProxyPort: 9012, Upstreams: []ConnectUpstream{{DestinationName: "db", LocalBindPort: 9191}}}, intents[0].Connect)
+	assert.Equal(t, &ConnectIntent{Native: true}, intents[1].Connect)
+}
+
+func TestRegistrationIntent_ConnectDisabledOnInvalidLabel(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := &App{
+		ID:     "app-name",
+		Labels: map[string]string{"consul": "true", "consul-connect": "mesh"},
+	}
+	task := &Task{Ports: []int{1234}}
+
+	// when
+	intents := app.RegistrationIntents(task, "-")
+
+	// then
+	assert.Nil(t, intents[0].Connect)
+}
+
+func TestRegistrationIntent_MetaFromLabels(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := &App{
+		ID: "app-name",
+		Labels: map[string]string{
+			"consul":                "true",
+			"consul-meta:owner":     "team-a",
+			"consul-meta:docs":      "http://docs/app",
+			"consul-meta:consul-id": "reserved",
+			"consul-meta:in valid":  "key",
+			"consul-meta:tagged":    "tag",
+		},
+		PortDefinitions: []PortDefinition{
+			{
+				Labels: map[string]string{"consul": "web", "consul-meta:owner": "team-b", "consul-meta:protocol": "http"},
+			},
+			{
+				Labels: map[string]string{"consul": "admin"},
+			},
+		},
+	}
+	task := &Task{Ports: []int{1234, 5678}}
+
+	// when
+	intents := app.RegistrationIntents(task, "-")
+
+	// then
+	assert.Len(t, intents, 2)
+	assert.Equal(t, map[string]string{"owner": "team-b", "docs": "http://docs/app", "protocol": "http", "tagged": "tag"}, intents[0].Meta)
+	assert.Equal(t, map[string]string{"owner": "team-a", "docs": "http://docs/app", "tagged": "tag"}, intents[1].Meta)
+	assert.Empty(t, intents[0].Tags)
+}
+
+func TestRegistrationIntent_WeightsFromLabels(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := &App{
+		ID: "app-name",
+		Labels: map[string]string{
+			"consul":                "true",
+			"consul-weight-passing": "10",
+		},
+		PortDefinitions: []PortDefinition{
+			{
+				Labels: map[string]string{"consul": "web", "consul-weight-passing": "2", "consul-weight-warning": "0"},
+			},
+			{
+				Labels: map[string]string{"consul": "admin"},
+			},
+		},
+	}
+	task := &Task{Ports: []int{1234, 5678}}
+
+	// when
+	intents := app.RegistrationIntents(task, "-")
+
+	// then
+	assert.Len(t, intents, 2)
+	assert.Equal(t, &Weights{Passing: 2, Warning: 0}, intents[0].Weights)
+	assert.Equal(t, &Weights{Passing: 10, Warning: 1}, intents[1].Weights)
+}
+
+func TestRegistrationIntent_WeightsNotSetWithoutValidLabels(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := &App{
+		ID: "app-name",
+		Labels: map[string]string{
+			"consul":                "true",
+			"consul-weight-passing": "0",
+			"consul-weight-warning": "many",
+		},
+	}
+	task := &Task{Ports: []int{1234}}
+
+	// when
+	intents := app.RegistrationIntents(task, "-")
+
+	// then
+	assert.Nil(t, intents[0].Weights)
+}
+
+func TestCheckOverrides(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := &App{
+		ID: "app-name",
+		Labels: map[string]string{
+			"consul-check-grace-status":              "Warning",
+			"consul-check-success-before-passing":    "2",
+			"consul-check-failures-before-critical":  "-1",
+			"consul-check-deregister-critical-after": "10m",
+		},
+	}
+
+	// when
+	overrides := app.CheckOverrides()
+
+	// then
+	successBeforePassing := 2
+	deregisterAfter := 10 * time.Minute
+	assert.Equal(t, CheckOverrides{
+		GraceStatus:                    "warning",
+		SuccessBeforePassing:           &successBeforePassing,
+		DeregisterCriticalServiceAfter: &deregisterAfter,
+	}, overrides)
+}
+
+func TestCheckOverrides_InvalidLabelsAreSkipped(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := &App{
+		ID: "app-name",
+		Labels: map[string]string{
+			"consul-check-grace-status":              "maintenance",
+			"consul-check-deregister-critical-after": "soon",
+		},
+	}
+
+	// expect
+	assert.Equal(t, CheckOverrides{}, app.CheckOverrides())
+}
+
+func TestAddressMode(t *testing.T) {
+	t.Parallel()
+
+	var addressModeTestsData = []struct {
+		app          App
+		expectedMode AddressMode
+	}{
+		{App{}, AddressModeHost},
+		{App{Networks: []Network{{Mode: "host"}}}, AddressModeHost},
+		{App{Networks: []Network{{Mode: "container/bridge"}}}, AddressModeHost},
+		{App{Networks: []Network{{Mode: "container", Name: "dcos"}}}, AddressModeContainer},
+		{App{IPAddress: &IPAddressPerTask{NetworkName: "dcos"}}, AddressModeContainer},
+		{App{Networks: []Network{{Mode: "container"}}, Labels: map[string]string{"consul-address-mode": "host"}}, AddressModeHost},
+		{App{Labels: map[string]string{"consul-address-mode": "Container"}}, AddressModeContainer},
+		{App{Labels: map[string]string{"consul-address-mode": "overlay"}}, AddressModeHost},
+	}
+
+	for _, testData := range addressModeTestsData {
+		assert.Equal(t, testData.expectedMode, testData.app.AddressMode())
+	}
+}
+
+func TestRegistrationIntent_ContainerPortsOnContainerNetwork(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := &App{
+		ID:       "app-name",
+		Labels:   map[string]string{"consul": "true"},
+		Networks: []Network{{Mode: "container", Name: "dcos"}},
+		Container: Container{
+			PortMappings: []PortDefinition{
+				{ContainerPort: 8080, Name: "http", Labels: map[string]string{"consul": "web", "{port:http}": "tag"}},
+				{ContainerPort: 9090, Labels: map[string]string{"consul": "admin"}},
+			},
+		},
+	}
+	task := &Task{IPAddresses: []IPAddress{{IPAddress: "9.0.0.1", Protocol: "IPv4"}}}
+
+	// when
+	intents := app.RegistrationIntents(task, "-")
+
+	// then
+	assert.Len(t, intents, 2)
+	assert.Equal(t, 8080, intents[0].Port)
+	assert.Equal(t, []string{"8080"}, intents[0].Tags)
+	assert.Equal(t, 9090, intents[1].Port)
+}
+
+func TestTask_IPs(t *testing.T) {
+	t.Parallel()
+
+	// given
+	task := Task{IPAddresses: []IPAddress{
+		{IPAddress: "fd00::1", Protocol: "IPv6"},
+		{IPAddress: "invalid", Protocol: "IPv4"},
+		{IPAddress: "9.0.0.1", Protocol: "IPv4"},
+	}}
+
+	// when
+	IPs := task.IPs()
+
+	// then
+	assert.Len(t, IPs, 2)
+	assert.Equal(t, "fd00::1", IPs[0].String())
+	assert.Equal(t, "9.0.0.1", IPs[1].String())
+	assert.Empty(t, Task{}.IPs())
+}
+
+func TestRegistrationIntent_NameFromTemplate(t *testing.T) {
+	t.Parallel()
+
+	// given
+	nameTemplate, err := ParseNameTemplate("{{index .Segments 1}}-{{last .Segments}}-{{index .Segments 0}}")
+	options := RegistrationOptions{Separator: ".", NameTemplate: nameTemplate}
+	app := &App{
+		ID:     "/env/team/service",
+		Labels: map[string]string{"consul": ""},
+	}
+
+	// when
+	intent := app.RegistrationIntentsWithOptions(dummyTask, options)[0]
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "team-service-env", intent.Name)
+}
+
+func TestRegistrationIntent_NameFromTemplateWithPortData(t *testing.T) {
+	t.Parallel()
+
+	// given
+	nameTemplate, _ := ParseNameTemplate(`{{join .Segments .Separator}}-{{.PortName}}{{.PortIndex}}-{{.Labels.env | lower}}`)
+	options := RegistrationOptions{Separator: "_", NameTemplate: nameTemplate}
+	app := &App{
+		ID:     "/team/service",
+		Labels: map[string]string{"consul": "true", "env": "PROD"},
+		PortDefinitions: []PortDefinition{
+			{Name: "http", Labels: map[string]string{"consul": "explicit-name"}},
+			{Name: "admin", Labels: map[string]string{"consul": "", "env": "DEV"}},
+		},
+	}
+	task := &Task{Ports: []int{1234, 5678}}
+
+	// when
+	intents := app.RegistrationIntentsWithOptions(task, options)
+
+	// then
+	assert.Len(t, intents, 2)
+	assert.Equal(t, "explicit-name", intents[0].Name)
+	assert.Equal(t, "team_service-admin1-dev", intents[1].Name)
+}
+
+func TestRegistrationIntent_NameTemplateFromLabel(t *testing.T) {
+	t.Parallel()
+
+	// given
+	nameTemplate, _ := ParseNameTemplate("global-{{last .Segments}}")
+	options := RegistrationOptions{Separator: ".", NameTemplate: nameTemplate}
+	app := &App{
+		ID:     "/team/service",
+		Labels: map[string]string{"consul": "", "consul-name-template": "{{upper (last .Segments)}}"},
+	}
+	invalidLabelApp := &App{
+		ID:     "/team/service",
+		Labels: map[string]string{"consul": "", "consul-name-template": "{{.Missing"},
+	}
+
+	// when
+	intent := app.RegistrationIntentsWithOptions(dummyTask, options)[0]
+	invalidLabelIntent := invalidLabelApp.RegistrationIntentsWithOptions(dummyTask, options)[0]
+
+	// then
+	assert.Equal(t, "SERVICE", intent.Name)
+	assert.Equal(t, "global-service", invalidLabelIntent.Name)
+}
+
+func TestRegistrationIntent_NameFromFailingTemplateFallsBackToAppID(t *testing.T) {
+	t.Parallel()
+
+	// given
+	nameTemplate, _ := ParseNameTemplate("{{index .Segments 5}}")
+	options := RegistrationOptions{Separator: ".", NameTemplate: nameTemplate}
+	app := &App{
+		ID:     "/team/service",
+		Labels: map[string]string{"consul": ""},
+	}
+
+	// when
+	intent := app.RegistrationIntentsWithOptions(dummyTask, options)[0]
+
+	// then
+	assert.Equal(t, "team.service", intent.Name)
+}
+
+func TestRegistrationIntent_TagTemplates(t *testing.T) {
+	t.Parallel()
+
+	// given
+	globalTags, err := ParseTagTemplates("urlprefix-{{.ServiceName}}.example.com/, dc-{{.Labels.dc}} ,{{.Labels.missing}}")
+	options := RegistrationOptions{Separator: ".", Tags: globalTags}
+	app := &App{
+		ID:      "/team/service",
+		Version: "2",
+		Labels: map[string]string{
+			"consul":                  "",
+			"dc":                      "dc1",
+			"version-{{.AppVersion}}": "tag",
+			"{{.Host}}:{{.Port}}":     "tag",
+			"{{.Labels.missing}}":     "tag",
+			"{{.Invalid":              "tag",
+			"plain":                   "tag",
+		},
+	}
+	task := &Task{ID: "team_service.1", Host: "host-1", Ports: []int{31000}, Version: "1"}
+
+	// when
+	intents := app.RegistrationIntentsWithOptions(task, options)
+
+	// then
+	assert.NoError(t, err)
+	assert.Len(t, globalTags, 3)
+	assert.ElementsMatch(t, []string{"version-1", "host-1:31000", "plain", "urlprefix-team.service.example.com/", "dc-dc1"}, intents[0].Tags)
+}
+
+func TestRegistrationIntent_TagTemplatesOnPortDefinitions(t *testing.T) {
+	t.Parallel()
+
+	// given
+	globalTags, _ := ParseTagTemplates("port-{{.PortName}}-{{.PortIndex}}")
+	options := RegistrationOptions{Separator: ".", Tags: globalTags}
+	app := &App{
+		ID:     "/service",
+		Labels: map[string]string{"consul": ""},
+		PortDefinitions: []PortDefinition{
+			{Name: "http", Labels: map[string]string{"consul": "web", "urlprefix-/{{.ServiceName}}": "tag"}},
+			{Name: "admin", Labels: map[string]string{"consul": "admin"}},
+		},
+	}
+	task := &Task{Ports: []int{1234, 5678}}
+
+	// when
+	intents := app.RegistrationIntentsWithOptions(task, options)
+
+	// then
+	assert.ElementsMatch(t, []string{"urlprefix-/web", "port-http-0"}, intents[0].Tags)
+	assert.ElementsMatch(t, []string{"port-admin-1"}, intents[1].Tags)
+}
+
+func TestParseTagTemplates(t *testing.T) {
+	t.Parallel()
+
+	// when
+	templates, err := ParseTagTemplates(`a,{{join .Labels.list ","}}, ,b`)
+	empty, emptyErr := ParseTagTemplates("")
+	_, invalidErr := ParseTagTemplates("a,{{.Invalid")
+
+	// then
+	assert.NoError(t, err)
+	assert.Len(t, templates, 3)
+	assert.Equal(t, `{{join .Labels.list ","}}`, templates[1].Name())
+	assert.NoError(t, emptyErr)
+	assert.Empty(t, empty)
+	assert.Error(t, invalidErr)
+}
+
+func TestParseNameTemplate(t *testing.T) {
+	t.Parallel()
+
+	// expect
+	empty, err := ParseNameTemplate(" ")
+	assert.NoError(t, err)
+	assert.Nil(t, empty)
+
+	_, err = ParseNameTemplate("{{.AppID")
+	assert.Error(t, err)
+}
+
 func TestAppId_String(t *testing.T) {
 	t.Parallel()
 	assert.Equal(t, "appId", AppID("appId").String())
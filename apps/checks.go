@@ -0,0 +1,87 @@
+package apps
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Labels overriding Consul check options derived from Marathon health checks
+const (
+	CheckGraceStatusLabel            = "consul-check-grace-status"
+	CheckSuccessBeforePassingLabel   = "consul-check-success-before-passing"
+	CheckFailuresBeforeCriticalLabel = "consul-check-failures-before-critical"
+	CheckDeregisterAfterLabel        = "consul-check-deregister-critical-after"
+	CheckThresholdsLabel             = "consul-check-thresholds"
+)
+
+// CheckOverrides holds Consul check options set with labels, nil means not set
+type CheckOverrides struct {
+	GraceStatus                    string
+	SuccessBeforePassing           *int
+	FailuresBeforeCritical         *int
+	DeregisterCriticalServiceAfter *time.Duration
+	// Whether check options are derived from Marathon health check grace period and thresholds
+	Thresholds *bool
+}
+
+// DeriveThresholds returns whether check options are derived from Marathon health check thresholds,
+// given default is used when the app does not set it with a label
+func (o CheckOverrides) DeriveThresholds(defaultValue bool) bool {
+	if o.Thresholds == nil {
+		return defaultValue
+	}
+	return *o.Thresholds
+}
+
+// CheckOverrides reads Consul check options from app labels, invalid values are skipped
+func (app App) CheckOverrides() CheckOverrides {
+	overrides := CheckOverrides{
+		SuccessBeforePassing:   app.checkCountLabel(CheckSuccessBeforePassingLabel),
+		FailuresBeforeCritical: app.checkCountLabel(CheckFailuresBeforeCriticalLabel),
+	}
+	if value, ok := app.Labels[CheckGraceStatusLabel]; ok {
+		switch status := strings.ToLower(strings.TrimSpace(value)); status {
+		case "passing", "warning", "critical":
+			overrides.GraceStatus = status
+		default:
+			app.warnInvalidCheckLabel(CheckGraceStatusLabel, value, "passing, warning or critical")
+		}
+	}
+	if value, ok := app.Labels[CheckDeregisterAfterLabel]; ok {
+		duration, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || duration < 0 {
+			app.warnInvalidCheckLabel(CheckDeregisterAfterLabel, value, "non negative duration")
+		} else {
+			overrides.DeregisterCriticalServiceAfter = &duration
+		}
+	}
+	if value, ok := app.Labels[CheckThresholdsLabel]; ok {
+		enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			app.warnInvalidCheckLabel(CheckThresholdsLabel, value, "true or false")
+		} else {
+			overrides.Thresholds = &enabled
+		}
+	}
+	return overrides
+}
+
+func (app App) checkCountLabel(label string) *int {
+	value, ok := app.Labels[label]
+	if !ok {
+		return nil
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || count < 0 {
+		app.warnInvalidCheckLabel(label, value, "non negative number")
+		return nil
+	}
+	return &count
+}
+
+func (app App) warnInvalidCheckLabel(label, value, expected string) {
+	log.WithField("Id", app.ID).WithField("Value", value).Warnf("Invalid %s label, expected %s", label, expected)
+}
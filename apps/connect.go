@@ -0,0 +1,85 @@
+package apps
+
+import (
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Labels enabling Consul Connect for a service, can be set on the app or on the port definition
+const (
+	// "proxy" registers the service with a sidecar proxy service, "native" marks the service as Connect-native
+	ConnectLabel = "consul-connect"
+	// Port the sidecar proxy accepts connections on, a number or a {port:name} placeholder
+	ConnectProxyPortLabel = "consul-connect-proxy-port"
+	// Comma separated list of service:localPort the proxy should expose locally
+	ConnectUpstreamsLabel = "consul-connect-upstreams"
+)
+
+const (
+	connectProxy  = "proxy"
+	connectNative = "native"
+)
+
+type ConnectIntent struct {
+	Native    bool              `json:"native,omitempty"`
+	ProxyPort int               `json:"proxyPort,omitempty"`
+	Upstreams []ConnectUpstream `json:"upstreams,omitempty"`
+}
+
+type ConnectUpstream struct {
+	DestinationName string `json:"destinationName"`
+	LocalBindPort   int    `json:"localBindPort"`
+}
+
+func isConnectLabel(key string) bool {
+	return key == ConnectLabel || key == ConnectProxyPortLabel || key == ConnectUpstreamsLabel
+}
+
+// labelsToConnect reads Connect configuration from labels, falling back to app labels when labels don't enable Connect
+func (app App) labelsToConnect(labels map[string]string, tagPlaceholderMapping map[string]string) *ConnectIntent {
+	if _, ok := labels[ConnectLabel]; !ok {
+		labels = app.Labels
+	}
+	mode, ok := labels[ConnectLabel]
+	if !ok {
+		return nil
+	}
+
+	logger := log.WithField("Id", app.ID)
+	switch strings.TrimSpace(mode) {
+	case connectNative:
+		return &ConnectIntent{Native: true}
+	case connectProxy:
+	default:
+		logger.WithField("Value", mode).Warnf("Invalid %s label, expected %s or %s. Connect disabled", ConnectLabel, connectProxy, connectNative)
+		return nil
+	}
+
+	connect := &ConnectIntent{}
+	if value, ok := labels[ConnectProxyPortLabel]; ok {
+		port, err := strconv.Atoi(resolvePlaceholders(strings.TrimSpace(value), tagPlaceholderMapping))
+		if err != nil {
+			logger.WithError(err).Warnf("Invalid %s label, proxy port will be chosen by Consul", ConnectProxyPortLabel)
+		} else {
+			connect.ProxyPort = port
+		}
+	}
+	if value, ok := labels[ConnectUpstreamsLabel]; ok {
+		for _, upstream := range strings.Split(value, ",") {
+			nameAndPort := strings.Split(strings.TrimSpace(upstream), ":")
+			if len(nameAndPort) != 2 {
+				logger.WithField("Upstream", upstream).Warnf("Invalid %s label entry, expected service:port", ConnectUpstreamsLabel)
+				continue
+			}
+			port, err := strconv.Atoi(nameAndPort[1])
+			if err != nil {
+				logger.WithField("Upstream", upstream).WithError(err).Warnf("Invalid %s label entry port", ConnectUpstreamsLabel)
+				continue
+			}
+			connect.Upstreams = append(connect.Upstreams, ConnectUpstream{DestinationName: nameAndPort[0], LocalBindPort: port})
+		}
+	}
+	return connect
+}
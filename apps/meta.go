@@ -0,0 +1,56 @@
+package apps
+
+import (
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Labels with this prefix are registered as Consul service meta, e.g. "consul-meta:owner": "team-a"
+const MetaLabelPrefix = "consul-meta:"
+
+// Consul restrictions on service meta, see https://www.consul.io/docs/agent/services.html
+const (
+	maxMetaKeyLength   = 64
+	maxMetaValueLength = 512
+	reservedMetaPrefix = "consul-"
+)
+
+var metaKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+func isMetaLabel(key string) bool {
+	return strings.HasPrefix(key, MetaLabelPrefix)
+}
+
+// labelsToMeta extracts service meta from labels, skipping entries Consul would reject
+func (app App) labelsToMeta(labels map[string]string) map[string]string {
+	meta := make(map[string]string)
+	for key, value := range labels {
+		if !isMetaLabel(key) {
+			continue
+		}
+		metaKey := strings.TrimPrefix(key, MetaLabelPrefix)
+		if !metaKeyRegex.MatchString(metaKey) || len(metaKey) > maxMetaKeyLength ||
+			strings.HasPrefix(metaKey, reservedMetaPrefix) || len(value) > maxMetaValueLength {
+			log.WithField("Id", app.ID).WithField("Label", key).Warn("Invalid service meta label, skipping")
+			continue
+		}
+		meta[metaKey] = value
+	}
+	return meta
+}
+
+// mergeMeta returns union of given meta, entries of the later ones take precedence
+func mergeMeta(metas ...map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for _, meta := range metas {
+		for key, value := range meta {
+			merged[key] = value
+		}
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	return merged
+}
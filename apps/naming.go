@@ -0,0 +1,102 @@
+package apps
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Overrides globally configured service name template for the app
+const NameTemplateLabel = "consul-name-template"
+
+// RegistrationOptions customize names and tags of registered services
+type RegistrationOptions struct {
+	// Replaces "/" in app IDs and name template results
+	Separator string
+	// Builds names of services not named explicitly with the consul label, app ID is used when not set
+	NameTemplate *template.Template
+	// Added to every registration
+	Tags []*template.Template
+}
+
+// ServiceNameData is available in service name templates
+type ServiceNameData struct {
+	AppID string
+	// App ID split by "/", e.g. [env team service] for /env/team/service
+	Segments []string
+	// App labels, overridden by port definition labels for services defined on a port
+	Labels    map[string]string
+	PortName  string
+	PortIndex int
+	Separator string
+}
+
+var templateFuncs = template.FuncMap{
+	"join":    strings.Join,
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	"last": func(segments []string) string {
+		if len(segments) == 0 {
+			return ""
+		}
+		return segments[len(segments)-1]
+	},
+}
+
+// ParseNameTemplate parses service name template, empty text means no template
+func ParseNameTemplate(text string) (*template.Template, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	return template.New("name").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+}
+
+func (app App) nameTemplate(options RegistrationOptions) *template.Template {
+	text, ok := app.Labels[NameTemplateLabel]
+	if !ok {
+		return options.NameTemplate
+	}
+	tmpl, err := ParseNameTemplate(text)
+	if err != nil {
+		log.WithError(err).WithField("Id", app.ID).Warnf("Invalid %s label, using default naming", NameTemplateLabel)
+		return options.NameTemplate
+	}
+	return tmpl
+}
+
+// templatedName executes name template, returning empty name on failure so the default one is used
+func (app App) templatedName(tmpl *template.Template, labels map[string]string, portName string, portIndex int, separator string) string {
+	data := ServiceNameData{
+		AppID:     app.ID.String(),
+		Segments:  app.idSegments(),
+		Labels:    app.mergedLabels(labels),
+		PortName:  portName,
+		PortIndex: portIndex,
+		Separator: separator,
+	}
+	var name bytes.Buffer
+	if err := tmpl.Execute(&name, data); err != nil {
+		log.WithError(err).WithField("Id", app.ID).Warn("Could not execute service name template")
+		return ""
+	}
+	return name.String()
+}
+
+func (app App) idSegments() []string {
+	return strings.Split(strings.Trim(app.ID.String(), "/"), "/")
+}
+
+// mergedLabels returns app labels overridden with given port definition labels
+func (app App) mergedLabels(labels map[string]string) map[string]string {
+	merged := make(map[string]string, len(app.Labels)+len(labels))
+	for key, value := range app.Labels {
+		merged[key] = value
+	}
+	for key, value := range labels {
+		merged[key] = value
+	}
+	return merged
+}
@@ -0,0 +1,84 @@
+package apps
+
+import (
+	"net"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Overrides the address services of the app are registered with, "host" or "container"
+const AddressModeLabel = "consul-address-mode"
+
+// AddressMode decides which address and ports services of a task are registered with
+type AddressMode string
+
+const (
+	// Mesos agent address and host ports
+	AddressModeHost AddressMode = "host"
+	// Task IP address and container ports, used by apps on USER/container networks
+	AddressModeContainer AddressMode = "container"
+)
+
+const networkModeContainer = "container"
+
+type Network struct {
+	Mode string `json:"mode"`
+	Name string `json:"name,omitempty"`
+}
+
+// IPAddressPerTask is the IP-per-task configuration used before Marathon 1.5 introduced networks
+type IPAddressPerTask struct {
+	NetworkName string `json:"networkName"`
+}
+
+type IPAddress struct {
+	IPAddress string `json:"ipAddress"`
+	Protocol  string `json:"protocol"`
+}
+
+// AddressMode returns mode set with the app label, or the one following app networking
+func (app App) AddressMode() AddressMode {
+	if value, ok := app.Labels[AddressModeLabel]; ok {
+		switch mode := AddressMode(strings.ToLower(strings.TrimSpace(value))); mode {
+		case AddressModeHost, AddressModeContainer:
+			return mode
+		default:
+			log.WithField("Id", app.ID).WithField("Value", value).
+				Warnf("Invalid %s label, expected %s or %s", AddressModeLabel, AddressModeHost, AddressModeContainer)
+		}
+	}
+	if app.IPAddress != nil {
+		return AddressModeContainer
+	}
+	for _, network := range app.Networks {
+		if network.Mode == networkModeContainer {
+			return AddressModeContainer
+		}
+	}
+	return AddressModeHost
+}
+
+// ServicePorts returns ports services of the task are available on in the app address mode.
+// In container mode these are container ports of port mappings, as host ports may not be allocated at all.
+func (app App) ServicePorts(task *Task) []int {
+	if app.AddressMode() != AddressModeContainer || len(app.Container.PortMappings) == 0 {
+		return task.Ports
+	}
+	ports := make([]int, 0, len(app.Container.PortMappings))
+	for _, mapping := range app.Container.PortMappings {
+		ports = append(ports, mapping.ContainerPort)
+	}
+	return ports
+}
+
+// IPs returns valid addresses assigned to the task on container networks
+func (t Task) IPs() []net.IP {
+	IPs := make([]net.IP, 0, len(t.IPAddresses))
+	for _, address := range t.IPAddresses {
+		if IP := net.ParseIP(address.IPAddress); IP != nil {
+			IPs = append(IPs, IP)
+		}
+	}
+	return IPs
+}
@@ -0,0 +1,120 @@
+package apps
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TagData is available in tag templates
+type TagData struct {
+	AppID string
+	// Version of the app definition the task was started with
+	AppVersion  string
+	TaskID      string
+	Host        string
+	ServiceName string
+	Port        int
+	PortName    string
+	PortIndex   int
+	// App labels, overridden by port definition labels for services defined on a port
+	Labels map[string]string
+}
+
+// ParseTagTemplates parses comma separated list of tag templates, commas inside {{ }} actions don't split tags
+func ParseTagTemplates(list string) ([]*template.Template, error) {
+	var templates []*template.Template
+	for _, text := range splitOutsideActions(list) {
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		tmpl, err := parseTagTemplate(strings.TrimSpace(text))
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, tmpl)
+	}
+	return templates, nil
+}
+
+func parseTagTemplate(text string) (*template.Template, error) {
+	return template.New(text).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+}
+
+func splitOutsideActions(list string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(list); i++ {
+		switch {
+		case strings.HasPrefix(list[i:], "{{"):
+			depth++
+			i++
+		case strings.HasPrefix(list[i:], "}}") && depth > 0:
+			depth--
+			i++
+		case list[i] == ',' && depth == 0:
+			parts = append(parts, list[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, list[start:])
+}
+
+func isTagTemplate(tag string) bool {
+	return strings.Contains(tag, "{{")
+}
+
+// renderTags executes templates found in intent tags and appends global tags.
+// Tags which templates fail or render empty are skipped.
+func (app App) renderTags(intent RegistrationIntent, task *Task, labels map[string]string, portName string, portIndex int,
+	globalTags []*template.Template) []string {
+	version := task.Version
+	if version == "" {
+		version = app.Version
+	}
+	data := TagData{
+		AppID:       app.ID.String(),
+		AppVersion:  version,
+		TaskID:      task.ID.String(),
+		Host:        task.Host,
+		ServiceName: intent.Name,
+		Port:        intent.Port,
+		PortName:    portName,
+		PortIndex:   portIndex,
+		Labels:      app.mergedLabels(labels),
+	}
+
+	tags := make([]string, 0, len(intent.Tags)+len(globalTags))
+	for _, tag := range intent.Tags {
+		if !isTagTemplate(tag) {
+			tags = append(tags, tag)
+			continue
+		}
+		tmpl, err := parseTagTemplate(tag)
+		if err != nil {
+			log.WithError(err).WithField("Id", app.ID).WithField("Tag", tag).Warn("Invalid tag template, skipping tag")
+			continue
+		}
+		if rendered, ok := app.executeTagTemplate(tmpl, data); ok {
+			tags = append(tags, rendered)
+		}
+	}
+	for _, tmpl := range globalTags {
+		if rendered, ok := app.executeTagTemplate(tmpl, data); ok {
+			tags = append(tags, rendered)
+		}
+	}
+	return tags
+}
+
+func (app App) executeTagTemplate(tmpl *template.Template, data TagData) (string, bool) {
+	var tag bytes.Buffer
+	if err := tmpl.Execute(&tag, data); err != nil {
+		log.WithError(err).WithField("Id", app.ID).WithField("Tag", tmpl.Name()).Warn("Could not execute tag template, skipping tag")
+		return "", false
+	}
+	rendered := strings.TrimSpace(tag.String())
+	return rendered, rendered != ""
+}
@@ -19,6 +19,10 @@ type Task struct {
 	Host               string              `json:"host"`
 	Ports              []int               `json:"ports"`
 	HealthCheckResults []HealthCheckResult `json:"healthCheckResults"`
+	IPAddresses        []IPAddress         `json:"ipAddresses,omitempty"`
+	StartedAt          time.Timestamp      `json:"startedAt"`
+	// Version of the app definition the task was started with
+	Version string `json:"version"`
 }
 
 // Marathon Task ID
@@ -47,12 +47,16 @@ func TestParseTasks(t *testing.T) {
 			Host:               "192.168.2.114",
 			Ports:              []int{31315},
 			HealthCheckResults: []HealthCheckResult{{Alive: true}},
+			StartedAt:          timestamp("2015-06-24T14:57:06.466Z"),
+			Version:            "2015-06-24T14:56:57.466Z",
 		},
 		{
-			ID:    "test.4453212c-1a81-11e5-bdb6-e6cb6734eaf8",
-			AppID: "/test",
-			Host:  "192.168.2.114",
-			Ports: []int{31797},
+			ID:        "test.4453212c-1a81-11e5-bdb6-e6cb6734eaf8",
+			AppID:     "/test",
+			Host:      "192.168.2.114",
+			Ports:     []int{31797},
+			StartedAt: timestamp("2015-06-24T14:57:00.611Z"),
+			Version:   "2015-06-24T14:56:57.466Z",
 		},
 	}
 
@@ -137,3 +141,11 @@ func TestId_AppIdForInvalidIdShouldPanic(t *testing.T) {
 		assert.Nil(t, a)
 	})
 }
+
+func timestamp(value string) time.Timestamp {
+	ts := time.Timestamp{}
+	if err := ts.UnmarshalJSON([]byte(value)); err != nil {
+		panic(err)
+	}
+	return ts
+}
@@ -0,0 +1,58 @@
+package apps
+
+import (
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Labels controlling Consul DNS SRV weights of a service, can be set on the app or on the port definition
+const (
+	WeightPassingLabel = "consul-weight-passing"
+	WeightWarningLabel = "consul-weight-warning"
+)
+
+// Consul defaults used when only one of the weights is set
+const (
+	defaultWeightPassing = 1
+	defaultWeightWarning = 1
+)
+
+// Weights of a service instance depending on its health
+type Weights struct {
+	Passing int `json:"passing"`
+	Warning int `json:"warning"`
+}
+
+// labelsToWeights reads weights from labels, falling back to app labels for weights not set there
+func (app App) labelsToWeights(labels map[string]string) *Weights {
+	passing, passingSet := app.weightLabel(labels, WeightPassingLabel, 1)
+	warning, warningSet := app.weightLabel(labels, WeightWarningLabel, 0)
+	if !passingSet && !warningSet {
+		return nil
+	}
+	if !passingSet {
+		passing = defaultWeightPassing
+	}
+	if !warningSet {
+		warning = defaultWeightWarning
+	}
+	return &Weights{Passing: passing, Warning: warning}
+}
+
+func (app App) weightLabel(labels map[string]string, label string, min int) (int, bool) {
+	value, ok := labels[label]
+	if !ok {
+		value, ok = app.Labels[label]
+	}
+	if !ok {
+		return 0, false
+	}
+	weight, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || weight < min {
+		log.WithField("Id", app.ID).WithField("Value", value).Warnf("Invalid %s label, expected number not lower than %d", label, min)
+		return 0, false
+	}
+	return weight, true
+}
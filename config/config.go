@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/allegro/marathon-consul/consul"
+	"github.com/allegro/marathon-consul/journal"
 	"github.com/allegro/marathon-consul/marathon"
 	"github.com/allegro/marathon-consul/metrics"
 	"github.com/allegro/marathon-consul/sentry"
@@ -24,8 +25,11 @@ type Config struct {
 	SSE      sse.Config
 	Sync     sync.Config
 	Marathon marathon.Config
-	Metrics  metrics.Config
-	Log      struct {
+	// Additional Marathon instances
+	Marathons []MarathonSource
+	Journal   journal.Config
+	Metrics   metrics.Config
+	Log       struct {
 		Level  string
 		Format string
 		File   string
@@ -47,6 +51,11 @@ func New() (*Config, error) {
 		return nil, err
 	}
 
+	err = config.validateMarathonSources()
+	if err != nil {
+		return nil, err
+	}
+
 	err = config.setLogOutput()
 	if err != nil {
 		return nil, err
@@ -76,28 +85,50 @@ func (config *Config) parseFlags() {
 	flag.Uint32Var(&config.Consul.AgentFailuresTolerance, "consul-max-agent-failures", 3, "Max number of consecutive request failures for agent before removal from cache")
 	flag.Uint32Var(&config.Consul.RequestRetries, "consul-get-services-retry", 3, "Number of retries on failure when performing requests to Consul. Each retry uses different cached agent")
 	flag.StringVar(&config.Consul.ConsulNameSeparator, "consul-name-separator", ".", "Separator used to create default service name for Consul")
+	flag.StringVar(&config.Consul.NameTemplate, "consul-name-template", "", "Go text/template used to create default service name for Consul instead of app ID, e.g. {{index .Segments 1}}-{{last .Segments}}. Can be overridden per app with consul-name-template label")
+	flag.StringVar(&config.Consul.GlobalTags, "consul-global-tags", "", "A comma separated list of tags added to every registration, tags can be Go text/templates, e.g. urlprefix-{{.ServiceName}}.example.com/")
 	flag.StringVar(&config.Consul.IgnoredHealthChecks, "consul-ignored-healthchecks", "", "A comma separated blacklist of Marathon health check types that will not be migrated to Consul, e.g. command,tcp")
+	flag.BoolVar(&config.Consul.CheckThresholds, "consul-check-thresholds", false, "Derive FailuresBeforeCritical and DeregisterCriticalServiceAfter of Consul checks from Marathon health check maxConsecutiveFailures and grace period. Can be overridden per app with consul-check-thresholds label")
 	flag.BoolVar(&config.Consul.EnableTagOverride, "consul-enable-tag-override", false, "Disable the anti-entropy feature for all services")
 	flag.StringVar(&config.Consul.LocalAgentHost, "consul-local-agent-host", "", "Consul Agent hostname or IP that should be used for startup sync")
+	flag.StringVar(&config.Consul.AddressFamily, "consul-address-family", "ipv4", "IP address family hosts are resolved to for agents and service addresses: ipv4, ipv6, prefer-ipv4 or prefer-ipv6")
 	flag.StringVar(&config.Consul.Dc, "consul-dc", "", "Consul DC where to look for services, all if empty")
+	flag.BoolVar(&config.Consul.LeaderElection.Enabled, "consul-leader-election", false, "Elect leader among marathon-consul instances with Consul lock instead of checking Marathon leader. Requires consul-local-agent-host")
+	flag.StringVar(&config.Consul.LeaderElection.Key, "consul-leader-key", "marathon-consul/leader", "Consul KV key used as a leader lock")
+	flag.DurationVar(&config.Consul.LeaderElection.SessionTTL.Duration, "consul-leader-session-ttl", 15*time.Second, "TTL of Consul session holding the leader lock")
 
 	// Web
 	flag.StringVar(&config.Web.Listen, "listen", ":4000", "Accept connections at this address")
 	flag.IntVar(&config.Web.QueueSize, "events-queue-size", 1000, "Size of events queue")
+	flag.StringVar(&config.Web.QueueOverflowPolicy, "events-queue-overflow-policy", "drop", "What to do with events read when the events queue is full: drop, block (stream reading until events-queue-block-timeout), spill (to events-queue-spill-file) or coalesce (in memory, keeping only the latest event of a task). Apps of dropped events are resynced")
+	flag.DurationVar(&config.Web.QueueBlockTimeout.Duration, "events-queue-block-timeout", 5*time.Second, "Time limit for waiting for room in the events queue (used when events-queue-overflow-policy is set to block)")
+	flag.StringVar(&config.Web.QueueSpillFile, "events-queue-spill-file", "", "Path to a file where events that do not fit into the events queue are written (used when events-queue-overflow-policy is set to spill)")
+	flag.IntVar(&config.Web.RetryMaxAttempts, "events-retry-max-attempts", 5, "Number of times a failed event is processed again before it is moved to dead letters, 0 disables retries")
+	flag.DurationVar(&config.Web.RetryBackoff.Duration, "events-retry-backoff", time.Second, "Delay before the first retry of a failed event, doubled for every next retry")
+	flag.DurationVar(&config.Web.RetryMaxBackoff.Duration, "events-retry-max-backoff", time.Minute, "Maximum delay between retries of a failed event")
+	flag.IntVar(&config.Web.DeadLettersSize, "events-dead-letters-size", 100, "Number of the latest dead letters (events given up after failed retries) kept in memory")
 	flag.IntVar(&config.Web.WorkersCount, "workers-pool-size", 10, "Number of concurrent workers processing events")
-	flag.Int64Var(&config.Web.MaxEventSize, "event-max-size", 4096, "Maximum size of event to process (bytes)")
+	flag.Int64Var(&config.Web.MaxEventSize, "event-max-size", 10485760, "Maximum size of event to process (bytes)")
+	flag.StringVar(&config.Web.UnhealthyTaskPolicy, "events-unhealthy-task-policy", "ignore", "What to do with services of a task failing Marathon health checks: ignore, deregister or maintenance (re-registered or brought back when task recovers). Can be overridden per app with consul-unhealthy-task-policy label")
+	flag.DurationVar(&config.Web.AppCacheTTL.Duration, "events-app-cache-ttl", time.Minute, "Time for which app definitions are cached when handling task health events, definitions are also refreshed after deployments. 0 disables the cache")
+	flag.DurationVar(&config.Web.ShutdownTimeout.Duration, "shutdown-timeout", 10*time.Second, "Time limit for processing queued events and closing connections on shutdown")
+	flag.BoolVar(&config.Web.Health.Readiness, "health-readiness", false, "Respond with 503 on /health when SSE stream, events queue or sync are not working properly")
+	flag.DurationVar(&config.Web.Health.MaxSSEDisconnection.Duration, "health-max-sse-disconnection", time.Minute, "Time after which disconnected SSE stream makes instance unhealthy (used when health-readiness is enabled)")
+	flag.IntVar(&config.Web.Health.MaxQueueUtilization, "health-max-queue-utilization", 100, "Events queue utilization (percent) that makes instance unhealthy (used when health-readiness is enabled)")
+	flag.IntVar(&config.Web.Health.MaxFailedSyncs, "health-max-failed-syncs", 3, "Number of consecutive failed syncs that makes instance unhealthy (used when health-readiness is enabled)")
 
 	// SSE
 	flag.IntVar(&config.SSE.Retries, "sse-retries", 0, "Number of times to recover SSE stream.")
 	flag.DurationVar(&config.SSE.RetryBackoff.Duration, "sse-retry-backoff", 0, "Configuration of initial time between retries to recover SSE stream.")
 
 	// Sync
-	flag.BoolVar(&config.Sync.Enabled, "sync-enabled", true, "Enable Marathon-consul scheduled sync")
+	flag.BoolVar(&config.Sync.Enabled, "sync-enabled", true, "Enable Marathon-consul scheduled sync. Catch-up syncs after SSE reconnections are run regardless")
 	flag.DurationVar(&config.Sync.Interval.Duration, "sync-interval", 15*time.Minute, "Marathon-consul sync interval")
 	flag.BoolVar(&config.Sync.Force, "sync-force", false, "Force leadership-independent Marathon-consul sync (run always)")
+	flag.BoolVar(&config.Sync.DryRun, "sync-dry-run", false, "Only log changes Marathon-consul sync would make, without applying them")
 
 	// Marathon
-	flag.StringVar(&config.Marathon.Location, "marathon-location", "localhost:8080", "Marathon URL")
+	flag.StringVar(&config.Marathon.Location, "marathon-location", "localhost:8080", "Marathon URL or a comma separated list of Marathon masters URLs, requests fail over between them preferring the current leader")
 	flag.StringVar(&config.Marathon.Protocol, "marathon-protocol", "http", "Marathon protocol (http or https)")
 	flag.StringVar(&config.Marathon.Username, "marathon-username", "", "Marathon username for basic auth")
 	flag.StringVar(&config.Marathon.Password, "marathon-password", "", "Marathon password for basic auth")
@@ -105,11 +136,18 @@ func (config *Config) parseFlags() {
 	flag.BoolVar(&config.Marathon.VerifySsl, "marathon-ssl-verify", true, "Verify certificates when connecting via SSL")
 	flag.DurationVar(&config.Marathon.Timeout.Duration, "marathon-timeout", 30*time.Second, "Time limit for requests made by the Marathon HTTP client. A Timeout of zero means no timeout")
 
+	// Journal
+	flag.StringVar(&config.Journal.File, "journal-file", "", "Path to a file where received Marathon events and outcome of their processing are appended as JSON lines. If empty journal is disabled")
+	flag.Int64Var(&config.Journal.MaxSize, "journal-max-size", 100, "Size (megabytes) after which the journal file is rotated, 0 disables size rotation")
+	flag.DurationVar(&config.Journal.MaxAge.Duration, "journal-max-age", 24*time.Hour, "Age after which the journal file is rotated, 0 disables age rotation")
+	flag.IntVar(&config.Journal.MaxBackups, "journal-max-backups", 5, "Number of rotated journal files to keep, 0 keeps all of them")
+
 	// Metrics
-	flag.StringVar(&config.Metrics.Target, "metrics-target", "stdout", "Metrics destination stdout or graphite (empty string disables metrics)")
+	flag.StringVar(&config.Metrics.Target, "metrics-target", "stdout", "Metrics destination stdout, graphite or prometheus (empty string disables metrics)")
 	flag.StringVar(&config.Metrics.Prefix, "metrics-prefix", "default", "Metrics prefix (default is resolved to <hostname>.<app_name>")
 	flag.DurationVar(&config.Metrics.Interval.Duration, "metrics-interval", 30*time.Second, "Metrics reporting interval")
 	flag.StringVar(&config.Metrics.Addr, "metrics-location", "", "Graphite URL (used when metrics-target is set to graphite)")
+	flag.StringVar(&config.Metrics.PrometheusPath, "metrics-prometheus-path", "/metrics", "Path on the listen address where metrics are exposed (used when metrics-target is set to prometheus)")
 
 	// Log
 	flag.StringVar(&config.Log.Level, "log-level", "info", "Log level: panic, fatal, error, warn, info, or debug")
@@ -126,6 +164,15 @@ func (config *Config) parseFlags() {
 	flag.StringVar(&config.configFile, "config-file", "", "Path to a JSON file to read configuration from. Note: Will override options set earlier on the command line")
 }
 
+// Command returns a command and its arguments given after options, command is empty when marathon-consul runs as a service
+func (config *Config) Command() (string, []string) {
+	args := flag.Args()
+	if len(args) == 0 {
+		return "", nil
+	}
+	return args[0], args[1:]
+}
+
 func (config *Config) loadConfigFromFile() error {
 	if config.configFile == "" {
 		return nil
@@ -134,7 +181,11 @@ func (config *Config) loadConfigFromFile() error {
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(jsonBlob, config)
+	err = json.Unmarshal(jsonBlob, config)
+	if err != nil {
+		return err
+	}
+	return config.seedMarathonSources(jsonBlob)
 }
 
 func (config *Config) setLogLevel() error {
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/allegro/marathon-consul/consul"
+	"github.com/allegro/marathon-consul/journal"
 	"github.com/allegro/marathon-consul/marathon"
 	"github.com/allegro/marathon-consul/metrics"
 	"github.com/allegro/marathon-consul/sentry"
@@ -103,14 +104,39 @@ func TestConfig_ShouldBeMergedWithFileDefaultsAndFlags(t *testing.T) {
 			RequestRetries:         5,
 			AgentFailuresTolerance: 3,
 			ConsulNameSeparator:    ".",
+			NameTemplate:           "",
+			GlobalTags:             "",
+			CheckThresholds:        false,
 			EnableTagOverride:      false,
 			LocalAgentHost:         "",
+			AddressFamily:          "ipv4",
+			LeaderElection: consul.LeaderElection{
+				Enabled:    false,
+				Key:        "marathon-consul/leader",
+				SessionTTL: timeutil.Interval{Duration: 15 * time.Second},
+			},
 		},
 		Web: web.Config{
-			Listen:       ":4000",
-			QueueSize:    1000,
-			WorkersCount: 10,
-			MaxEventSize: 4096,
+			Listen:              ":4000",
+			QueueSize:           1000,
+			QueueOverflowPolicy: "drop",
+			QueueBlockTimeout:   timeutil.Interval{Duration: 5 * time.Second},
+			QueueSpillFile:      "",
+			RetryMaxAttempts:    5,
+			RetryBackoff:        timeutil.Interval{Duration: time.Second},
+			RetryMaxBackoff:     timeutil.Interval{Duration: time.Minute},
+			DeadLettersSize:     100,
+			WorkersCount:        10,
+			MaxEventSize:        10485760,
+			ShutdownTimeout:     timeutil.Interval{Duration: 10 * time.Second},
+			UnhealthyTaskPolicy: "ignore",
+			AppCacheTTL:         timeutil.Interval{Duration: time.Minute},
+			Health: web.HealthConfig{
+				Readiness:           false,
+				MaxSSEDisconnection: timeutil.Interval{Duration: time.Minute},
+				MaxQueueUtilization: 100,
+				MaxFailedSyncs:      3,
+			},
 		},
 		SSE: sse.Config{},
 		Sync: sync.Config{
@@ -118,6 +144,7 @@ func TestConfig_ShouldBeMergedWithFileDefaultsAndFlags(t *testing.T) {
 			Enabled:  true,
 			Leader:   "",
 			Force:    false,
+			DryRun:   false,
 		},
 		Marathon: marathon.Config{Location: "localhost:8080",
 			Protocol:  "http",
@@ -125,10 +152,18 @@ func TestConfig_ShouldBeMergedWithFileDefaultsAndFlags(t *testing.T) {
 			Password:  "",
 			VerifySsl: true,
 			Timeout:   timeutil.Interval{Duration: 30 * time.Second}},
+		Marathons: []MarathonSource{},
+		Journal: journal.Config{
+			File:       "",
+			MaxSize:    100,
+			MaxAge:     timeutil.Interval{Duration: 24 * time.Hour},
+			MaxBackups: 5,
+		},
 		Metrics: metrics.Config{Target: "stdout",
-			Prefix:   "default",
-			Interval: timeutil.Interval{Duration: 30 * time.Second},
-			Addr:     ""},
+			Prefix:         "default",
+			Interval:       timeutil.Interval{Duration: 30 * time.Second},
+			Addr:           "",
+			PrometheusPath: "/metrics"},
 		Log: struct {
 			Level, Format, File string
 			Sentry              sentry.Config
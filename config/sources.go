@@ -0,0 +1,57 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/allegro/marathon-consul/marathon"
+)
+
+// MarathonSource is an additional Marathon instance services are synced from.
+// Sources can only be set in the config file.
+type MarathonSource struct {
+	// Identifies the source in logs, status and endpoints
+	Name string
+	marathon.Config
+	// Tag maintained instead of consul-tag for services of this source, so sync removes only its own services
+	ConsulTag string
+}
+
+// seedMarathonSources decodes sources of the config file again on top of the main Marathon config,
+// so options missing in a source default to the main ones. Location has to be set by every source.
+func (config *Config) seedMarathonSources(blob []byte) error {
+	var file struct {
+		Marathons []json.RawMessage
+	}
+	if err := json.Unmarshal(blob, &file); err != nil {
+		return err
+	}
+	for i, raw := range file.Marathons {
+		source := MarathonSource{Config: config.Marathon}
+		source.Location = ""
+		if err := json.Unmarshal(raw, &source); err != nil {
+			return err
+		}
+		config.Marathons[i] = source
+	}
+	return nil
+}
+
+func (config *Config) validateMarathonSources() error {
+	names := map[string]bool{}
+	tags := map[string]bool{config.Consul.Tag: true}
+	for i, source := range config.Marathons {
+		if source.Name == "" || names[source.Name] {
+			return fmt.Errorf("Marathon source #%d requires unique Name", i)
+		}
+		if source.Location == "" {
+			return fmt.Errorf("Marathon source %s requires Location", source.Name)
+		}
+		if source.ConsulTag == "" || tags[source.ConsulTag] {
+			return fmt.Errorf("Marathon source %s requires ConsulTag different than consul-tag and tags of other sources", source.Name)
+		}
+		names[source.Name] = true
+		tags[source.ConsulTag] = true
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/allegro/marathon-consul/consul"
+	"github.com/allegro/marathon-consul/marathon"
+	timeutil "github.com/allegro/marathon-consul/time"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigFromFile_ShouldDefaultMarathonSourcesToMainMarathon(t *testing.T) {
+	t.Parallel()
+
+	// given
+	file := filepath.Join(t.TempDir(), "config.json")
+	blob := []byte(`{
+		"Marathon": {"Protocol": "https", "Timeout": "10s"},
+		"Marathons": [
+			{"Name": "analytics", "Location": "analytics.marathon:8080", "ConsulTag": "marathon-analytics"},
+			{"Name": "batch", "Location": "batch.marathon:8080", "Protocol": "http", "VerifySsl": true, "Username": "batch", "Timeout": "5s", "ConsulTag": "marathon-batch"}
+		]
+	}`)
+	require.NoError(t, ioutil.WriteFile(file, blob, 0644))
+	config := &Config{configFile: file}
+	config.Marathon = marathon.Config{
+		Location:  "main.marathon:8080",
+		Protocol:  "http",
+		Username:  "main",
+		Password:  "secret",
+		VerifySsl: false,
+		Timeout:   timeutil.Interval{Duration: 30 * time.Second},
+	}
+
+	// when
+	err := config.loadConfigFromFile()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []MarathonSource{
+		{
+			Name: "analytics",
+			Config: marathon.Config{
+				Location:  "analytics.marathon:8080",
+				Protocol:  "https",
+				Username:  "main",
+				Password:  "secret",
+				VerifySsl: false,
+				Timeout:   timeutil.Interval{Duration: 10 * time.Second},
+			},
+			ConsulTag: "marathon-analytics",
+		},
+		{
+			Name: "batch",
+			Config: marathon.Config{
+				Location:  "batch.marathon:8080",
+				Protocol:  "http",
+				Username:  "batch",
+				Password:  "secret",
+				VerifySsl: true,
+				Timeout:   timeutil.Interval{Duration: 5 * time.Second},
+			},
+			ConsulTag: "marathon-batch",
+		},
+	}, config.Marathons)
+}
+
+func TestLoadConfigFromFile_ShouldRequireLocationOfMarathonSource(t *testing.T) {
+	t.Parallel()
+
+	// given
+	file := filepath.Join(t.TempDir(), "config.json")
+	blob := []byte(`{"Marathons": [{"Name": "analytics", "ConsulTag": "marathon-analytics"}]}`)
+	require.NoError(t, ioutil.WriteFile(file, blob, 0644))
+	config := &Config{configFile: file, Consul: consul.Config{Tag: "marathon"}}
+	config.Marathon = marathon.Config{Location: "main.marathon:8080"}
+
+	// when
+	err := config.loadConfigFromFile()
+
+	// then
+	assert.NoError(t, err)
+	assert.Error(t, config.validateMarathonSources())
+}
+
+func TestValidateMarathonSources(t *testing.T) {
+	t.Parallel()
+
+	source := func(name, location, tag string) MarathonSource {
+		return MarathonSource{Name: name, Config: marathon.Config{Location: location}, ConsulTag: tag}
+	}
+	var validationTestsData = []struct {
+		sources []MarathonSource
+		valid   bool
+	}{
+		{nil, true},
+		{[]MarathonSource{source("a", "a:8080", "marathon-a"), source("b", "b:8080", "marathon-b")}, true},
+		{[]MarathonSource{source("", "a:8080", "marathon-a")}, false},
+		{[]MarathonSource{source("a", "", "marathon-a")}, false},
+		{[]MarathonSource{source("a", "a:8080", "")}, false},
+		{[]MarathonSource{source("a", "a:8080", "marathon")}, false},
+		{[]MarathonSource{source("a", "a:8080", "marathon-a"), source("a", "b:8080", "marathon-b")}, false},
+		{[]MarathonSource{source("a", "a:8080", "marathon-a"), source("b", "b:8080", "marathon-a")}, false},
+	}
+
+	for _, testData := range validationTestsData {
+		config := &Config{Consul: consul.Config{Tag: "marathon"}, Marathons: testData.sources}
+		err := config.validateMarathonSources()
+		assert.Equal(t, testData.valid, err == nil, "%v", testData.sources)
+	}
+}
@@ -1,7 +1,7 @@
 package consul
 
 import (
-	"fmt"
+	"net"
 	"sync/atomic"
 
 	consulapi "github.com/hashicorp/consul/api"
@@ -22,6 +22,10 @@ func (a *Agent) ClearFailures() {
 	atomic.StoreUint32(&a.failures, 0)
 }
 
+func (a *Agent) Failures() uint32 {
+	return atomic.LoadUint32(&a.failures)
+}
+
 func (a *ConcurrentAgents) createAgent(ipAddress string) (*Agent, error) {
 	client, err := a.newConsulClient(ipAddress)
 	agent := &Agent{
@@ -36,7 +40,7 @@ func (a *ConcurrentAgents) newConsulClient(ipAddress string) (*consulapi.Client,
 
 	config.HttpClient = a.client
 
-	config.Address = fmt.Sprintf("%s:%s", ipAddress, a.config.Port)
+	config.Address = net.JoinHostPort(ipAddress, a.config.Port)
 
 	if a.config.Token != "" {
 		config.Token = a.config.Token
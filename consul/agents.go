@@ -4,7 +4,9 @@ import (
 	"crypto/tls"
 	"errors"
 	"math/rand"
+	"net"
 	"net/http"
+	"sort"
 	"sync"
 
 	"github.com/allegro/marathon-consul/metrics"
@@ -17,6 +19,18 @@ type Agents interface {
 	GetLocalAgent() (agent *Agent, err error)
 	GetAnyAgent() (agent *Agent, err error)
 	RemoveAgent(agentAddress string)
+	Status() AgentsStatus
+}
+
+// AgentsStatus describes content of the agents cache
+type AgentsStatus struct {
+	LocalAgent *AgentStatus  `json:"localAgent,omitempty"`
+	Agents     []AgentStatus `json:"agents"`
+}
+
+type AgentStatus struct {
+	Address  string `json:"address"`
+	Failures uint32 `json:"failures"`
 }
 
 type ConcurrentAgents struct {
@@ -85,7 +99,7 @@ func (a *ConcurrentAgents) RemoveAgent(agentAddress string) {
 	a.lock.Lock()
 	defer a.lock.Unlock()
 
-	if IP, err := utils.HostToIPv4(agentAddress); err != nil {
+	if IP, err := a.agentIP(agentAddress); err != nil {
 		log.WithError(err).Error("Could not remove agent from cache")
 	} else {
 		ipAddress := IP.String()
@@ -99,7 +113,7 @@ func (a *ConcurrentAgents) GetAgent(agentAddress string) (*Agent, error) {
 	a.lock.Lock()
 	defer a.lock.Unlock()
 
-	IP, err := utils.HostToIPv4(agentAddress)
+	IP, err := a.agentIP(agentAddress)
 	if err != nil {
 		return nil, err
 	}
@@ -118,6 +132,34 @@ func (a *ConcurrentAgents) GetAgent(agentAddress string) (*Agent, error) {
 	return newAgent, nil
 }
 
+func (a *ConcurrentAgents) Status() AgentsStatus {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	status := AgentsStatus{Agents: make([]AgentStatus, 0, len(a.agents))}
+	if a.localAgent != nil {
+		status.LocalAgent = &AgentStatus{Address: a.localAgent.IP, Failures: a.localAgent.Failures()}
+	}
+	for ipAddress, agent := range a.agents {
+		status.Agents = append(status.Agents, AgentStatus{Address: ipAddress, Failures: agent.Failures()})
+	}
+	sort.Slice(status.Agents, func(i, j int) bool { return status.Agents[i].Address < status.Agents[j].Address })
+	return status
+}
+
+// agentIP returns IP the agent is cached by, so the same agent is found whether it's referred to by hostname or address.
+// IP literals are used as they are, e.g., address of an IPv4-only node is used in ipv6 mode,
+// only hostnames are resolved with the configured address family.
+func (a *ConcurrentAgents) agentIP(agentAddress string) (net.IP, error) {
+	if IP := net.ParseIP(agentAddress); IP != nil {
+		if v4 := IP.To4(); v4 != nil {
+			return v4, nil
+		}
+		return IP, nil
+	}
+	return utils.HostToIP(agentAddress, utils.AddressFamily(a.config.AddressFamily))
+}
+
 func (a *ConcurrentAgents) addAgent(agentHost string, agent *Agent) {
 	a.agents[agentHost] = agent
 	a.updateAgentsCacheSizeMetricValue()
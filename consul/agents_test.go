@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetAgent(t *testing.T) {
@@ -142,3 +143,80 @@ func TestRemoveAgentTwiceShouldPass(t *testing.T) {
 	// then
 	assert.Empty(t, agents.agents)
 }
+
+func TestStatus_ShouldListCachedAgentsWithFailures(t *testing.T) {
+	t.Parallel()
+	// given
+	agents := NewAgents(&Config{LocalAgentHost: "127.0.0.1"})
+	agent, _ := agents.GetAgent("127.0.0.2")
+	agent.IncFailures()
+	agent.IncFailures()
+
+	// when
+	status := agents.Status()
+
+	// then
+	assert.Equal(t, &AgentStatus{Address: "127.0.0.1", Failures: 0}, status.LocalAgent)
+	assert.Equal(t, []AgentStatus{
+		{Address: "127.0.0.1", Failures: 0},
+		{Address: "127.0.0.2", Failures: 2},
+	}, status.Agents)
+}
+
+func TestGetAgent_ShouldCacheIPv6AgentsByCanonicalAddress(t *testing.T) {
+	t.Parallel()
+	// given
+	agents := NewAgents(&Config{AddressFamily: "ipv6"})
+
+	// when
+	agent1, err := agents.GetAgent("0:0:0:0:0:0:0:1")
+	agent2, _ := agents.GetAgent("::1")
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, agent1, agent2)
+	assert.Equal(t, "::1", agent1.IP)
+	assert.Len(t, agents.agents, 1)
+}
+
+var agentIPLiteralsTestsData = []struct {
+	family   string
+	address  string
+	expected string
+}{
+	{"", "::1", "::1"},
+	{"ipv4", "0:0:0:0:0:0:0:1", "::1"},
+	{"ipv6", "127.0.0.1", "127.0.0.1"},
+	{"ipv6", "::ffff:127.0.0.1", "127.0.0.1"},
+	{"prefer-ipv6", "127.0.0.1", "127.0.0.1"},
+}
+
+func TestGetAgent_ShouldUseIPLiteralsRegardlessOfAddressFamily(t *testing.T) {
+	t.Parallel()
+	for _, testCase := range agentIPLiteralsTestsData {
+		// given
+		agents := NewAgents(&Config{AddressFamily: testCase.family})
+
+		// when
+		agent, err := agents.GetAgent(testCase.address)
+
+		// then
+		require.NoError(t, err, testCase.address)
+		assert.Equal(t, testCase.expected, agent.IP, testCase.address)
+		assert.Contains(t, agents.agents, testCase.expected, testCase.address)
+	}
+}
+
+func TestRemoveAgent_ShouldRemoveIPv4AgentInIPv6Mode(t *testing.T) {
+	t.Parallel()
+	// given
+	agents := NewAgents(&Config{AddressFamily: "ipv6"})
+	_, err := agents.GetAgent("127.0.0.1")
+	require.NoError(t, err)
+
+	// when
+	agents.RemoveAgent("127.0.0.1")
+
+	// then
+	assert.Empty(t, agents.agents)
+}
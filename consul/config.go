@@ -16,9 +16,20 @@ type Config struct {
 	RequestRetries         uint32
 	AgentFailuresTolerance uint32
 	ConsulNameSeparator    string
+	NameTemplate           string
+	GlobalTags             string
 	IgnoredHealthChecks    string
+	CheckThresholds        bool
 	EnableTagOverride      bool
 	LocalAgentHost         string
+	AddressFamily          string
+	LeaderElection         LeaderElection
+}
+
+type LeaderElection struct {
+	Enabled    bool
+	Key        string
+	SessionTTL time.Interval
 }
 
 type Auth struct {
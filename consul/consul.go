@@ -19,6 +19,7 @@ type Consul struct {
 	agents                  Agents
 	config                  Config
 	ignoredHealthCheckTypes []string
+	registrationOptions     apps.RegistrationOptions
 }
 
 type ServicesProvider func(agent *consulAPI.Client) ([]*service.Service, error)
@@ -28,9 +29,29 @@ func New(config Config) *Consul {
 		agents:                  NewAgents(&config),
 		config:                  config,
 		ignoredHealthCheckTypes: ignoredHealthCheckTypesFromRawConfigEntry(config.IgnoredHealthChecks),
+		registrationOptions:     registrationOptionsFromConfig(config),
 	}
 }
 
+// WithTag returns Consul sharing agents cache with c, maintaining only services with the given tag
+func (c *Consul) WithTag(tag string) *Consul {
+	tagged := *c
+	tagged.config.Tag = tag
+	return &tagged
+}
+
+func registrationOptionsFromConfig(config Config) apps.RegistrationOptions {
+	nameTemplate, err := apps.ParseNameTemplate(config.NameTemplate)
+	if err != nil {
+		log.WithError(err).Error("Invalid service name template, using app ID for service names")
+	}
+	tags, err := apps.ParseTagTemplates(config.GlobalTags)
+	if err != nil {
+		log.WithError(err).Error("Invalid global tags, no tags will be added to every registration")
+	}
+	return apps.RegistrationOptions{Separator: config.ConsulNameSeparator, NameTemplate: nameTemplate, Tags: tags}
+}
+
 func (c *Consul) GetServices(name string) ([]*service.Service, error) {
 	return c.getServicesUsingProviderWithRetriesOnAgentFailure(func(agent *consulAPI.Client) ([]*service.Service, error) {
 		return c.getServicesUsingAgent(name, agent)
@@ -132,11 +153,59 @@ func (c *Consul) getAllServices(agent *consulAPI.Client) ([]*service.Service, er
 	return allInstances, nil
 }
 
+// GetAppServices returns services registered for tasks of the app. Catalog lists tags of all instances of a service name,
+// so only names tagged with a task of the app are queried instead of all services.
+func (c *Consul) GetAppServices(appID apps.AppID) ([]*service.Service, error) {
+	return c.getServicesUsingProviderWithRetriesOnAgentFailure(func(agent *consulAPI.Client) ([]*service.Service, error) {
+		return c.getAppServices(appID, agent)
+	})
+}
+
+func (c *Consul) getAppServices(appID apps.AppID, agent *consulAPI.Client) ([]*service.Service, error) {
+	dcAwareQueries, err := dcAwareQueries(agent, c.config.Dc)
+	if err != nil {
+		return nil, err
+	}
+	var appServices []*service.Service
+
+	for _, dcAwareQuery := range dcAwareQueries {
+		consulServices, _, err := agent.Catalog().Services(dcAwareQuery)
+		if err != nil {
+			return nil, err
+		}
+		for consulService, tags := range consulServices {
+			if !contains(tags, c.config.Tag) || !containsMarathonTaskTagOfApp(tags, appID) {
+				continue
+			}
+			consulServiceInstances, _, err := agent.Catalog().Service(consulService, c.config.Tag, dcAwareQuery)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range consulServicesToServices(consulServiceInstances) {
+				if taskID, err := s.TaskID(); err == nil && taskID.AppID() == appID {
+					appServices = append(appServices, s)
+				}
+			}
+		}
+	}
+	return appServices, nil
+}
+
+func containsMarathonTaskTagOfApp(tags []string, appID apps.AppID) bool {
+	for _, tag := range tags {
+		if service.IsMarathonTaskTagOfApp(tag, appID) {
+			return true
+		}
+	}
+	return false
+}
+
 func consulServiceToService(consulService *consulAPI.CatalogService) *service.Service {
 	return &service.Service{
 		ID:                service.ID(consulService.ServiceID),
 		Name:              consulService.ServiceName,
 		Tags:              consulService.ServiceTags,
+		Meta:              consulService.ServiceMeta,
 		AgentAddress:      consulService.Address,
 		EnableTagOverride: consulService.ServiceEnableTagOverride,
 	}
@@ -145,6 +214,9 @@ func consulServiceToService(consulService *consulAPI.CatalogService) *service.Se
 func consulServicesToServices(consulServices []*consulAPI.CatalogService) []*service.Service {
 	var allServices []*service.Service
 	for _, c := range consulServices {
+		if isSidecarProxy(c.ServiceID) {
+			continue
+		}
 		allServices = append(allServices, consulServiceToService(c))
 	}
 	return allServices
@@ -159,6 +231,10 @@ func contains(slice []string, search string) bool {
 	return false
 }
 
+func (c *Consul) RegistrationIntents(task *apps.Task, app *apps.App) []apps.RegistrationIntent {
+	return app.RegistrationIntentsWithOptions(task, c.registrationOptions)
+}
+
 func (c *Consul) Register(task *apps.Task, app *apps.App) error {
 	services, err := c.marathonTaskToConsulServices(task, app)
 	if err != nil {
@@ -176,7 +252,7 @@ func (c *Consul) Register(task *apps.Task, app *apps.App) error {
 	return err
 }
 
-func (c *Consul) registerMultipleServices(services []*consulAPI.AgentServiceRegistration) error {
+func (c *Consul) registerMultipleServices(services []*serviceRegistration) error {
 	var registerErrors []error
 	for _, s := range services {
 		registerErr := c.register(s)
@@ -188,8 +264,8 @@ func (c *Consul) registerMultipleServices(services []*consulAPI.AgentServiceRegi
 	return utils.MergeErrorsOrNil(registerErrors, "registering services")
 }
 
-func (c *Consul) register(service *consulAPI.AgentServiceRegistration) error {
-	agent, err := c.agents.GetAgent(service.Address)
+func (c *Consul) register(service *serviceRegistration) error {
+	agent, err := c.agents.GetAgent(service.agentAddress)
 	if err != nil {
 		return err
 	}
@@ -201,12 +277,16 @@ func (c *Consul) register(service *consulAPI.AgentServiceRegistration) error {
 		"Id":                service.ID,
 		"Tags":              service.Tags,
 		"Address":           service.Address,
+		"AgentAddress":      service.agentAddress,
 		"Port":              service.Port,
 		"EnableTagOverride": service.EnableTagOverride,
 	}
+	if service.Weights != nil {
+		fields["Weights"] = *service.Weights
+	}
 	log.WithFields(fields).Info("Registering")
 
-	err = client.Agent().ServiceRegister(service)
+	err = registerService(client, service)
 	if err != nil {
 		log.WithError(err).WithFields(fields).Error("Unable to register")
 	}
@@ -293,45 +373,132 @@ func (c *Consul) deregister(toDeregister *service.Service) error {
 	return err
 }
 
-func (c *Consul) marathonTaskToConsulServices(task *apps.Task, app *apps.App) ([]*consulAPI.AgentServiceRegistration, error) {
-	IP, err := utils.HostToIPv4(task.Host)
+// EnableMaintenanceByTask puts all services of the task into maintenance mode, so they are excluded from DNS and HTTP queries
+func (c *Consul) EnableMaintenanceByTask(taskID apps.TaskID, reason string) error {
+	return c.maintenanceByTask(taskID, true, reason)
+}
+
+// DisableMaintenanceByTask brings all services of the task back from maintenance mode
+func (c *Consul) DisableMaintenanceByTask(taskID apps.TaskID) error {
+	return c.maintenanceByTask(taskID, false, "")
+}
+
+func (c *Consul) maintenanceByTask(taskID apps.TaskID, enable bool, reason string) error {
+	services, err := c.findServicesByTaskID(taskID)
+	if err != nil {
+		return err
+	} else if len(services) == 0 {
+		log.WithField("Id", taskID).Warningf("Couldn't find any service matching task id")
+		return nil
+	}
+
+	var maintenanceErrors []error
+	for _, s := range services {
+		metrics.Time("consul.maintenance", func() { err = c.maintenance(s, enable, reason) })
+		if err != nil {
+			metrics.Mark("consul.maintenance.error")
+			maintenanceErrors = append(maintenanceErrors, err)
+		} else {
+			metrics.Mark("consul.maintenance.success")
+		}
+	}
+	return utils.MergeErrorsOrNil(maintenanceErrors, fmt.Sprintf("changing maintenance mode of task %s", taskID))
+}
+
+func (c *Consul) maintenance(s *service.Service, enable bool, reason string) error {
+	agent, err := c.agents.GetAgent(s.AgentAddress)
+	if err != nil {
+		return err
+	}
+
+	fields := log.Fields{"Id": s.ID, "Address": s.AgentAddress, "Maintenance": enable}
+	log.WithFields(fields).Info("Changing service maintenance mode")
+
+	if enable {
+		err = agent.Client.Agent().EnableServiceMaintenance(s.ID.String(), reason)
+	} else {
+		err = agent.Client.Agent().DisableServiceMaintenance(s.ID.String())
+	}
+	if err != nil {
+		log.WithError(err).WithFields(fields).Error("Unable to change service maintenance mode")
+	}
+	return err
+}
+
+func (c *Consul) marathonTaskToConsulServices(task *apps.Task, app *apps.App) ([]*serviceRegistration, error) {
+	family := utils.AddressFamily(c.config.AddressFamily)
+	IP, err := utils.HostToIP(task.Host, family)
 	if err != nil {
 		return nil, err
 	}
-	serviceAddress := IP.String()
-	checks := c.marathonToConsulChecks(task, app.HealthChecks, serviceAddress)
+	agentAddress := IP.String()
+	serviceAddress := agentAddress
+	if app.AddressMode() == apps.AddressModeContainer {
+		taskIP, err := utils.SelectIP(task.IPs(), family)
+		if err != nil {
+			return nil, fmt.Errorf("Task %s has no address assigned on container network: %s", task.ID, err)
+		}
+		serviceAddress = taskIP.String()
+	}
+	checks := c.marathonToConsulChecks(task, app, serviceAddress)
 
-	var registrations []*consulAPI.AgentServiceRegistration
-	for _, intent := range app.RegistrationIntents(task, c.config.ConsulNameSeparator) {
+	var registrations []*serviceRegistration
+	for _, intent := range c.RegistrationIntents(task, app) {
 		tags := append([]string{c.config.Tag}, intent.Tags...)
 		tags = append(tags, service.MarathonTaskTag(task.ID))
-		registrations = append(registrations, &consulAPI.AgentServiceRegistration{
-			ID:                c.serviceID(task, intent.Name, intent.Port),
-			Name:              intent.Name,
-			Port:              intent.Port,
-			Address:           serviceAddress,
-			Tags:              tags,
-			Checks:            checks,
-			EnableTagOverride: c.config.EnableTagOverride,
+		registrations = append(registrations, &serviceRegistration{
+			AgentServiceRegistration: &consulAPI.AgentServiceRegistration{
+				ID:                c.serviceID(task, intent.Name, intent.Port),
+				Name:              intent.Name,
+				Port:              intent.Port,
+				Address:           serviceAddress,
+				Tags:              tags,
+				Meta:              c.serviceMeta(task, app, intent.Meta),
+				EnableTagOverride: c.config.EnableTagOverride,
+			},
+			Connect:      marathonToConsulConnect(intent.Connect),
+			Weights:      marathonToConsulWeights(intent.Weights),
+			Checks:       checks,
+			agentAddress: agentAddress,
 		})
 	}
 	return registrations, nil
 }
 
+// serviceMeta adds information about the Marathon task to meta defined with labels
+func (c *Consul) serviceMeta(task *apps.Task, app *apps.App, labelsMeta map[string]string) map[string]string {
+	meta := make(map[string]string, len(labelsMeta)+4)
+	for key, value := range labelsMeta {
+		meta[key] = value
+	}
+	version := task.Version
+	if version == "" {
+		version = app.Version
+	}
+	meta["marathon-app-id"] = app.ID.String()
+	meta["marathon-task-id"] = task.ID.String()
+	meta["marathon-app-version"] = version
+	meta["mesos-host"] = task.Host
+	return meta
+}
+
 func (c *Consul) serviceID(task *apps.Task, name string, port int) string {
 	return fmt.Sprintf("%s_%s_%d", task.ID, name, port)
 }
 
-func (c *Consul) marathonToConsulChecks(task *apps.Task, healthChecks []apps.HealthCheck, serviceAddress string) consulAPI.AgentServiceChecks {
-	var checks = make(consulAPI.AgentServiceChecks, 0, len(healthChecks))
-	for _, check := range healthChecks {
+func (c *Consul) marathonToConsulChecks(task *apps.Task, app *apps.App, serviceAddress string) []*serviceCheck {
+	overrides := app.CheckOverrides()
+	deriveThresholds := overrides.DeriveThresholds(c.config.CheckThresholds)
+	ports := app.ServicePorts(task)
+	var checks = make([]*serviceCheck, 0, len(app.HealthChecks))
+	for _, check := range app.HealthChecks {
 		if contains(c.ignoredHealthCheckTypes, check.Protocol) {
 			log.WithField("Id", task.AppID.String()).WithField("Address", serviceAddress).
 				Info(fmt.Sprintf("Ignoring health check of type %s", check.Protocol))
 			continue
 		}
 
-		port, err := getHealthCheckPort(check, *task)
+		port, err := getHealthCheckPort(check, ports)
 		if err != nil {
 			log.WithField("Id", task.AppID.String()).WithField("Address", serviceAddress).WithError(err).
 				Warnf("Ignoring health check of type %s", check.Protocol)
@@ -339,7 +506,7 @@ func (c *Consul) marathonToConsulChecks(task *apps.Task, healthChecks []apps.Hea
 		}
 
 		if c := marathonToConsulCheck(task, check, serviceAddress, port); c != nil {
-			checks = append(checks, c)
+			checks = append(checks, withCheckOptions(c, task, check, overrides, deriveThresholds))
 		}
 
 	}
@@ -366,7 +533,7 @@ func marathonToConsulCheck(task *apps.Task, check apps.HealthCheck, serviceAddre
 			} else {
 				parsedURL.Scheme = "https"
 			}
-			parsedURL.Host = fmt.Sprintf("%s:%d", serviceAddress, port)
+			parsedURL.Host = utils.HostPort(serviceAddress, port)
 			consulCheck.HTTP = parsedURL.String()
 			return consulCheck
 		}
@@ -375,7 +542,7 @@ func marathonToConsulCheck(task *apps.Task, check apps.HealthCheck, serviceAddre
 			WithField("Address", serviceAddress).
 			Warnf("Could not parse provided path: %s", path)
 	case "TCP", "MESOS_TCP":
-		consulCheck.TCP = fmt.Sprintf("%s:%d", serviceAddress, port)
+		consulCheck.TCP = utils.HostPort(serviceAddress, port)
 		return consulCheck
 	case "COMMAND":
 		consulCheck.Args = []string{substituteEnvironment(check.Command.Value, *task)}
@@ -387,14 +554,14 @@ func marathonToConsulCheck(task *apps.Task, check apps.HealthCheck, serviceAddre
 	return nil
 }
 
-func getHealthCheckPort(check apps.HealthCheck, task apps.Task) (int, error) {
+func getHealthCheckPort(check apps.HealthCheck, ports []int) (int, error) {
 	port := 0
 	if check.Port != 0 {
 		port = check.Port
-	} else if check.PortIndex >= 0 && check.PortIndex < len(task.Ports) {
-		port = task.Ports[check.PortIndex]
+	} else if check.PortIndex >= 0 && check.PortIndex < len(ports) {
+		port = ports[check.PortIndex]
 	} else {
-		return 0, fmt.Errorf("Port index (%d) out of bounds should from range [0,%d)", check.PortIndex, len(task.Ports))
+		return 0, fmt.Errorf("Port index (%d) out of bounds should from range [0,%d)", check.PortIndex, len(ports))
 	}
 
 	if port < 1 || port > 65535 {
@@ -436,6 +603,10 @@ func (c *Consul) AddAgentsFromApps(apps []*apps.App) {
 	}
 }
 
+func (c *Consul) AgentsStatus() AgentsStatus {
+	return c.agents.Status()
+}
+
 func (c *Consul) AddAgent(agentAddress string) error {
 	_, err := c.agents.GetAgent(agentAddress)
 	return err
@@ -17,6 +17,7 @@ type Stub struct {
 	failRegisterForIDs         map[apps.TaskID]bool
 	failDeregisterByTaskForIDs map[apps.TaskID]bool
 	failDeregisterForIDs       map[service.ID]bool
+	maintenance                map[service.ID]string
 	consul                     *Consul
 }
 
@@ -31,6 +32,7 @@ func NewConsulStubWithTag(tag string) *Stub {
 		failRegisterForIDs:         make(map[apps.TaskID]bool),
 		failDeregisterByTaskForIDs: make(map[apps.TaskID]bool),
 		failDeregisterForIDs:       make(map[service.ID]bool),
+		maintenance:                make(map[service.ID]string),
 		consul:                     New(Config{Tag: tag, ConsulNameSeparator: "."}),
 	}
 }
@@ -40,16 +42,31 @@ func (c *Stub) GetAllServices() ([]*service.Service, error) {
 	defer c.RUnlock()
 	var allServices []*service.Service
 	for _, s := range c.services {
+		if isSidecarProxy(s.ID) {
+			continue
+		}
 		allServices = append(allServices, &service.Service{
 			ID:           service.ID(s.ID),
 			Name:         s.Name,
 			Tags:         s.Tags,
+			Meta:         s.Meta,
 			AgentAddress: s.Address,
 		})
 	}
 	return allServices, nil
 }
 
+func (c *Stub) GetAppServices(appID apps.AppID) ([]*service.Service, error) {
+	all, _ := c.GetAllServices()
+	var services []*service.Service
+	for _, s := range all {
+		if taskID, err := s.TaskID(); err == nil && taskID.AppID() == appID {
+			services = append(services, s)
+		}
+	}
+	return services, nil
+}
+
 func (c *Stub) FailGetServicesForName(failOnName string) {
 	c.failGetServicesForNames[failOnName] = true
 }
@@ -74,11 +91,12 @@ func (c *Stub) GetServices(name string) ([]*service.Service, error) {
 	}
 	var services []*service.Service
 	for _, s := range c.services {
-		if s.Name == name && contains(s.Tags, c.consul.config.Tag) {
+		if s.Name == name && contains(s.Tags, c.consul.config.Tag) && !isSidecarProxy(s.ID) {
 			services = append(services, &service.Service{
 				ID:           service.ID(s.ID),
 				Name:         s.Name,
 				Tags:         s.Tags,
+				Meta:         s.Meta,
 				AgentAddress: s.Address,
 			})
 		}
@@ -86,6 +104,10 @@ func (c *Stub) GetServices(name string) ([]*service.Service, error) {
 	return services, nil
 }
 
+func (c *Stub) RegistrationIntents(task *apps.Task, app *apps.App) []apps.RegistrationIntent {
+	return c.consul.RegistrationIntents(task, app)
+}
+
 func (c *Stub) Register(task *apps.Task, app *apps.App) error {
 	c.Lock()
 	defer c.Unlock()
@@ -97,15 +119,47 @@ func (c *Stub) Register(task *apps.Task, app *apps.App) error {
 		return err
 	}
 	for _, r := range serviceRegistrations {
-		c.services[service.ID(r.ID)] = r
+		c.services[service.ID(r.ID)] = r.AgentServiceRegistration
+		if r.Connect != nil && r.Connect.SidecarService != nil {
+			c.registerSidecarProxy(r)
+		}
 	}
 	return nil
 }
 
+// registerSidecarProxy registers the sidecar the way Consul agent does, copying tags of the service when none are given
+func (c *Stub) registerSidecarProxy(r *serviceRegistration) {
+	tags := r.Connect.SidecarService.Tags
+	if len(tags) == 0 {
+		tags = r.Tags
+	}
+	c.services[service.ID(r.ID+sidecarProxyIDSuffix)] = &consulapi.AgentServiceRegistration{
+		Kind:    consulapi.ServiceKindConnectProxy,
+		ID:      r.ID + sidecarProxyIDSuffix,
+		Name:    r.Name + sidecarProxyIDSuffix,
+		Port:    r.Connect.SidecarService.Port,
+		Address: r.Address,
+		Tags:    tags,
+	}
+}
+
+// SidecarProxyIDs returns IDs of sidecars registered together with the services
+func (c *Stub) SidecarProxyIDs() []service.ID {
+	c.RLock()
+	defer c.RUnlock()
+	ids := []service.ID{}
+	for id := range c.services {
+		if isSidecarProxy(string(id)) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
 func (c *Stub) RegisterWithoutMarathonTaskTag(task *apps.Task, app *apps.App) {
 	c.Lock()
 	defer c.Unlock()
-	for _, intent := range app.RegistrationIntents(task, c.consul.config.ConsulNameSeparator) {
+	for _, intent := range c.consul.RegistrationIntents(task, app) {
 		serviceRegistration := consulapi.AgentServiceRegistration{
 			ID:      task.ID.String(),
 			Name:    intent.Name,
@@ -122,7 +176,7 @@ func (c *Stub) RegisterOnlyFirstRegistrationIntent(task *apps.Task, app *apps.Ap
 	c.Lock()
 	defer c.Unlock()
 	serviceRegistrations, _ := c.consul.marathonTaskToConsulServices(task, app)
-	c.services[service.ID(serviceRegistrations[0].ID)] = serviceRegistrations[0]
+	c.services[service.ID(serviceRegistrations[0].ID)] = serviceRegistrations[0].AgentServiceRegistration
 }
 
 func (c *Stub) DeregisterByTask(taskID apps.TaskID) error {
@@ -132,7 +186,7 @@ func (c *Stub) DeregisterByTask(taskID apps.TaskID) error {
 		return fmt.Errorf("Consul stub programmed to fail when deregistering task of id %s", taskID.String())
 	}
 	for _, x := range c.servicesMatchingTask(taskID) {
-		delete(c.services, service.ID(x.ID))
+		c.deregister(service.ID(x.ID))
 	}
 	return nil
 }
@@ -143,10 +197,50 @@ func (c *Stub) Deregister(toDeregister *service.Service) error {
 	if _, ok := c.failDeregisterForIDs[toDeregister.ID]; ok {
 		return fmt.Errorf("Consul stub programmed to fail when deregistering service of id %s", toDeregister.ID)
 	}
-	delete(c.services, toDeregister.ID)
+	c.deregister(toDeregister.ID)
+	return nil
+}
+
+// deregister removes the service together with its sidecar, as Consul agent does
+func (c *Stub) deregister(id service.ID) {
+	delete(c.services, id)
+	delete(c.services, id+sidecarProxyIDSuffix)
+	delete(c.maintenance, id)
+}
+
+func (c *Stub) EnableMaintenanceByTask(taskID apps.TaskID, reason string) error {
+	c.Lock()
+	defer c.Unlock()
+	for _, x := range c.servicesMatchingTask(taskID) {
+		c.maintenance[service.ID(x.ID)] = reason
+	}
 	return nil
 }
 
+func (c *Stub) DisableMaintenanceByTask(taskID apps.TaskID) error {
+	c.Lock()
+	defer c.Unlock()
+	for _, x := range c.servicesMatchingTask(taskID) {
+		delete(c.maintenance, service.ID(x.ID))
+	}
+	return nil
+}
+
+// MaintenanceTaskIDs returns IDs of tasks having services of given name in maintenance mode
+func (c *Stub) MaintenanceTaskIDs(serviceName string) []apps.TaskID {
+	services, _ := c.GetServices(serviceName)
+	c.RLock()
+	defer c.RUnlock()
+	taskIds := []apps.TaskID{}
+	for _, s := range services {
+		if _, ok := c.maintenance[s.ID]; ok {
+			taskID, _ := s.TaskID()
+			taskIds = append(taskIds, taskID)
+		}
+	}
+	return taskIds
+}
+
 func (c *Stub) servicesMatchingTask(taskID apps.TaskID) []*consulapi.AgentServiceRegistration {
 	matching := []*consulapi.AgentServiceRegistration{}
 	for _, s := range c.services {
@@ -1,6 +1,7 @@
 package consul
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 	"time"
@@ -267,6 +268,44 @@ func TestGetAllServices(t *testing.T) {
 	assert.Contains(t, serviceNames, "serviceB")
 }
 
+func TestGetAppServices(t *testing.T) {
+	t.Parallel()
+	// create cluster of 2 consul servers
+	server1 := CreateTestServer(t)
+	defer server1.Stop()
+
+	server2 := CreateTestServer(t)
+	defer server2.Stop()
+
+	server1.JoinWAN(t, server2.LANAddr)
+
+	// create client
+	consul := ClientAtServer(server1)
+	consul.config.Tag = "marathon"
+
+	// given
+	// register services of the app and other apps in both servers
+	server1.AddService(t, "serviceA", "passing", []string{"marathon", "marathon-task:test_app.1"})
+	server1.AddService(t, "serviceB", "passing", []string{"marathon", "marathon-task:other.1"})
+	server1.AddService(t, "serviceC", "passing", []string{"zookeeper", "marathon-task:test_app.2"})
+
+	server2.AddService(t, "serviceB", "passing", []string{"marathon", "marathon-task:test_app.3"})
+
+	// when
+	services, err := consul.GetAppServices("/test/app")
+
+	// then
+	assert.NoError(t, err)
+	assert.Len(t, services, 2)
+
+	serviceNames := make(map[string]struct{})
+	for _, s := range services {
+		serviceNames[s.Name] = struct{}{}
+	}
+	assert.Contains(t, serviceNames, "serviceA")
+	assert.Contains(t, serviceNames, "serviceB")
+}
+
 func TestGetServicesFromSingleDc(t *testing.T) {
 	t.Parallel()
 	// create cluster of 2 consul servers
@@ -924,42 +963,54 @@ func TestMarathonTaskToConsulServiceMapping(t *testing.T) {
 	assert.Nil(t, service.Check)
 	assert.Equal(t, 6, len(service.Checks))
 
-	assert.Equal(t, consulapi.AgentServiceChecks{
+	assert.Equal(t, []*serviceCheck{
 		{
-			HTTP:     "http://127.0.0.6:8123/api/health?with=query",
-			Interval: "60s",
-			Timeout:  "20s",
-			Status:   "passing",
+			AgentServiceCheck: &consulapi.AgentServiceCheck{
+				HTTP:     "http://127.0.0.6:8123/api/health?with=query",
+				Interval: "60s",
+				Timeout:  "20s",
+				Status:   "passing",
+			},
 		},
 		{
-			HTTP:     "http://127.0.0.6:8090/",
-			Interval: "60s",
-			Timeout:  "20s",
-			Status:   "passing",
+			AgentServiceCheck: &consulapi.AgentServiceCheck{
+				HTTP:     "http://127.0.0.6:8090/",
+				Interval: "60s",
+				Timeout:  "20s",
+				Status:   "passing",
+			},
 		},
 		{
-			HTTP:     "https://127.0.0.6:8090/secure/health?with=query",
-			Interval: "50s",
-			Timeout:  "20s",
-			Status:   "passing",
+			AgentServiceCheck: &consulapi.AgentServiceCheck{
+				HTTP:     "https://127.0.0.6:8090/secure/health?with=query",
+				Interval: "50s",
+				Timeout:  "20s",
+				Status:   "passing",
+			},
 		},
 		{
-			TCP:      "127.0.0.6:8443",
-			Interval: "40s",
-			Timeout:  "20s",
-			Status:   "passing",
+			AgentServiceCheck: &consulapi.AgentServiceCheck{
+				TCP:      "127.0.0.6:8443",
+				Interval: "40s",
+				Timeout:  "20s",
+				Status:   "passing",
+			},
 		},
 		{
-			TCP:      "127.0.0.6:8234",
-			Interval: "40s",
-			Timeout:  "20s",
-			Status:   "passing",
+			AgentServiceCheck: &consulapi.AgentServiceCheck{
+				TCP:      "127.0.0.6:8234",
+				Interval: "40s",
+				Timeout:  "20s",
+				Status:   "passing",
+			},
 		},
 		{
-			Args:     []string{"echo 1"},
-			Interval: "30s",
-			Timeout:  "20s",
-			Status:   "passing",
+			AgentServiceCheck: &consulapi.AgentServiceCheck{
+				Args:     []string{"echo 1"},
+				Interval: "30s",
+				Timeout:  "20s",
+				Status:   "passing",
+			},
 		},
 	}, service.Checks)
 }
@@ -1069,24 +1120,30 @@ func TestMarathonTaskToConsulServiceMapping_IgnoredHealthcheckTypes(t *testing.T
 	assert.Nil(t, service.Check)
 	assert.Equal(t, 3, len(service.Checks))
 
-	assert.Equal(t, consulapi.AgentServiceChecks{
+	assert.Equal(t, []*serviceCheck{
 		{
-			HTTP:     "http://127.0.0.6:8090/api/health?with=query",
-			Interval: "60s",
-			Timeout:  "20s",
-			Status:   "passing",
+			AgentServiceCheck: &consulapi.AgentServiceCheck{
+				HTTP:     "http://127.0.0.6:8090/api/health?with=query",
+				Interval: "60s",
+				Timeout:  "20s",
+				Status:   "passing",
+			},
 		},
 		{
-			HTTP:     "http://127.0.0.6:8090/",
-			Interval: "60s",
-			Timeout:  "20s",
-			Status:   "passing",
+			AgentServiceCheck: &consulapi.AgentServiceCheck{
+				HTTP:     "http://127.0.0.6:8090/",
+				Interval: "60s",
+				Timeout:  "20s",
+				Status:   "passing",
+			},
 		},
 		{
-			HTTP:     "https://127.0.0.6:8090/secure/health?with=query",
-			Interval: "50s",
-			Timeout:  "20s",
-			Status:   "passing",
+			AgentServiceCheck: &consulapi.AgentServiceCheck{
+				HTTP:     "https://127.0.0.6:8090/secure/health?with=query",
+				Interval: "50s",
+				Timeout:  "20s",
+				Status:   "passing",
+			},
 		},
 	}, service.Checks)
 }
@@ -1127,6 +1184,509 @@ func TestMarathonTaskToConsulServiceMapping_NotResolvableTaskHost(t *testing.T)
 	assert.Error(t, err)
 }
 
+func TestMarathonTaskToConsulServiceMapping_Connect(t *testing.T) {
+	t.Parallel()
+
+	// given
+	consul := New(Config{Tag: "marathon"})
+	app := &apps.App{
+		ID: "someApp",
+		Labels: map[string]string{
+			"consul":                    "true",
+			"consul-connect":            "proxy",
+			"consul-connect-proxy-port": "{port:proxy}",
+			"consul-connect-upstreams":  "db:9191",
+		},
+		PortDefinitions: []apps.PortDefinition{{}, {Name: "proxy"}},
+	}
+	task := &apps.Task{
+		ID:    "someTask",
+		AppID: app.ID,
+		Host:  "127.0.0.6",
+		Ports: []int{8090, 8443},
+	}
+
+	// when
+	services, err := consul.marathonTaskToConsulServices(task, app)
+
+	// then
+	assert.NoError(t, err)
+	assert.Len(t, services, 1)
+	assert.Equal(t, &serviceConnect{
+		SidecarService: &sidecarService{
+			Port:  8443,
+			Tags:  []string{"connect-proxy"},
+			Proxy: &sidecarProxy{Upstreams: []sidecarUpstream{{DestinationName: "db", LocalBindPort: 9191}}},
+		},
+	}, services[0].Connect)
+	assert.Nil(t, services[0].AgentServiceRegistration.Connect)
+}
+
+func TestMarathonTaskToConsulServiceMapping_Meta(t *testing.T) {
+	t.Parallel()
+
+	// given
+	consul := New(Config{Tag: "marathon"})
+	app := &apps.App{
+		ID:      "/some/app",
+		Version: "2015-12-01T10:03:32.003Z",
+		Labels: map[string]string{
+			"consul":                      "true",
+			"consul-meta:owner":           "team-a",
+			"consul-meta:marathon-app-id": "overridden",
+		},
+	}
+	task := &apps.Task{
+		ID:    "some_app.1",
+		AppID: app.ID,
+		Host:  "127.0.0.6",
+		Ports: []int{8090},
+	}
+
+	// when
+	services, err := consul.marathonTaskToConsulServices(task, app)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"owner":                "team-a",
+		"marathon-app-id":      "/some/app",
+		"marathon-task-id":     "some_app.1",
+		"marathon-app-version": "2015-12-01T10:03:32.003Z",
+		"mesos-host":           "127.0.0.6",
+	}, services[0].Meta)
+}
+
+func TestMarathonTaskToConsulServiceMapping_Weights(t *testing.T) {
+	t.Parallel()
+
+	// given
+	consul := New(Config{Tag: "marathon"})
+	app := &apps.App{
+		ID: "/canary",
+		Labels: map[string]string{
+			"consul":                "app",
+			"consul-weight-passing": "1",
+			"consul-weight-warning": "0",
+		},
+	}
+	task := &apps.Task{
+		ID:    "canary.1",
+		AppID: app.ID,
+		Host:  "127.0.0.6",
+		Ports: []int{8090},
+	}
+
+	// when
+	services, err := consul.marathonTaskToConsulServices(task, app)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, &serviceWeights{Passing: 1, Warning: 0}, services[0].Weights)
+}
+
+func TestServiceRegistration_ShouldSerializeWeightsOnlyWhenSet(t *testing.T) {
+	t.Parallel()
+
+	// given
+	withWeights := &serviceRegistration{
+		AgentServiceRegistration: &consulapi.AgentServiceRegistration{ID: "id", Name: "app"},
+		Weights:                  &serviceWeights{Passing: 3, Warning: 1},
+	}
+	withoutWeights := &serviceRegistration{
+		AgentServiceRegistration: &consulapi.AgentServiceRegistration{ID: "id", Name: "app"},
+	}
+
+	// when
+	withWeightsJSON, err1 := json.Marshal(withWeights)
+	withoutWeightsJSON, err2 := json.Marshal(withoutWeights)
+
+	// then
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	assert.Contains(t, string(withWeightsJSON), `"Weights":{"Passing":3,"Warning":1}`)
+	assert.Contains(t, string(withWeightsJSON), `"Name":"app"`)
+	assert.NotContains(t, string(withoutWeightsJSON), "Weights")
+}
+
+func TestMarathonTaskToConsulServiceMapping_CheckOptionsFromThresholds(t *testing.T) {
+	t.Parallel()
+
+	// given
+	consul := New(Config{Tag: "marathon", CheckThresholds: true})
+	app := &apps.App{
+		ID: "someApp",
+		HealthChecks: []apps.HealthCheck{
+			{
+				Protocol:               "TCP",
+				GracePeriodSeconds:     300,
+				IntervalSeconds:        90,
+				TimeoutSeconds:         20,
+				MaxConsecutiveFailures: 5,
+			},
+			{
+				Protocol:        "TCP",
+				IntervalSeconds: 10,
+				TimeoutSeconds:  5,
+			},
+		},
+		Labels: map[string]string{
+			"consul":                    "true",
+			"consul-check-grace-status": "warning",
+		},
+	}
+	task := &apps.Task{
+		ID:        "someTask",
+		AppID:     app.ID,
+		Host:      "127.0.0.6",
+		Ports:     []int{8090},
+		StartedAt: timeutil.Timestamp{Time: time.Now().Add(-time.Minute)},
+	}
+
+	// when
+	services, err := consul.marathonTaskToConsulServices(task, app)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []*serviceCheck{
+		{
+			AgentServiceCheck: &consulapi.AgentServiceCheck{
+				TCP:                            "127.0.0.6:8090",
+				Interval:                       "90s",
+				Timeout:                        "20s",
+				Status:                         "warning",
+				DeregisterCriticalServiceAfter: "390s",
+			},
+			FailuresBeforeCritical: 5,
+		},
+		{
+			AgentServiceCheck: &consulapi.AgentServiceCheck{
+				TCP:      "127.0.0.6:8090",
+				Interval: "10s",
+				Timeout:  "5s",
+				Status:   "passing",
+			},
+		},
+	}, services[0].Checks)
+}
+
+func TestMarathonTaskToConsulServiceMapping_CheckOptionsFromLabels(t *testing.T) {
+	t.Parallel()
+
+	// given
+	consul := New(Config{Tag: "marathon"})
+	app := &apps.App{
+		ID: "someApp",
+		HealthChecks: []apps.HealthCheck{
+			{
+				Protocol:               "TCP",
+				GracePeriodSeconds:     30,
+				IntervalSeconds:        10,
+				TimeoutSeconds:         5,
+				MaxConsecutiveFailures: 3,
+			},
+		},
+		Labels: map[string]string{
+			"consul":                                 "true",
+			"consul-check-grace-status":              "critical",
+			"consul-check-success-before-passing":    "2",
+			"consul-check-failures-before-critical":  "1",
+			"consul-check-deregister-critical-after": "0",
+		},
+	}
+	task := &apps.Task{
+		ID:        "someTask",
+		AppID:     app.ID,
+		Host:      "127.0.0.6",
+		Ports:     []int{8090},
+		StartedAt: timeutil.Timestamp{Time: time.Now().Add(-time.Hour)},
+	}
+
+	// when
+	services, err := consul.marathonTaskToConsulServices(task, app)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []*serviceCheck{
+		{
+			AgentServiceCheck: &consulapi.AgentServiceCheck{
+				TCP:      "127.0.0.6:8090",
+				Interval: "10s",
+				Timeout:  "5s",
+				Status:   "passing",
+			},
+			SuccessBeforePassing:   2,
+			FailuresBeforeCritical: 1,
+		},
+	}, services[0].Checks)
+}
+
+var checkThresholdsTestsData = []struct {
+	name       string
+	config     bool
+	label      string
+	thresholds bool
+}{
+	{"disabled by default", false, "", false},
+	{"enabled with config", true, "", true},
+	{"enabled with label", false, "true", true},
+	{"disabled with label", true, "false", false},
+	{"invalid label", true, "sometimes", true},
+}
+
+func TestMarathonTaskToConsulServiceMapping_CheckThresholdsAreOptIn(t *testing.T) {
+	t.Parallel()
+	for _, testCase := range checkThresholdsTestsData {
+		// given
+		consul := New(Config{Tag: "marathon", CheckThresholds: testCase.config})
+		app := &apps.App{
+			ID: "someApp",
+			HealthChecks: []apps.HealthCheck{
+				{Protocol: "TCP", IntervalSeconds: 10, TimeoutSeconds: 5, MaxConsecutiveFailures: 3},
+			},
+			Labels: map[string]string{"consul": "true"},
+		}
+		if testCase.label != "" {
+			app.Labels["consul-check-thresholds"] = testCase.label
+		}
+		task := &apps.Task{ID: "someTask", AppID: app.ID, Host: "127.0.0.6", Ports: []int{8090}}
+
+		// when
+		services, err := consul.marathonTaskToConsulServices(task, app)
+
+		// then
+		assert.NoError(t, err, testCase.name)
+		check := services[0].Checks[0]
+		if testCase.thresholds {
+			assert.Equal(t, 3, check.FailuresBeforeCritical, testCase.name)
+			assert.Equal(t, "60s", check.DeregisterCriticalServiceAfter, testCase.name)
+		} else {
+			assert.Zero(t, check.FailuresBeforeCritical, testCase.name)
+			assert.Empty(t, check.DeregisterCriticalServiceAfter, testCase.name)
+		}
+	}
+}
+
+func TestServiceRegistration_ShouldSerializeExtendedCheckOptions(t *testing.T) {
+	t.Parallel()
+
+	// given
+	registration := &serviceRegistration{
+		AgentServiceRegistration: &consulapi.AgentServiceRegistration{ID: "id", Name: "app"},
+		Checks: []*serviceCheck{{
+			AgentServiceCheck:      &consulapi.AgentServiceCheck{TCP: "127.0.0.6:8090"},
+			SuccessBeforePassing:   2,
+			FailuresBeforeCritical: 3,
+		}},
+	}
+
+	// when
+	registrationJSON, err := json.Marshal(registration)
+
+	// then
+	assert.NoError(t, err)
+	assert.Contains(t, string(registrationJSON), `"Checks":[{"TCP":"127.0.0.6:8090","SuccessBeforePassing":2,"FailuresBeforeCritical":3}]`)
+}
+
+func TestMarathonTaskToConsulServiceMapping_ContainerNetwork(t *testing.T) {
+	t.Parallel()
+
+	// given
+	consul := New(Config{Tag: "marathon"})
+	app := &apps.App{
+		ID:       "someApp",
+		Labels:   map[string]string{"consul": "true"},
+		Networks: []apps.Network{{Mode: "container", Name: "dcos"}},
+		Container: apps.Container{
+			PortMappings: []apps.PortDefinition{{ContainerPort: 8080}},
+		},
+		HealthChecks: []apps.HealthCheck{
+			{
+				Protocol:        "MESOS_HTTP",
+				Path:            "/status",
+				IntervalSeconds: 10,
+				TimeoutSeconds:  5,
+			},
+		},
+	}
+	task := &apps.Task{
+		ID:          "someTask",
+		AppID:       app.ID,
+		Host:        "127.0.0.6",
+		IPAddresses: []apps.IPAddress{{IPAddress: "9.0.0.1", Protocol: "IPv4"}},
+	}
+
+	// when
+	services, err := consul.marathonTaskToConsulServices(task, app)
+
+	// then
+	assert.NoError(t, err)
+	assert.Len(t, services, 1)
+	assert.Equal(t, "9.0.0.1", services[0].Address)
+	assert.Equal(t, 8080, services[0].Port)
+	assert.Equal(t, "127.0.0.6", services[0].agentAddress)
+	assert.Equal(t, "http://9.0.0.1:8080/status", services[0].Checks[0].HTTP)
+}
+
+func TestMarathonTaskToConsulServiceMapping_ContainerNetworkWithoutTaskAddress(t *testing.T) {
+	t.Parallel()
+
+	// given
+	consul := New(Config{Tag: "marathon"})
+	app := &apps.App{
+		ID:     "someApp",
+		Labels: map[string]string{"consul": "true", "consul-address-mode": "container"},
+	}
+	task := &apps.Task{
+		ID:    "someTask",
+		AppID: app.ID,
+		Host:  "127.0.0.6",
+		Ports: []int{31000},
+	}
+
+	// when
+	_, err := consul.marathonTaskToConsulServices(task, app)
+
+	// then
+	assert.Error(t, err)
+}
+
+func TestMarathonTaskToConsulServiceMapping_IPv6(t *testing.T) {
+	t.Parallel()
+
+	// given
+	consul := New(Config{Tag: "marathon", AddressFamily: "prefer-ipv6"})
+	app := &apps.App{
+		ID:     "someApp",
+		Labels: map[string]string{"consul": "true"},
+		HealthChecks: []apps.HealthCheck{
+			{Protocol: "HTTP", Path: "/status", IntervalSeconds: 10, TimeoutSeconds: 5},
+			{Protocol: "TCP", IntervalSeconds: 10, TimeoutSeconds: 5},
+		},
+	}
+	task := &apps.Task{
+		ID:    "someTask",
+		AppID: app.ID,
+		Host:  "fd00::6",
+		Ports: []int{8090},
+	}
+
+	// when
+	services, err := consul.marathonTaskToConsulServices(task, app)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "fd00::6", services[0].Address)
+	assert.Equal(t, "fd00::6", services[0].agentAddress)
+	assert.Equal(t, "http://[fd00::6]:8090/status", services[0].Checks[0].HTTP)
+	assert.Equal(t, "[fd00::6]:8090", services[0].Checks[1].TCP)
+}
+
+func TestRegistrationIntents_NameTemplate(t *testing.T) {
+	t.Parallel()
+
+	// given
+	consul := New(Config{Tag: "marathon", ConsulNameSeparator: ".", NameTemplate: "{{last .Segments}}-{{index .Segments 0}}"})
+	app := &apps.App{
+		ID:     "/prod/service",
+		Labels: map[string]string{"consul": ""},
+	}
+	task := &apps.Task{ID: "prod_service.1", Ports: []int{8090}}
+
+	// when
+	intents := consul.RegistrationIntents(task, app)
+
+	// then
+	assert.Equal(t, "service-prod", intents[0].Name)
+}
+
+func TestMarathonTaskToConsulServiceMapping_GlobalTags(t *testing.T) {
+	t.Parallel()
+
+	// given
+	consul := New(Config{Tag: "marathon", ConsulNameSeparator: ".", GlobalTags: "urlprefix-{{.ServiceName}}.example.com/"})
+	app := &apps.App{
+		ID:     "/service",
+		Labels: map[string]string{"consul": ""},
+	}
+	task := &apps.Task{ID: "service.1", AppID: app.ID, Host: "127.0.0.6", Ports: []int{8090}}
+
+	// when
+	services, err := consul.marathonTaskToConsulServices(task, app)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"marathon", "urlprefix-service.example.com/", "marathon-task:service.1"}, services[0].Tags)
+}
+
+func TestMarathonToConsulConnect(t *testing.T) {
+	t.Parallel()
+
+	// expect
+	assert.Nil(t, marathonToConsulConnect(nil))
+	assert.Equal(t, &serviceConnect{Native: true}, marathonToConsulConnect(&apps.ConnectIntent{Native: true}))
+	assert.Equal(t, &serviceConnect{SidecarService: &sidecarService{Tags: []string{"connect-proxy"}}}, marathonToConsulConnect(&apps.ConnectIntent{}))
+}
+
+func TestConsulServicesToServices_ShouldSkipSidecarProxies(t *testing.T) {
+	t.Parallel()
+
+	// given
+	consulServices := []*consulapi.CatalogService{
+		{ServiceID: "app.1_app_8090", ServiceName: "app", ServiceTags: []string{"marathon", "marathon-task:app.1"}},
+		{ServiceID: "app.1_app_8090-sidecar-proxy", ServiceName: "app-sidecar-proxy", ServiceTags: []string{"marathon", "marathon-task:app.1"}},
+	}
+
+	// when
+	services := consulServicesToServices(consulServices)
+
+	// then
+	assert.Len(t, services, 1)
+	assert.Equal(t, service.ID("app.1_app_8090"), services[0].ID)
+}
+
+func TestServiceRegistration_ShouldSerializeSidecarService(t *testing.T) {
+	t.Parallel()
+
+	// given
+	withSidecar := &serviceRegistration{
+		AgentServiceRegistration: &consulapi.AgentServiceRegistration{ID: "id", Name: "app", Port: 8090},
+		Connect: marathonToConsulConnect(&apps.ConnectIntent{
+			ProxyPort: 8443,
+			Upstreams: []apps.ConnectUpstream{{DestinationName: "db", LocalBindPort: 9191}},
+		}),
+	}
+	withDefaultSidecar := &serviceRegistration{
+		AgentServiceRegistration: &consulapi.AgentServiceRegistration{ID: "id", Name: "app"},
+		Connect:                  marathonToConsulConnect(&apps.ConnectIntent{}),
+	}
+	native := &serviceRegistration{
+		AgentServiceRegistration: &consulapi.AgentServiceRegistration{ID: "id", Name: "app"},
+		Connect:                  marathonToConsulConnect(&apps.ConnectIntent{Native: true}),
+	}
+	withoutConnect := &serviceRegistration{
+		AgentServiceRegistration: &consulapi.AgentServiceRegistration{ID: "id", Name: "app"},
+	}
+
+	// when
+	withSidecarJSON, err1 := json.Marshal(withSidecar)
+	withDefaultSidecarJSON, err2 := json.Marshal(withDefaultSidecar)
+	nativeJSON, err3 := json.Marshal(native)
+	withoutConnectJSON, err4 := json.Marshal(withoutConnect)
+
+	// then
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	assert.NoError(t, err3)
+	assert.NoError(t, err4)
+	assert.Contains(t, string(withSidecarJSON),
+		`"Connect":{"SidecarService":{"Port":8443,"Tags":["connect-proxy"],"Proxy":{"Upstreams":[{"DestinationName":"db","LocalBindPort":9191}]}}}`)
+	assert.Contains(t, string(withSidecarJSON), `"Port":8090`)
+	assert.Contains(t, string(withDefaultSidecarJSON), `"Connect":{"SidecarService":{"Tags":["connect-proxy"]}}`)
+	assert.Contains(t, string(nativeJSON), `"Connect":{"Native":true}`)
+	assert.NotContains(t, string(withoutConnectJSON), "Connect")
+}
+
 func Test_substituteEnvironment(t *testing.T) {
 	type args struct {
 		s    string
@@ -1218,3 +1778,18 @@ func TestTokenIsUsedToConnectToConsul(t *testing.T) {
 	// then
 	assert.Len(t, services, 0, "Reading services list without ACL token should yield empty response")
 }
+
+func TestWithTag_ShouldShareAgentsAndMaintainOnlyTaggedServices(t *testing.T) {
+	t.Parallel()
+
+	// given
+	consul := New(Config{Tag: "marathon", ConsulNameSeparator: "."})
+
+	// when
+	tagged := consul.WithTag("marathon-analytics")
+
+	// then
+	assert.Equal(t, "marathon", consul.config.Tag)
+	assert.Equal(t, "marathon-analytics", tagged.config.Tag)
+	assert.Same(t, consul.agents, tagged.agents)
+}
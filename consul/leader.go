@@ -0,0 +1,148 @@
+package consul
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/allegro/marathon-consul/metrics"
+	consulapi "github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+)
+
+const leaderLockSessionName = "marathon-consul"
+
+// Failed reads of the lock key are retried, so a single Consul hiccup does not cost the leadership.
+// Retries take less than the minimal session TTL (10s), so the lock is not believed to be held after its session expired.
+const (
+	leaderLockMonitorRetries   = 3
+	leaderLockMonitorRetryTime = 2 * time.Second
+)
+
+// LeaderLock elects a single leader among marathon-consul instances
+// by competing for a Consul KV lock held with a session.
+// It's an alternative to the Marathon leader detection, so instances can run anywhere.
+type LeaderLock struct {
+	agents        Agents
+	config        LeaderElection
+	retryInterval time.Duration
+	stateLock     sync.RWMutex
+	leader        bool
+	err           error
+	stop          chan struct{}
+	done          chan struct{}
+}
+
+func (c *Consul) NewLeaderLock() (*LeaderLock, error) {
+	if c.config.LocalAgentHost == "" {
+		return nil, errors.New("Leader election requires Consul local agent host to be configured")
+	}
+	return &LeaderLock{
+		agents:        c.agents,
+		config:        c.config.LeaderElection,
+		retryInterval: 5 * time.Second,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}, nil
+}
+
+// IsLeader reports whether this instance holds the leader lock
+func (l *LeaderLock) IsLeader() (bool, error) {
+	l.stateLock.RLock()
+	defer l.stateLock.RUnlock()
+	return l.leader, l.err
+}
+
+// Start competes for the lock in background until Stop is called.
+// Lost lock is reacquired as soon as possible.
+func (l *LeaderLock) Start() {
+	log.WithField("Key", l.config.Key).Info("Starting leader election")
+	go func() {
+		defer close(l.done)
+		for {
+			l.campaign()
+			select {
+			case <-l.stop:
+				return
+			case <-time.After(l.retryInterval):
+			}
+		}
+	}()
+}
+
+// Stop releases the lock and stops competing for it
+func (l *LeaderLock) Stop() {
+	close(l.stop)
+	<-l.done
+}
+
+func (l *LeaderLock) campaign() {
+	agent, err := l.agents.GetLocalAgent()
+	if err != nil {
+		l.setState(false, err)
+		return
+	}
+
+	lock, err := agent.Client.LockOpts(l.lockOptions())
+	if err != nil {
+		log.WithError(err).Error("Could not create leader lock")
+		l.setState(false, err)
+		return
+	}
+
+	lost, err := lock.Lock(l.stop)
+	if err != nil {
+		log.WithError(err).WithField("Key", l.config.Key).Error("Could not acquire leader lock")
+		l.setState(false, err)
+		return
+	}
+	if lost == nil {
+		// stopped while waiting for the lock
+		l.setState(false, nil)
+		return
+	}
+
+	log.WithField("Key", l.config.Key).Info("Leader lock acquired")
+	l.setState(true, nil)
+
+	select {
+	case <-lost:
+		log.WithField("Key", l.config.Key).Warn("Leader lock lost")
+		// stops renewing the session which would otherwise keep holding the key after a failed read of it
+		if err := lock.Unlock(); err != nil && err != consulapi.ErrLockNotHeld {
+			log.WithError(err).Warn("Could not release lost leader lock")
+		}
+		l.setState(false, nil)
+	case <-l.stop:
+		if err := lock.Unlock(); err != nil {
+			log.WithError(err).Error("Could not release leader lock")
+		}
+		l.setState(false, nil)
+	}
+}
+
+func (l *LeaderLock) lockOptions() *consulapi.LockOptions {
+	hostname, _ := os.Hostname()
+	return &consulapi.LockOptions{
+		Key:         l.config.Key,
+		Value:       []byte(hostname),
+		SessionName: leaderLockSessionName,
+		SessionTTL:  l.config.SessionTTL.String(),
+
+		MonitorRetries:   leaderLockMonitorRetries,
+		MonitorRetryTime: leaderLockMonitorRetryTime,
+	}
+}
+
+func (l *LeaderLock) setState(leader bool, err error) {
+	l.stateLock.Lock()
+	defer l.stateLock.Unlock()
+	l.leader = leader
+	l.err = err
+	if leader {
+		metrics.UpdateGauge("leader", int64(1))
+	} else {
+		metrics.UpdateGauge("leader", int64(0))
+	}
+}
@@ -0,0 +1,121 @@
+package consul
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	timeutil "github.com/allegro/marathon-consul/time"
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLeaderLock_ShouldRequireLocalAgent(t *testing.T) {
+	t.Parallel()
+	// given
+	consul := New(Config{})
+
+	// when
+	lock, err := consul.NewLeaderLock()
+
+	// then
+	assert.Error(t, err)
+	assert.Nil(t, lock)
+}
+
+func TestLeaderLock_OnlyOneInstanceShouldLead(t *testing.T) {
+	t.Parallel()
+	// given
+	server := CreateTestServer(t)
+	defer server.Stop()
+
+	newLock := func() *LeaderLock {
+		consul := ClientAtServer(server)
+		consul.config.LeaderElection = LeaderElection{
+			Enabled:    true,
+			Key:        fmt.Sprint("marathon-consul/leader-", time.Now().UnixNano()),
+			SessionTTL: timeutil.Interval{Duration: 10 * time.Second},
+		}
+		lock, err := consul.NewLeaderLock()
+		assert.NoError(t, err)
+		lock.retryInterval = 10 * time.Millisecond
+		return lock
+	}
+	first := newLock()
+	second := newLock()
+	second.config.Key = first.config.Key
+
+	// when
+	first.Start()
+	eventually(t, 5*time.Second, func() bool { leader, _ := first.IsLeader(); return leader })
+	second.Start()
+
+	// then
+	leader, err := second.IsLeader()
+	assert.NoError(t, err)
+	assert.False(t, leader)
+
+	// when
+	first.Stop()
+
+	// then
+	eventually(t, 20*time.Second, func() bool { leader, _ := second.IsLeader(); return leader })
+	leader, _ = first.IsLeader()
+	assert.False(t, leader)
+	second.Stop()
+}
+
+func TestLeaderLock_ShouldRegainLostLockWithNewSession(t *testing.T) {
+	t.Parallel()
+	// given
+	server := CreateTestServer(t)
+	defer server.Stop()
+	consul := ClientAtServer(server)
+	consul.config.LeaderElection = LeaderElection{
+		Enabled:    true,
+		Key:        fmt.Sprint("marathon-consul/leader-", time.Now().UnixNano()),
+		SessionTTL: timeutil.Interval{Duration: 10 * time.Second},
+	}
+	lock, err := consul.NewLeaderLock()
+	require.NoError(t, err)
+	lock.retryInterval = 10 * time.Millisecond
+	agent, err := consul.agents.GetLocalAgent()
+	require.NoError(t, err)
+	kv := agent.Client.KV()
+	lock.Start()
+	defer lock.Stop()
+	eventually(t, 5*time.Second, func() bool { leader, _ := lock.IsLeader(); return leader })
+	pair, _, err := kv.Get(lock.config.Key, nil)
+	require.NoError(t, err)
+	lostSession := pair.Session
+
+	// when
+	released, _, err := kv.Release(&consulapi.KVPair{Key: lock.config.Key, Session: lostSession}, nil)
+	require.NoError(t, err)
+	require.True(t, released)
+
+	// then
+	eventually(t, 5*time.Second, func() bool {
+		pair, _, err := kv.Get(lock.config.Key, nil)
+		return err == nil && pair != nil && pair.Session != "" && pair.Session != lostSession
+	})
+	eventually(t, 5*time.Second, func() bool { leader, _ := lock.IsLeader(); return leader })
+	eventually(t, 5*time.Second, func() bool {
+		session, _, err := agent.Client.Session().Info(lostSession, nil)
+		return err == nil && session == nil
+	})
+}
+
+// eventually waits until the condition is met, failing the test after given time.
+// assert.Eventually of the used testify version panics when the condition is still being checked on return.
+func eventually(t *testing.T, waitFor time.Duration, condition func() bool) {
+	deadline := time.After(waitFor)
+	for !condition() {
+		select {
+		case <-deadline:
+			t.Fatal("Condition never satisfied")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package consul
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/allegro/marathon-consul/apps"
+	consulAPI "github.com/hashicorp/consul/api"
+)
+
+const agentServiceRegisterEndpoint = "/v1/agent/service/register"
+
+// serviceRegistration extends registration supported by the Consul API client
+// with fields accepted by newer Consul agents
+type serviceRegistration struct {
+	*consulAPI.AgentServiceRegistration
+	Weights *serviceWeights `json:",omitempty"`
+	Checks  []*serviceCheck `json:",omitempty"`
+	// replaces Connect of the API client registration, its managed proxy was removed in Consul 1.6
+	Connect *serviceConnect `json:",omitempty"`
+	// address of the Mesos agent running the task, the service address differs from it on container networks
+	agentAddress string
+}
+
+type serviceCheck struct {
+	*consulAPI.AgentServiceCheck
+	SuccessBeforePassing   int `json:",omitempty"`
+	FailuresBeforeCritical int `json:",omitempty"`
+}
+
+type serviceWeights struct {
+	Passing int
+	Warning int
+}
+
+type serviceConnect struct {
+	Native         bool            `json:",omitempty"`
+	SidecarService *sidecarService `json:",omitempty"`
+}
+
+// sidecarService is registered by Consul agent together with the service and removed with it,
+// agent fills in its name, ID, address and the proxy destination. Agent copies tags of the service
+// to the sidecar unless they are given, so the sidecar gets its own tags to not be taken for a task service.
+type sidecarService struct {
+	Port  int           `json:",omitempty"`
+	Tags  []string      `json:",omitempty"`
+	Proxy *sidecarProxy `json:",omitempty"`
+}
+
+const (
+	sidecarProxyTag = string(consulAPI.ServiceKindConnectProxy)
+	// sidecarProxyIDSuffix is appended by Consul agent to the service ID to form the ID of its sidecar
+	sidecarProxyIDSuffix = "-sidecar-proxy"
+)
+
+// isSidecarProxy tells whether the service is a sidecar registered by Consul agent. Sidecars registered
+// before they got their own tags carry tags of their services, including the marathon-task tag.
+func isSidecarProxy(serviceID string) bool {
+	return strings.HasSuffix(serviceID, sidecarProxyIDSuffix)
+}
+
+type sidecarProxy struct {
+	Upstreams []sidecarUpstream
+}
+
+type sidecarUpstream struct {
+	DestinationName string
+	LocalBindPort   int
+}
+
+// marathonToConsulConnect maps Connect intent to a Connect-native service or a service with a sidecar proxy
+func marathonToConsulConnect(connect *apps.ConnectIntent) *serviceConnect {
+	if connect == nil {
+		return nil
+	}
+	if connect.Native {
+		return &serviceConnect{Native: true}
+	}
+	sidecar := &sidecarService{Port: connect.ProxyPort, Tags: []string{sidecarProxyTag}}
+	if len(connect.Upstreams) > 0 {
+		sidecar.Proxy = &sidecarProxy{}
+		for _, u := range connect.Upstreams {
+			sidecar.Proxy.Upstreams = append(sidecar.Proxy.Upstreams,
+				sidecarUpstream{DestinationName: u.DestinationName, LocalBindPort: u.LocalBindPort})
+		}
+	}
+	return &serviceConnect{SidecarService: sidecar}
+}
+
+func marathonToConsulWeights(weights *apps.Weights) *serviceWeights {
+	if weights == nil {
+		return nil
+	}
+	return &serviceWeights{Passing: weights.Passing, Warning: weights.Warning}
+}
+
+// minDeregisterCriticalServiceAfter is the lowest timeout honoured by Consul, critical services are reaped every 30 seconds
+const minDeregisterCriticalServiceAfter = time.Minute
+
+// withCheckOptions sets Consul check options, options set with labels take precedence over the ones
+// derived from Marathon health check grace period and thresholds, which are used only when deriveThresholds is set
+func withCheckOptions(consulCheck *consulAPI.AgentServiceCheck, task *apps.Task, check apps.HealthCheck,
+	overrides apps.CheckOverrides, deriveThresholds bool) *serviceCheck {
+	extended := &serviceCheck{AgentServiceCheck: consulCheck}
+	if deriveThresholds {
+		extended.FailuresBeforeCritical = check.MaxConsecutiveFailures
+	}
+	if overrides.GraceStatus != "" && inGracePeriod(task, check) {
+		consulCheck.Status = overrides.GraceStatus
+	}
+	if overrides.SuccessBeforePassing != nil {
+		extended.SuccessBeforePassing = *overrides.SuccessBeforePassing
+	}
+	if overrides.FailuresBeforeCritical != nil {
+		extended.FailuresBeforeCritical = *overrides.FailuresBeforeCritical
+	}
+	if overrides.DeregisterCriticalServiceAfter != nil {
+		if *overrides.DeregisterCriticalServiceAfter > 0 {
+			consulCheck.DeregisterCriticalServiceAfter = overrides.DeregisterCriticalServiceAfter.String()
+		}
+	} else if deriveThresholds && check.MaxConsecutiveFailures > 0 {
+		// Marathon kills the task once the check fails MaxConsecutiveFailures times after the grace period,
+		// if the kill is not noticed Consul removes the orphaned service one interval later
+		interval := time.Duration(check.IntervalSeconds) * time.Second
+		if interval < minDeregisterCriticalServiceAfter {
+			interval = minDeregisterCriticalServiceAfter
+		}
+		grace := time.Duration(check.GracePeriodSeconds) * time.Second
+		consulCheck.DeregisterCriticalServiceAfter = fmt.Sprintf("%ds", int((grace + interval).Seconds()))
+	}
+	return extended
+}
+
+func inGracePeriod(task *apps.Task, check apps.HealthCheck) bool {
+	if task.StartedAt.Missing() {
+		return false
+	}
+	grace := time.Duration(check.GracePeriodSeconds) * time.Second
+	return time.Since(task.StartedAt.Time) < grace
+}
+
+// registerService sends the extended registration directly to the agent endpoint,
+// the same way the Consul API client does it
+func registerService(client *consulAPI.Client, registration *serviceRegistration) error {
+	_, err := client.Raw().Write(agentServiceRegisterEndpoint, registration, nil, nil)
+	return err
+}
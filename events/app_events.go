@@ -0,0 +1,99 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/allegro/marathon-consul/apps"
+	"github.com/allegro/marathon-consul/time"
+)
+
+// AppTerminated is sent by Marathon when an app is destroyed
+type AppTerminated struct {
+	Timestamp time.Timestamp `json:"timestamp"`
+	AppID     apps.AppID     `json:"appId"`
+}
+
+// APIPost is sent by Marathon when an app definition is created or changed through the API
+type APIPost struct {
+	Timestamp     time.Timestamp `json:"timestamp"`
+	URI           string         `json:"uri"`
+	AppDefinition struct {
+		ID apps.AppID `json:"id"`
+	} `json:"appDefinition"`
+}
+
+// Deployment is sent by Marathon when a deployment succeeds or fails.
+// Its plan holds whole root groups before and after the deployment, apps changed by the deployment
+// are taken from actions of its steps.
+type Deployment struct {
+	Timestamp time.Timestamp `json:"timestamp"`
+	ID        string         `json:"id"`
+	Plan      struct {
+		Steps []struct {
+			Actions []deploymentAction `json:"actions"`
+		} `json:"steps"`
+	} `json:"plan"`
+}
+
+type deploymentAction struct {
+	Action string     `json:"action"`
+	App    apps.AppID `json:"app"`
+}
+
+// StopApplicationAction removes an app, see https://mesosphere.github.io/marathon/docs/rest-api.html
+const StopApplicationAction = "StopApplication"
+
+// TargetAppIDs returns apps started, scaled or restarted by the deployment
+func (d Deployment) TargetAppIDs() []apps.AppID {
+	return d.appIDs(func(action string) bool { return action != StopApplicationAction })
+}
+
+// RemovedAppIDs returns apps stopped by the deployment
+func (d Deployment) RemovedAppIDs() []apps.AppID {
+	return d.appIDs(func(action string) bool { return action == StopApplicationAction })
+}
+
+func (d Deployment) appIDs(matches func(action string) bool) []apps.AppID {
+	var ids []apps.AppID
+	seen := make(map[apps.AppID]struct{})
+	for _, step := range d.Plan.Steps {
+		for _, action := range step.Actions {
+			if action.App == "" || !matches(action.Action) {
+				continue
+			}
+			if _, ok := seen[action.App]; !ok {
+				seen[action.App] = struct{}{}
+				ids = append(ids, action.App)
+			}
+		}
+	}
+	return ids
+}
+
+func ParseAppTerminated(event []byte) (*AppTerminated, error) {
+	terminated := &AppTerminated{}
+	if err := json.Unmarshal(event, terminated); err != nil {
+		return nil, err
+	}
+	if terminated.AppID == "" {
+		return nil, errors.New("Missing app ID")
+	}
+	return terminated, nil
+}
+
+func ParseAPIPost(event []byte) (*APIPost, error) {
+	post := &APIPost{}
+	if err := json.Unmarshal(event, post); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+func ParseDeployment(event []byte) (*Deployment, error) {
+	deployment := &Deployment{}
+	if err := json.Unmarshal(event, deployment); err != nil {
+		return nil, err
+	}
+	return deployment, nil
+}
@@ -0,0 +1,78 @@
+package events
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/allegro/marathon-consul/apps"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAppTerminated(t *testing.T) {
+	t.Parallel()
+
+	// when
+	terminated, err := ParseAppTerminated([]byte(`{"eventType":"app_terminated_event","appId":"/my-app","timestamp":"2016-11-30T10:40:09.843Z"}`))
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, apps.AppID("/my-app"), terminated.AppID)
+}
+
+func TestParseAppTerminatedWithoutAppID(t *testing.T) {
+	t.Parallel()
+
+	// when
+	_, err := ParseAppTerminated([]byte(`{"eventType":"app_terminated_event"}`))
+
+	// then
+	assert.Error(t, err)
+}
+
+func TestParseAPIPost(t *testing.T) {
+	t.Parallel()
+
+	// when
+	post, err := ParseAPIPost([]byte(`{
+	  "eventType":"api_post_event",
+	  "uri":"/v2/apps/my-app",
+	  "appDefinition":{"id":"/my-app","labels":{"consul":""}}
+	}`))
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, apps.AppID("/my-app"), post.AppDefinition.ID)
+}
+
+func TestParseDeployment(t *testing.T) {
+	t.Parallel()
+	// given
+	body, err := ioutil.ReadFile("testdata/deployment_success.json")
+	require.NoError(t, err)
+
+	// when
+	deployment, err := ParseDeployment(body)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "867ed450-f6a8-4d33-9b0e-e11c5513990b", deployment.ID)
+	assert.Equal(t, []apps.AppID{"/test/nested/new", "/test/app"}, deployment.TargetAppIDs())
+	assert.Equal(t, []apps.AppID{"/test/removed"}, deployment.RemovedAppIDs())
+}
+
+func TestParseDeploymentWithoutSteps(t *testing.T) {
+	t.Parallel()
+
+	// when
+	deployment, err := ParseDeployment([]byte(`{
+	  "eventType":"deployment_success",
+	  "id":"867ed450-f6a8-4d33-9b0e-e11c5513990b",
+	  "plan":{"original":{"id":"/","apps":[{"id":"/app"}]},"target":{"id":"/","apps":[{"id":"/app"}]},"steps":[]}
+	}`))
+
+	// then
+	assert.NoError(t, err)
+	assert.Empty(t, deployment.TargetAppIDs())
+	assert.Empty(t, deployment.RemovedAppIDs())
+}
@@ -2,6 +2,7 @@ package events
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -12,19 +13,30 @@ import (
 	"github.com/allegro/marathon-consul/marathon"
 	"github.com/allegro/marathon-consul/metrics"
 	"github.com/allegro/marathon-consul/service"
+	"github.com/allegro/marathon-consul/utils"
 )
 
 type Event struct {
 	Timestamp time.Time
 	EventType string
 	Body      []byte
+	// Sequence number of the event read from the stream, assigned by the journal when it is enabled.
+	// Zero for events not read from the stream (e.g., resyncs)
+	Seq uint64
+	// Number of failed attempts to process the event, zero for event read from the stream
+	Attempt int
 }
 
 type EventHandler struct {
-	id              int
-	serviceRegistry service.Registry
-	marathon        marathon.Marathoner
-	eventQueue      <-chan Event
+	id                  int
+	serviceRegistry     service.Registry
+	marathon            marathon.Marathoner
+	eventQueue          <-chan Event
+	unhealthyTaskPolicy apps.UnhealthyTaskPolicy
+	journal             Journal
+	retries             Retries
+	appCache            *marathon.AppCache
+	metrics             metrics.Scope
 }
 
 type StopEvent struct{}
@@ -32,27 +44,79 @@ type StopEvent struct{}
 const (
 	StatusUpdateEventType        = "status_update_event"
 	HealthStatusChangedEventType = "health_status_changed_event"
+	AppTerminatedEventType       = "app_terminated_event"
+	DeploymentSuccessEventType   = "deployment_success"
+	DeploymentFailedEventType    = "deployment_failed"
+	APIPostEventType             = "api_post_event"
 	EmptyEventType               = ""
 )
 
-func NewEventHandler(id int, serviceRegistry service.Registry, marathon marathon.Marathoner, eventQueue <-chan Event) *EventHandler {
+// SupportedEventTypes lists Marathon events handled by EventHandler
+var SupportedEventTypes = []string{
+	StatusUpdateEventType,
+	HealthStatusChangedEventType,
+	AppTerminatedEventType,
+	DeploymentSuccessEventType,
+	DeploymentFailedEventType,
+	APIPostEventType,
+}
+
+// NewEventHandler creates a worker processing events from the queue.
+// unhealthyTaskPolicy is applied to tasks failing health checks unless app overrides it with a label.
+// Apps are not cached unless UseAppCache is called.
+func NewEventHandler(id int, serviceRegistry service.Registry, remote marathon.Marathoner, eventQueue <-chan Event,
+	unhealthyTaskPolicy apps.UnhealthyTaskPolicy) *EventHandler {
 	return &EventHandler{
-		id:              id,
-		serviceRegistry: serviceRegistry,
-		marathon:        marathon,
-		eventQueue:      eventQueue,
+		id:                  id,
+		serviceRegistry:     serviceRegistry,
+		marathon:            remote,
+		eventQueue:          eventQueue,
+		unhealthyTaskPolicy: unhealthyTaskPolicy,
+		appCache:            marathon.NewAppCache(remote, 0),
+	}
+}
+
+// UseJournal makes handler record outcome of processed events in given journal
+func (fh *EventHandler) UseJournal(journal Journal) {
+	fh.journal = journal
+}
+
+// UseAppCache makes handler take apps of task events from given cache, it may be shared by handlers of the same Marathon
+func (fh *EventHandler) UseAppCache(appCache *marathon.AppCache) {
+	fh.appCache = appCache
+}
+
+// UseMetrics makes handler metrics recorded within given scope
+func (fh *EventHandler) UseMetrics(scope metrics.Scope) {
+	fh.metrics = scope
+}
+
+// UseRetries makes handler pass failed events to given retries
+func (fh *EventHandler) UseRetries(retries Retries) {
+	fh.retries = retries
+}
+
+// Handle processes a single event, outcome is recorded in the journal when it is used
+func (fh *EventHandler) Handle(e Event) error {
+	err := fh.handleEvent(e)
+	if err != nil {
+		fh.metrics.Mark("events.processing.error")
+	} else {
+		fh.metrics.Mark("events.processing.succes")
 	}
+	if fh.journal != nil {
+		fh.journal.Processed(e, err)
+	}
+	if err != nil && fh.retries != nil {
+		fh.retries.Retry(e, err)
+	}
+	return err
 }
 
 func (fh *EventHandler) Start() chan<- StopEvent {
 	var e Event
 	process := func() {
-		err := fh.handleEvent(e.EventType, e.Body)
-		if err != nil {
-			metrics.Mark("events.processing.error")
-		} else {
-			metrics.Mark("events.processing.succes")
-		}
+		fh.Handle(e)
 	}
 
 	quitChan := make(chan StopEvent)
@@ -61,70 +125,72 @@ func (fh *EventHandler) Start() chan<- StopEvent {
 		for {
 			select {
 			case e = <-fh.eventQueue:
-				metrics.Mark(fmt.Sprintf("events.handler.%d", fh.id))
-
-				queueLength := int64(len(fh.eventQueue))
-				metrics.UpdateGauge("events.queue.len", queueLength)
-				queueCapacity := int64(cap(fh.eventQueue))
-
-				utilization := int64(0)
-				if queueCapacity > 0 {
-					utilization = 100 * (queueLength / queueCapacity)
-				}
-				metrics.UpdateGauge("events.queue.util", utilization)
-
-				metrics.UpdateGauge("events.queue.delay_ns", time.Since(e.Timestamp).Nanoseconds())
-				metrics.Time("events.processing."+e.EventType, process)
+				fh.metrics.Mark(fmt.Sprintf("events.handler.%d", fh.id))
+				fh.metrics.UpdateGauge("events.queue.delay_ns", time.Since(e.Timestamp).Nanoseconds())
+				fh.metrics.Time("events.processing."+e.EventType, process)
 			case <-quitChan:
 				log.WithField("Id", fh.id).Info("Stopping worker")
+				return
 			}
 		}
 	}()
 	return quitChan
 }
 
-func (fh *EventHandler) handleEvent(eventType string, body []byte) error {
+func (fh *EventHandler) handleEvent(e Event) error {
 
-	body = replaceTaskIDWithID(body)
+	eventType := e.EventType
+	body := replaceTaskIDWithID(e.Body)
 
 	switch eventType {
 	case StatusUpdateEventType:
 		return fh.handleStatusEvent(body)
 	case HealthStatusChangedEventType:
-		return fh.handleHealthyTask(body)
+		return fh.handleHealthyTask(body, e.Timestamp)
+	case AppTerminatedEventType:
+		return fh.handleAppTerminatedEvent(body)
+	case DeploymentSuccessEventType, DeploymentFailedEventType:
+		return fh.handleDeploymentEvent(body, eventType == DeploymentSuccessEventType)
+	case APIPostEventType:
+		return fh.handleAPIPostEvent(body)
+	case ResyncAppEventType:
+		return fh.handleResyncApp(body)
 	case EmptyEventType:
-		err := errors.New("Empty event type")
+		err := malformedEventError{errors.New("Empty event type")}
 		log.WithError(err).Warn("Event type is empty. " +
 			"This means event was not properly serialized. " +
 			"This can ocure when connection with Marathon breaks " +
 			"due to network error or Marathon restarts.")
 		return err
 	default:
-		err := fmt.Errorf("Unsuported event type: %s", eventType)
+		err := malformedEventError{fmt.Errorf("Unsuported event type: %s", eventType)}
 		log.WithError(err).WithField("EventType", eventType).Error("This should never happen. Not handled event type")
 		return err
 	}
 }
 
-func (fh *EventHandler) handleHealthyTask(body []byte) error {
+// handleHealthyTask registers or deregisters the task. Its state is taken from Marathon not earlier than the event was received.
+func (fh *EventHandler) handleHealthyTask(body []byte, received time.Time) error {
 	taskHealthChange, err := ParseTaskHealthChange(body)
 	if err != nil {
 		log.WithError(err).Error("Body generated error")
 		return err
 	}
 	delay := taskHealthChange.Timestamp.Delay()
-	metrics.UpdateGauge("events.read.delay.current", int64(delay))
+	fh.metrics.UpdateGauge("events.read.delay.current", int64(delay))
 
 	appID := taskHealthChange.AppID
 	taskID := taskHealthChange.TaskID()
 	log.WithField("Id", taskID).Info("Got HealthStatusEvent")
 
-	if !taskHealthChange.Alive {
-		log.WithField("Id", taskID).Debug("Task is not alive. Not registering")
-		return nil
+	var app *apps.App
+	var task *apps.Task
+	if taskHealthChange.Alive {
+		app, task, err = fh.appCache.AppWithTask(appID, taskID, taskHealthChange.Version, received)
+	} else {
+		// unhealthy task policy depends only on app labels, so cached definition is enough and tasks are not fetched
+		app, err = fh.appCache.App(appID, taskHealthChange.Version)
 	}
-
-	app, err := fh.marathon.App(appID)
 	if err != nil {
 		log.WithField("Id", taskID).WithError(err).Error("There was a problem obtaining app info")
 		return err
@@ -136,26 +202,52 @@ func (fh *EventHandler) handleHealthyTask(body []byte) error {
 		return nil
 	}
 
-	tasks := app.Tasks
+	policy := app.UnhealthyTaskPolicy(fh.unhealthyTaskPolicy)
+	if !taskHealthChange.Alive {
+		return fh.handleUnhealthyTask(taskID, policy)
+	}
 
-	task, found := apps.FindTaskByID(taskID, tasks)
-	if !found {
+	if task == nil {
 		log.WithField("Id", taskID).Error("Task not found")
 		return err
 	}
 
 	if task.IsHealthy() {
-		err := fh.serviceRegistry.Register(&task, app)
+		err := fh.serviceRegistry.Register(task, app)
 		if err != nil {
 			log.WithField("Id", task.ID).WithError(err).Error("There was a problem registering task")
 			return err
 		}
-		return nil
+		if policy == apps.UnhealthyTaskMaintenance {
+			err = fh.serviceRegistry.DisableMaintenanceByTask(task.ID)
+			if err != nil {
+				log.WithField("Id", task.ID).WithError(err).Error("There was a problem disabling task maintenance mode")
+			}
+		}
+		return err
 	}
 	log.WithField("Id", task.ID).Debug("Task is not healthy. Not registering")
 	return nil
 }
 
+func (fh *EventHandler) handleUnhealthyTask(taskID apps.TaskID, policy apps.UnhealthyTaskPolicy) error {
+	switch policy {
+	case apps.UnhealthyTaskDeregister:
+		log.WithField("Id", taskID).Info("Task is not alive. Deregistering")
+		return fh.deregister(taskID)
+	case apps.UnhealthyTaskMaintenance:
+		log.WithField("Id", taskID).Info("Task is not alive. Enabling maintenance mode")
+		err := fh.serviceRegistry.EnableMaintenanceByTask(taskID, "Marathon health check failed")
+		if err != nil {
+			log.WithField("Id", taskID).WithError(err).Error("There was a problem enabling task maintenance mode")
+		}
+		return err
+	default:
+		log.WithField("Id", taskID).Debug("Task is not alive. Not registering")
+		return nil
+	}
+}
+
 func (fh *EventHandler) handleStatusEvent(body []byte) error {
 	task, err := apps.ParseTask(body)
 	if err != nil {
@@ -163,7 +255,7 @@ func (fh *EventHandler) handleStatusEvent(body []byte) error {
 		return err
 	}
 	delay := task.Timestamp.Delay()
-	metrics.UpdateGauge("events.read.delay.current", int64(delay))
+	fh.metrics.UpdateGauge("events.read.delay.current", int64(delay))
 
 	log.WithFields(log.Fields{
 		"Id":         task.ID,
@@ -182,6 +274,156 @@ func (fh *EventHandler) handleStatusEvent(body []byte) error {
 	}
 }
 
+func (fh *EventHandler) handleAppTerminatedEvent(body []byte) error {
+	terminated, err := ParseAppTerminated(body)
+	if err != nil {
+		log.WithError(err).WithField("Body", body).Error("Could not parse event body")
+		return err
+	}
+	log.WithField("AppId", terminated.AppID).Info("Got AppTerminatedEvent")
+	return fh.deregisterApp(terminated.AppID)
+}
+
+func (fh *EventHandler) handleDeploymentEvent(body []byte, succeeded bool) error {
+	deployment, err := ParseDeployment(body)
+	if err != nil {
+		log.WithError(err).WithField("Body", body).Error("Could not parse event body")
+		return err
+	}
+	log.WithFields(log.Fields{
+		"Id":        deployment.ID,
+		"Succeeded": succeeded,
+	}).Info("Got DeploymentEvent")
+
+	var reconcileErrors []error
+	for _, appID := range deployment.TargetAppIDs() {
+		if err := fh.reconcileApp(appID); err != nil {
+			reconcileErrors = append(reconcileErrors, err)
+		}
+	}
+	for _, appID := range deployment.RemovedAppIDs() {
+		// Failed deployment could leave removed app in place, so check its actual state
+		reconcile := fh.reconcileApp
+		if succeeded {
+			reconcile = fh.deregisterApp
+		}
+		if err := reconcile(appID); err != nil {
+			reconcileErrors = append(reconcileErrors, err)
+		}
+	}
+	return utils.MergeErrorsOrNil(reconcileErrors, fmt.Sprintf("reconciling apps of deployment %s", deployment.ID))
+}
+
+func (fh *EventHandler) handleAPIPostEvent(body []byte) error {
+	post, err := ParseAPIPost(body)
+	if err != nil {
+		log.WithError(err).WithField("Body", body).Error("Could not parse event body")
+		return err
+	}
+	if post.AppDefinition.ID == "" {
+		log.WithField("URI", post.URI).Debug("ApiPostEvent does not concern an app")
+		return nil
+	}
+	log.WithField("AppId", post.AppDefinition.ID).Info("Got ApiPostEvent")
+	return fh.reconcileApp(post.AppDefinition.ID)
+}
+
+func (fh *EventHandler) handleResyncApp(body []byte) error {
+	resync := ResyncApp{}
+	if err := json.Unmarshal(body, &resync); err != nil {
+		log.WithError(err).WithField("Body", body).Error("Could not parse event body")
+		return err
+	}
+	log.WithField("AppId", resync.AppID).Info("Resyncing app after its events were lost")
+	fh.metrics.Mark("events.resync")
+	return fh.reconcileApp(resync.AppID)
+}
+
+// reconcileApp brings services of the app in line with its current definition in Marathon:
+// healthy tasks are (re)registered, services of tasks no longer belonging to the app
+// or of names no longer defined by its labels are deregistered. Services of app missing in Marathon are deregistered.
+// Cached app is invalidated, since reconciliation follows changes of its definition.
+func (fh *EventHandler) reconcileApp(appID apps.AppID) error {
+	fh.appCache.Invalidate(appID)
+	app, err := fh.marathon.App(appID)
+	if marathon.IsNotFound(err) {
+		log.WithField("AppId", appID).Info("App does not exist in Marathon. Deregistering its services")
+		return fh.deregisterApp(appID)
+	}
+	if err != nil {
+		log.WithField("AppId", appID).WithError(err).Error("There was a problem obtaining app info")
+		return err
+	}
+	services, err := fh.appServices(appID)
+	if err != nil {
+		return err
+	}
+	if !app.IsConsulApp() {
+		log.WithField("AppId", appID).Info("App is not a Consul app anymore. Deregistering its services")
+		return fh.deregisterServices(services, appID)
+	}
+
+	var registerErrors []error
+	intentNames := make(map[apps.TaskID]map[string]struct{})
+	for i := range app.Tasks {
+		task := &app.Tasks[i]
+		names := make(map[string]struct{})
+		for _, intent := range fh.serviceRegistry.RegistrationIntents(task, app) {
+			names[intent.Name] = struct{}{}
+		}
+		intentNames[task.ID] = names
+		if !task.IsHealthy() {
+			continue
+		}
+		if err := fh.serviceRegistry.Register(task, app); err != nil {
+			log.WithField("Id", task.ID).WithError(err).Error("There was a problem registering task")
+			registerErrors = append(registerErrors, err)
+		}
+	}
+
+	var stale []*service.Service
+	for _, s := range services {
+		taskID, _ := s.TaskID()
+		if _, ok := intentNames[taskID][s.Name]; !ok {
+			stale = append(stale, s)
+		}
+	}
+	if err := fh.deregisterServices(stale, appID); err != nil {
+		registerErrors = append(registerErrors, err)
+	}
+	return utils.MergeErrorsOrNil(registerErrors, fmt.Sprintf("reconciling app %s", appID))
+}
+
+func (fh *EventHandler) deregisterApp(appID apps.AppID) error {
+	fh.appCache.Invalidate(appID)
+	services, err := fh.appServices(appID)
+	if err != nil {
+		return err
+	}
+	return fh.deregisterServices(services, appID)
+}
+
+// appServices returns services registered for tasks of the app
+func (fh *EventHandler) appServices(appID apps.AppID) ([]*service.Service, error) {
+	services, err := fh.serviceRegistry.GetAppServices(appID)
+	if err != nil {
+		log.WithField("AppId", appID).WithError(err).Error("There was a problem obtaining services")
+		return nil, err
+	}
+	return services, nil
+}
+
+func (fh *EventHandler) deregisterServices(services []*service.Service, appID apps.AppID) error {
+	var deregisterErrors []error
+	for _, s := range services {
+		if err := fh.serviceRegistry.Deregister(s); err != nil {
+			log.WithField("Id", s.ID).WithError(err).Error("There was a problem deregistering service")
+			deregisterErrors = append(deregisterErrors, err)
+		}
+	}
+	return utils.MergeErrorsOrNil(deregisterErrors, fmt.Sprintf("deregistering services of app %s", appID))
+}
+
 func (fh *EventHandler) deregister(taskID apps.TaskID) error {
 	err := fh.serviceRegistry.DeregisterByTask(taskID)
 	if err != nil {
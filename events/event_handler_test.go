@@ -11,21 +11,28 @@ import (
 	"github.com/allegro/marathon-consul/service"
 	. "github.com/allegro/marathon-consul/utils"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type handlerStubs struct {
-	serviceRegistry service.Registry
-	marathon        marathon.Marathoner
+	serviceRegistry     service.Registry
+	marathon            marathon.Marathoner
+	unhealthyTaskPolicy apps.UnhealthyTaskPolicy
 }
 
 // Creates EventHandler and returns nonbuffered event queue that has to be used to send events to handler and
 // function that can be used as a synchronization point to wait until previous event has been processed.
-// Under the hood synchronization function simply sends a stop signal to the handlers stopChan.
+// Under the hood synchronization function simply sends a stop signal to the handlers stopChan
+// and starts the handler again, so it can be called multiple times.
 func testEventHandler(stubs handlerStubs) (chan<- Event, func()) {
 	queue := make(chan Event)
-	awaitChan := NewEventHandler(0, stubs.serviceRegistry, stubs.marathon, queue).Start()
+	handler := NewEventHandler(0, stubs.serviceRegistry, stubs.marathon, queue, stubs.unhealthyTaskPolicy)
+	awaitChan := handler.Start()
 
-	return queue, func() { awaitChan <- StopEvent{} }
+	return queue, func() {
+		awaitChan <- StopEvent{}
+		awaitChan = handler.Start()
+	}
 }
 
 func TestEventHandler_NotHandleStatusEventWithInvalidBody(t *testing.T) {
@@ -313,24 +320,74 @@ func TestEventHandler_NotHandleHealthStatusEventWhenTaskIsNotAlive(t *testing.T)
 	// given
 	app := ConsulApp("/test/app", 1)
 	marathon := marathon.MarathonerStubForApps(app)
+	serviceRegistry := consul.NewConsulStub()
+	serviceRegistry.Register(&app.Tasks[0], app)
 
-	queue, awaitFunc := testEventHandler(handlerStubs{marathon: marathon})
+	queue, awaitFunc := testEventHandler(handlerStubs{serviceRegistry: serviceRegistry, marathon: marathon, unhealthyTaskPolicy: apps.UnhealthyTaskIgnore})
 
-	body := []byte(`{
-	  "appId":"/test/app",
-	  "taskId":"test_app.1",
-	  "version":"2015-12-07T09:02:48.981Z",
-	  "alive":false,
-	  "eventType":"health_status_changed_event",
-	  "timestamp":"2015-12-07T09:33:50.069Z"
-	}`)
+	// when
+	queue <- Event{EventType: "health_status_changed_event", Timestamp: time.Now(), Body: notAliveEventForTask("test_app.0")}
+	awaitFunc()
+
+	// then
+	assert.Equal(t, []apps.TaskID{"test_app.0"}, serviceRegistry.RegisteredTaskIDs("test.app"))
+	assert.Empty(t, serviceRegistry.MaintenanceTaskIDs("test.app"))
+}
+
+func TestEventHandler_DeregisterTaskWhenNotAliveAndPolicyIsDeregister(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := ConsulApp("/test/app", 2)
+	marathon := marathon.MarathonerStubForApps(app)
+	serviceRegistry := consul.NewConsulStub()
+	serviceRegistry.Register(&app.Tasks[0], app)
+	serviceRegistry.Register(&app.Tasks[1], app)
+
+	queue, awaitFunc := testEventHandler(handlerStubs{serviceRegistry: serviceRegistry, marathon: marathon, unhealthyTaskPolicy: apps.UnhealthyTaskDeregister})
 
 	// when
-	queue <- Event{EventType: "health_status_changed_event", Timestamp: time.Now(), Body: body}
+	queue <- Event{EventType: "health_status_changed_event", Timestamp: time.Now(), Body: notAliveEventForTask("test_app.0")}
 	awaitFunc()
 
 	// then
-	assert.False(t, marathon.Interactions())
+	assert.Equal(t, []apps.TaskID{"test_app.1"}, serviceRegistry.RegisteredTaskIDs("test.app"))
+
+	// when
+	queue <- Event{EventType: "health_status_changed_event", Timestamp: time.Now(), Body: healthStatusChangeEventForTask("test_app.0")}
+	awaitFunc()
+
+	// then
+	assert.ElementsMatch(t, []apps.TaskID{"test_app.0", "test_app.1"}, serviceRegistry.RegisteredTaskIDs("test.app"))
+}
+
+func TestEventHandler_MaintenanceModeWhenNotAliveAndAppLabelSaysSo(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := ConsulApp("/test/app", 1)
+	app.Labels[apps.UnhealthyTaskPolicyLabel] = "maintenance"
+	marathon := marathon.MarathonerStubForApps(app)
+	serviceRegistry := consul.NewConsulStub()
+	serviceRegistry.Register(&app.Tasks[0], app)
+
+	queue, awaitFunc := testEventHandler(handlerStubs{serviceRegistry: serviceRegistry, marathon: marathon, unhealthyTaskPolicy: apps.UnhealthyTaskDeregister})
+
+	// when
+	queue <- Event{EventType: "health_status_changed_event", Timestamp: time.Now(), Body: notAliveEventForTask("test_app.0")}
+	awaitFunc()
+
+	// then
+	assert.Equal(t, []apps.TaskID{"test_app.0"}, serviceRegistry.RegisteredTaskIDs("test.app"))
+	assert.Equal(t, []apps.TaskID{"test_app.0"}, serviceRegistry.MaintenanceTaskIDs("test.app"))
+
+	// when
+	queue <- Event{EventType: "health_status_changed_event", Timestamp: time.Now(), Body: healthStatusChangeEventForTask("test_app.0")}
+	awaitFunc()
+
+	// then
+	assert.Equal(t, []apps.TaskID{"test_app.0"}, serviceRegistry.RegisteredTaskIDs("test.app"))
+	assert.Empty(t, serviceRegistry.MaintenanceTaskIDs("test.app"))
 }
 
 func TestEventHandler_NotHandleHealthStatusEventWhenBodyIsInvalid(t *testing.T) {
@@ -414,3 +471,354 @@ func healthStatusChangeEventForTask(taskID string) []byte {
 	  "timestamp":"2015-12-07T09:33:50.069Z"
 	}`)
 }
+
+func notAliveEventForTask(taskID string) []byte {
+	return []byte(`{
+	  "appId":"/test/app",
+	  "taskId":"` + taskID + `",
+	  "version":"2015-12-07T09:02:48.981Z",
+	  "alive":false,
+	  "eventType":"health_status_changed_event",
+	  "timestamp":"2015-12-07T09:33:50.069Z"
+	}`)
+}
+
+func TestEventHandler_ShouldStopProcessingAfterStopEvent(t *testing.T) {
+	t.Parallel()
+
+	// given
+	queue := make(chan Event, 1)
+	stopChan := NewEventHandler(0, consul.NewConsulStub(), nil, queue, apps.UnhealthyTaskIgnore).Start()
+
+	// when
+	stopChan <- StopEvent{}
+	queue <- Event{EventType: "status_update_event", Timestamp: time.Now()}
+
+	// then
+	<-time.After(20 * time.Millisecond)
+	assert.Len(t, queue, 1)
+}
+
+type journalMock struct {
+	processed []Event
+	errors    []error
+}
+
+func (j *journalMock) Received(e *Event) {}
+func (j *journalMock) Dropped(e Event)   {}
+func (j *journalMock) Processed(e Event, err error) {
+	j.processed = append(j.processed, e)
+	j.errors = append(j.errors, err)
+}
+
+func TestEventHandler_HandleShouldRecordOutcomeInJournal(t *testing.T) {
+	t.Parallel()
+
+	// given
+	journal := &journalMock{}
+	handler := NewEventHandler(0, consul.NewConsulStub(), nil, nil, apps.UnhealthyTaskIgnore)
+	handler.UseJournal(journal)
+	event := Event{EventType: "unknown_event", Timestamp: time.Now(), Seq: 7}
+
+	// when
+	err := handler.Handle(event)
+
+	// then
+	assert.EqualError(t, err, "Unsuported event type: unknown_event")
+	assert.Equal(t, []Event{event}, journal.processed)
+	assert.Equal(t, []error{err}, journal.errors)
+}
+
+type retriesMock struct {
+	retried []Event
+}
+
+func (r *retriesMock) Retry(e Event, err error) {
+	r.retried = append(r.retried, e)
+}
+
+func TestEventHandler_HandleShouldPassFailedEventToRetries(t *testing.T) {
+	t.Parallel()
+
+	// given
+	retries := &retriesMock{}
+	handler := NewEventHandler(0, consul.NewConsulStub(), marathon.MarathonerStubForApps(), nil, apps.UnhealthyTaskIgnore)
+	handler.UseRetries(retries)
+	failed := Event{EventType: HealthStatusChangedEventType, Timestamp: time.Now(),
+		Body: []byte(`{"appId":"/missing","taskId":"missing.1","alive":true}`)}
+	succeeded := Event{EventType: StatusUpdateEventType, Timestamp: time.Now(),
+		Body: []byte(`{"appId":"/missing","taskId":"missing.1","taskStatus":"TASK_RUNNING"}`)}
+
+	// when
+	failedErr := handler.Handle(failed)
+	succeededErr := handler.Handle(succeeded)
+
+	// then
+	assert.Error(t, failedErr)
+	assert.NoError(t, succeededErr)
+	assert.Equal(t, []Event{failed}, retries.retried)
+}
+
+func TestEventHandler_HandleHealthyTaskWithAppCacheAndInvalidateItOnDeployment(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := ConsulApp("/test/app", 2)
+	serviceRegistry := consul.NewConsulStub()
+	appCache := marathon.NewAppCache(marathon.MarathonerStubForApps(app), time.Minute)
+	handler := NewEventHandler(0, serviceRegistry, marathon.MarathonerStubForApps(app), nil, apps.UnhealthyTaskIgnore)
+	handler.UseAppCache(appCache)
+	received := time.Now()
+
+	// when
+	for _, task := range app.Tasks {
+		body := []byte(`{"appId":"/test/app","taskId":"` + task.ID.String() + `","alive":true}`)
+		require.NoError(t, handler.Handle(Event{EventType: HealthStatusChangedEventType, Timestamp: received, Body: body}))
+	}
+	cachedApps := appCache.Len()
+	err := handler.Handle(Event{EventType: DeploymentSuccessEventType, Timestamp: time.Now(),
+		Body: deploymentEvent(`[{"action":"RestartApplication","app":"/test/app"}]`)})
+
+	// then
+	require.NoError(t, err)
+	services, _ := serviceRegistry.GetAllServices()
+	assert.Len(t, services, 2)
+	assert.Equal(t, 1, cachedApps)
+	assert.Equal(t, 0, appCache.Len())
+}
+
+func TestEventHandler_HandleNotAliveTaskWithCachedAppWithoutAskingMarathon(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := ConsulApp("/test/app", 2)
+	app.Version = "2015-12-07T09:02:48.981Z"
+	marathoner := marathon.MarathonerStubForApps(app)
+	appCache := marathon.NewAppCache(marathoner, time.Minute)
+	handler := NewEventHandler(0, consul.NewConsulStub(), marathoner, nil, apps.UnhealthyTaskIgnore)
+	handler.UseAppCache(appCache)
+	_, _, err := appCache.AppWithTask(app.ID, app.Tasks[0].ID, "", time.Now())
+	require.NoError(t, err)
+	// any further request to Marathon fails
+	marathoner.AppStub = nil
+	marathoner.TasksStub = nil
+
+	// when
+	err = handler.Handle(Event{EventType: HealthStatusChangedEventType, Timestamp: time.Now(),
+		Body: notAliveEventForTask(app.Tasks[1].ID.String())})
+
+	// then
+	assert.NoError(t, err)
+}
+
+func TestEventHandler_HandleAppTerminatedEvent(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := ConsulApp("/test/app", 2)
+	otherApp := ConsulApp("/other/app", 1)
+	serviceRegistry := consul.NewConsulStub()
+	serviceRegistry.Register(&app.Tasks[0], app)
+	serviceRegistry.Register(&app.Tasks[1], app)
+	serviceRegistry.Register(&otherApp.Tasks[0], otherApp)
+	marathon := marathon.MarathonerStubForApps(otherApp)
+
+	queue, awaitFunc := testEventHandler(handlerStubs{serviceRegistry: serviceRegistry, marathon: marathon})
+
+	// when
+	queue <- Event{EventType: "app_terminated_event", Timestamp: time.Now(), Body: []byte(`{
+	  "eventType":"app_terminated_event",
+	  "appId":"/test/app",
+	  "timestamp":"2016-11-30T10:40:09.843Z"
+	}`)}
+	awaitFunc()
+
+	// then
+	assert.Empty(t, serviceRegistry.RegisteredTaskIDs("test.app"))
+	assert.Equal(t, []apps.TaskID{"other_app.0"}, serviceRegistry.RegisteredTaskIDs("other.app"))
+	assert.False(t, marathon.Interactions())
+}
+
+func TestEventHandler_DeploymentShouldDeregisterAppWithoutConsulLabel(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := ConsulApp("/test/app", 2)
+	serviceRegistry := consul.NewConsulStub()
+	serviceRegistry.Register(&app.Tasks[0], app)
+	serviceRegistry.Register(&app.Tasks[1], app)
+	delete(app.Labels, apps.MarathonConsulLabel)
+	marathon := marathon.MarathonerStubForApps(app)
+
+	queue, awaitFunc := testEventHandler(handlerStubs{serviceRegistry: serviceRegistry, marathon: marathon})
+
+	// when
+	queue <- Event{EventType: "deployment_success", Timestamp: time.Now(), Body: deploymentEvent(`[{"action":"RestartApplication","app":"/test/app"}]`)}
+	awaitFunc()
+
+	// then
+	assert.Empty(t, serviceRegistry.RegisteredTaskIDs("test.app"))
+}
+
+func TestEventHandler_DeploymentShouldReconcileOnlyAppsChangedByIt(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := ConsulApp("/test/app", 2)
+	rootApp := ConsulApp("/root-app", 1)
+	serviceRegistry := consul.NewConsulStub()
+	serviceRegistry.Register(&rootApp.Tasks[0], rootApp)
+	marathon := marathon.MarathonerStubForApps(app)
+
+	queue, awaitFunc := testEventHandler(handlerStubs{serviceRegistry: serviceRegistry, marathon: marathon})
+
+	// when
+	queue <- Event{EventType: "deployment_success", Timestamp: time.Now(), Body: deploymentEvent(`[{"action":"ScaleApplication","app":"/test/app"}]`)}
+	awaitFunc()
+
+	// then
+	assert.ElementsMatch(t, []apps.TaskID{"test_app.0", "test_app.1"}, serviceRegistry.RegisteredTaskIDs("test.app"))
+	assert.Equal(t, []apps.TaskID{"root-app.0"}, serviceRegistry.RegisteredTaskIDs("root-app"))
+}
+
+func TestEventHandler_DeploymentShouldNotDeregisterSidecarProxyOfConnectApp(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := ConsulApp("/test/app", 1)
+	app.Labels["consul-connect"] = "proxy"
+	serviceRegistry := consul.NewConsulStub()
+	serviceRegistry.Register(&app.Tasks[0], app)
+	marathon := marathon.MarathonerStubForApps(app)
+
+	queue, awaitFunc := testEventHandler(handlerStubs{serviceRegistry: serviceRegistry, marathon: marathon})
+
+	// when
+	queue <- Event{EventType: "deployment_success", Timestamp: time.Now(), Body: deploymentEvent(`[{"action":"ScaleApplication","app":"/test/app"}]`)}
+	awaitFunc()
+
+	// then
+	assert.Equal(t, []apps.TaskID{"test_app.0"}, serviceRegistry.RegisteredTaskIDs("test.app"))
+	assert.Len(t, serviceRegistry.SidecarProxyIDs(), 1)
+}
+
+func TestEventHandler_DeploymentShouldDeregisterRemovedApp(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := ConsulApp("/test/app", 1)
+	serviceRegistry := consul.NewConsulStub()
+	serviceRegistry.Register(&app.Tasks[0], app)
+	marathon := marathon.MarathonerStubForApps()
+
+	queue, awaitFunc := testEventHandler(handlerStubs{serviceRegistry: serviceRegistry, marathon: marathon})
+
+	// when
+	queue <- Event{EventType: "deployment_success", Timestamp: time.Now(), Body: deploymentEvent(`[{"action":"StopApplication","app":"/test/app"}]`)}
+	awaitFunc()
+
+	// then
+	assert.Empty(t, serviceRegistry.RegisteredTaskIDs("test.app"))
+}
+
+func TestEventHandler_FailedDeploymentShouldNotDeregisterAppStillInMarathon(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := ConsulApp("/test/app", 1)
+	serviceRegistry := consul.NewConsulStub()
+	serviceRegistry.Register(&app.Tasks[0], app)
+	marathon := marathon.MarathonerStubForApps(app)
+
+	queue, awaitFunc := testEventHandler(handlerStubs{serviceRegistry: serviceRegistry, marathon: marathon})
+
+	// when
+	queue <- Event{EventType: "deployment_failed", Timestamp: time.Now(), Body: deploymentEvent(`[{"action":"StopApplication","app":"/test/app"}]`)}
+	awaitFunc()
+
+	// then
+	assert.Equal(t, []apps.TaskID{"test_app.0"}, serviceRegistry.RegisteredTaskIDs("test.app"))
+}
+
+func TestEventHandler_ResyncAppShouldRegisterHealthyAndDeregisterDeadTasks(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := ConsulApp("/test/app", 3)
+	serviceRegistry := consul.NewConsulStub()
+	serviceRegistry.Register(&app.Tasks[0], app)
+	serviceRegistry.Register(&app.Tasks[2], app)
+	app.Tasks = app.Tasks[:2]
+	marathon := marathon.MarathonerStubForApps(app)
+
+	queue, awaitFunc := testEventHandler(handlerStubs{serviceRegistry: serviceRegistry, marathon: marathon})
+
+	// when
+	queue <- NewResyncAppEvent("/test/app")
+	awaitFunc()
+
+	// then
+	assert.ElementsMatch(t, []apps.TaskID{"test_app.0", "test_app.1"}, serviceRegistry.RegisteredTaskIDs("test.app"))
+}
+
+func TestEventHandler_ResyncAppShouldDeregisterAppMissingInMarathon(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := ConsulApp("/test/app", 1)
+	serviceRegistry := consul.NewConsulStub()
+	serviceRegistry.Register(&app.Tasks[0], app)
+	marathon := marathon.MarathonerStubForApps()
+
+	queue, awaitFunc := testEventHandler(handlerStubs{serviceRegistry: serviceRegistry, marathon: marathon})
+
+	// when
+	queue <- NewResyncAppEvent("/test/app")
+	awaitFunc()
+
+	// then
+	assert.Empty(t, serviceRegistry.RegisteredTaskIDs("test.app"))
+}
+
+func TestEventHandler_APIPostShouldReregisterAppUnderNewName(t *testing.T) {
+	t.Parallel()
+
+	// given
+	app := ConsulApp("/test/app", 2)
+	app.Tasks[1].HealthCheckResults = nil
+	serviceRegistry := consul.NewConsulStub()
+	serviceRegistry.Register(&app.Tasks[0], app)
+	serviceRegistry.Register(&app.Tasks[1], app)
+	app.Labels[apps.MarathonConsulLabel] = "renamed"
+	marathon := marathon.MarathonerStubForApps(app)
+
+	queue, awaitFunc := testEventHandler(handlerStubs{serviceRegistry: serviceRegistry, marathon: marathon})
+
+	// when
+	queue <- Event{EventType: "api_post_event", Timestamp: time.Now(), Body: []byte(`{
+	  "eventType":"api_post_event",
+	  "uri":"/v2/apps/test/app",
+	  "appDefinition":{"id":"/test/app","labels":{"consul":"renamed"}}
+	}`)}
+	awaitFunc()
+
+	// then
+	assert.Empty(t, serviceRegistry.RegisteredTaskIDs("test.app"))
+	assert.Equal(t, []apps.TaskID{"test_app.0"}, serviceRegistry.RegisteredTaskIDs("renamed"))
+}
+
+// deploymentEvent returns deployment event shaped as sent by Marathon: plan holds whole root groups
+// with apps nested in groups, apps changed by the deployment are listed in actions of its steps
+func deploymentEvent(actions string) []byte {
+	return []byte(`{
+	  "eventType":"deployment_success",
+	  "id":"867ed450-f6a8-4d33-9b0e-e11c5513990b",
+	  "timestamp":"2016-11-30T10:40:09.843Z",
+	  "plan":{
+	    "id":"867ed450-f6a8-4d33-9b0e-e11c5513990b",
+	    "original":{"id":"/","apps":[{"id":"/root-app"}],"groups":[{"id":"/test","apps":[{"id":"/test/app"}],"groups":[]}]},
+	    "target":{"id":"/","apps":[{"id":"/root-app"}],"groups":[{"id":"/test","apps":[{"id":"/test/app"}],"groups":[]}]},
+	    "steps":[{"actions":` + actions + `}]
+	  }
+	}`)
+}
@@ -0,0 +1,11 @@
+package events
+
+// Journal records events read from the Marathon event stream and outcome of their processing
+type Journal interface {
+	// Received records the event and sets its sequence number used to match the outcome
+	Received(e *Event)
+	// Dropped records the event was not processed, e.g., because the events queue was full
+	Dropped(e Event)
+	// Processed records the event was handled with given result
+	Processed(e Event, err error)
+}
@@ -0,0 +1,104 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/allegro/marathon-consul/apps"
+)
+
+// ResyncAppEventType is not sent by Marathon, it is queued to bring services of an app
+// in line with Marathon after its events were lost
+const ResyncAppEventType = "resync_app"
+
+// ResyncApp is the body of resync app event
+type ResyncApp struct {
+	AppID apps.AppID `json:"appId"`
+}
+
+// NewResyncAppEvent creates event making handler reconcile services of given app
+func NewResyncAppEvent(appID apps.AppID) Event {
+	body, _ := json.Marshal(ResyncApp{AppID: appID})
+	return Event{Timestamp: time.Now(), EventType: ResyncAppEventType, Body: body}
+}
+
+// eventSubject holds fields identifying app and task an event concerns
+type eventSubject struct {
+	AppID      apps.AppID  `json:"appId"`
+	TaskID     apps.TaskID `json:"taskId"`
+	InstanceID string      `json:"instanceId"`
+}
+
+// AffectedAppIDs returns apps whose services may be changed by the event, nil when body can't be parsed
+func AffectedAppIDs(e Event) []apps.AppID {
+	switch e.EventType {
+	case DeploymentSuccessEventType, DeploymentFailedEventType:
+		deployment, err := ParseDeployment(e.Body)
+		if err != nil {
+			return nil
+		}
+		return append(deployment.TargetAppIDs(), deployment.RemovedAppIDs()...)
+	case APIPostEventType:
+		post, err := ParseAPIPost(e.Body)
+		if err != nil || post.AppDefinition.ID == "" {
+			return nil
+		}
+		return []apps.AppID{post.AppDefinition.ID}
+	default:
+		subject := eventSubject{}
+		if err := json.Unmarshal(e.Body, &subject); err != nil || subject.AppID == "" {
+			return nil
+		}
+		return []apps.AppID{subject.AppID}
+	}
+}
+
+// CoalesceKey identifies events of which only the latest one matters, e.g., status updates of a single task.
+// Empty key means the event can't be replaced by a later one.
+func CoalesceKey(e Event) string {
+	switch e.EventType {
+	case StatusUpdateEventType, HealthStatusChangedEventType:
+		task := taskOf(e)
+		if task == "" {
+			return ""
+		}
+		return e.EventType + "|" + task
+	case AppTerminatedEventType, ResyncAppEventType:
+		subject := eventSubject{}
+		if err := json.Unmarshal(e.Body, &subject); err != nil || subject.AppID == "" {
+			return ""
+		}
+		return e.EventType + "|" + subject.AppID.String()
+	default:
+		return ""
+	}
+}
+
+// SupersedeKey identifies events of which a later one makes retrying an earlier one pointless.
+// Any later status update or health change of a task supersedes both kinds of events of the task,
+// e.g., retrying a failed health change after the task was killed could register it again.
+// Empty key means the event is not superseded by a later one.
+func SupersedeKey(e Event) string {
+	switch e.EventType {
+	case StatusUpdateEventType, HealthStatusChangedEventType:
+		task := taskOf(e)
+		if task == "" {
+			return ""
+		}
+		return "task|" + task
+	default:
+		return CoalesceKey(e)
+	}
+}
+
+// taskOf returns ID of the task (or instance) the event concerns, empty when it can't be parsed
+func taskOf(e Event) string {
+	subject := eventSubject{}
+	if err := json.Unmarshal(e.Body, &subject); err != nil || subject.AppID == "" {
+		return ""
+	}
+	if subject.TaskID != "" {
+		return string(subject.TaskID)
+	}
+	return subject.InstanceID
+}
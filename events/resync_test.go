@@ -0,0 +1,71 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/allegro/marathon-consul/apps"
+	"github.com/stretchr/testify/assert"
+)
+
+var affectedAppIDsTestsData = []struct {
+	event    Event
+	expected []apps.AppID
+}{
+	{Event{EventType: StatusUpdateEventType, Body: []byte(`{"appId":"/app","taskId":"app.1"}`)}, []apps.AppID{"/app"}},
+	{Event{EventType: HealthStatusChangedEventType, Body: []byte(`{"appId":"/app","instanceId":"app.marathon-1"}`)}, []apps.AppID{"/app"}},
+	{Event{EventType: AppTerminatedEventType, Body: []byte(`{"appId":"/app"}`)}, []apps.AppID{"/app"}},
+	{Event{EventType: APIPostEventType, Body: []byte(`{"appDefinition":{"id":"/app"}}`)}, []apps.AppID{"/app"}},
+	{Event{EventType: APIPostEventType, Body: []byte(`{"uri":"/v2/groups"}`)}, nil},
+	{Event{EventType: DeploymentSuccessEventType, Body: deploymentEvent(`[{"action":"StopApplication","app":"/removed"},{"action":"ScaleApplication","app":"/kept"},{"action":"StartApplication","app":"/new"}]`)},
+		[]apps.AppID{"/kept", "/new", "/removed"}},
+	{Event{EventType: StatusUpdateEventType, Body: []byte(`{"appId":`)}, nil},
+	{Event{EventType: EmptyEventType}, nil},
+}
+
+func TestAffectedAppIDs(t *testing.T) {
+	t.Parallel()
+	for _, testCase := range affectedAppIDsTestsData {
+		// expect
+		assert.Equal(t, testCase.expected, AffectedAppIDs(testCase.event), string(testCase.event.Body))
+	}
+}
+
+var coalesceKeyTestsData = []struct {
+	event    Event
+	expected string
+}{
+	{Event{EventType: StatusUpdateEventType, Body: []byte(`{"appId":"/app","taskId":"app.1"}`)}, "status_update_event|app.1"},
+	{Event{EventType: HealthStatusChangedEventType, Body: []byte(`{"appId":"/app","instanceId":"app.marathon-1"}`)}, "health_status_changed_event|app.marathon-1"},
+	{Event{EventType: StatusUpdateEventType, Body: []byte(`{"appId":"/app"}`)}, ""},
+	{Event{EventType: AppTerminatedEventType, Body: []byte(`{"appId":"/app"}`)}, "app_terminated_event|/app"},
+	{NewResyncAppEvent("/app"), "resync_app|/app"},
+	{Event{EventType: APIPostEventType, Body: []byte(`{"appDefinition":{"id":"/app"}}`)}, ""},
+}
+
+func TestCoalesceKey(t *testing.T) {
+	t.Parallel()
+	for _, testCase := range coalesceKeyTestsData {
+		// expect
+		assert.Equal(t, testCase.expected, CoalesceKey(testCase.event), string(testCase.event.Body))
+	}
+}
+
+var supersedeKeyTestsData = []struct {
+	event    Event
+	expected string
+}{
+	{Event{EventType: StatusUpdateEventType, Body: []byte(`{"appId":"/app","taskId":"app.1"}`)}, "task|app.1"},
+	{Event{EventType: HealthStatusChangedEventType, Body: []byte(`{"appId":"/app","taskId":"app.1"}`)}, "task|app.1"},
+	{Event{EventType: HealthStatusChangedEventType, Body: []byte(`{"appId":"/app","instanceId":"app.marathon-1"}`)}, "task|app.marathon-1"},
+	{Event{EventType: StatusUpdateEventType, Body: []byte(`{"appId":"/app"}`)}, ""},
+	{Event{EventType: AppTerminatedEventType, Body: []byte(`{"appId":"/app"}`)}, AppTerminatedEventType + "|/app"},
+	{Event{EventType: APIPostEventType, Body: []byte(`{"appDefinition":{"id":"/app"}}`)}, ""},
+}
+
+func TestSupersedeKey(t *testing.T) {
+	t.Parallel()
+	for _, testCase := range supersedeKeyTestsData {
+		// expect
+		assert.Equal(t, testCase.expected, SupersedeKey(testCase.event), string(testCase.event.Body))
+	}
+}
@@ -0,0 +1,29 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Retries schedule failed events to be processed again
+type Retries interface {
+	// Retry is called with the event that failed with given error, it must not block
+	Retry(e Event, err error)
+}
+
+// malformedEventError marks errors caused by the event itself, processing such event again won't help
+type malformedEventError struct {
+	error
+}
+
+func (e malformedEventError) Unwrap() error {
+	return e.error
+}
+
+// Retriable tells if processing the event again may succeed, i.e., the error was not caused by a malformed event
+func Retriable(err error) bool {
+	var malformed malformedEventError
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	return err != nil && !errors.As(err, &malformed) && !errors.As(err, &syntaxError) && !errors.As(err, &typeError)
+}
@@ -0,0 +1,26 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetriable(t *testing.T) {
+	t.Parallel()
+	// given
+	handler := NewEventHandler(0, nil, nil, nil, "")
+	_, syntaxErr := ParseTaskHealthChange([]byte("{"))
+	_, typeErr := ParseTaskHealthChange([]byte(`{"alive":"yes"}`))
+
+	// expect
+	assert.True(t, Retriable(errors.New("Consul agent unavailable")))
+	assert.True(t, Retriable(fmt.Errorf("reconciling app /app: %w", errors.New("timeout"))))
+	assert.False(t, Retriable(nil))
+	assert.False(t, Retriable(syntaxErr))
+	assert.False(t, Retriable(typeErr))
+	assert.False(t, Retriable(handler.handleEvent(Event{EventType: EmptyEventType})))
+	assert.False(t, Retriable(handler.handleEvent(Event{EventType: "unknown_event"})))
+}
@@ -5,6 +5,8 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strconv"
+	"time"
 )
 
 // Event holds state of parsed fields from marathon EventStream
@@ -76,7 +78,6 @@ func (e *SSEEvent) parseLine(line []byte) bool {
 		e.ID = stringValue
 	case "retry":
 		e.Delay = stringValue
-		// TODO consider reconnection delay
 	}
 
 	return false
@@ -86,6 +87,19 @@ func (e *SSEEvent) isEmpty() bool {
 	return e.Type == "" && e.Body == nil && e.ID == ""
 }
 
+// RetryDelay returns reconnection time sent by the server with the retry field.
+// Second value is false when the field is missing or is not a number of milliseconds.
+func (e *SSEEvent) RetryDelay() (time.Duration, bool) {
+	if e.Delay == "" {
+		return 0, false
+	}
+	millis, err := strconv.ParseUint(e.Delay, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(millis) * time.Millisecond, true
+}
+
 func (e *SSEEvent) String() string {
 	return fmt.Sprintf("Type: %s, Body: %s", e.Type, string(e.Body))
 }
@@ -95,6 +109,9 @@ func ParseSSEEvent(scanner *bufio.Scanner) (SSEEvent, error) {
 
 	for dispatch := false; !dispatch; {
 		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return e, err
+			}
 			return e, io.EOF
 		}
 		line := scanner.Bytes()
@@ -113,7 +130,7 @@ func ScanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
 		return 0, nil, nil
 	}
 	pos := lineTerminatorPosition(data)
-	if pos != 0 {
+	if pos >= 0 {
 		return pos + 1, dropCR(data[0:pos]), nil
 	}
 	// If we're at EOF, we have a final, non-terminated line. Return it.
@@ -124,6 +141,7 @@ func ScanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	return 0, nil, nil
 }
 
+// lineTerminatorPosition returns position of the first line terminator, -1 when there is none
 func lineTerminatorPosition(data []byte) int {
 	// https://www.w3.org/TR/2011/WD-eventsource-20110208/
 	// Quote: Lines must be separated by either a U+000D CARRIAGE RETURN U+000A
@@ -136,7 +154,7 @@ func lineTerminatorPosition(data []byte) int {
 		// We have a full CR terminated line
 		return i
 	}
-	return 0
+	return -1
 }
 
 // dropCR drops a terminal \r from the data.
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -242,6 +243,18 @@ func TestParseSSEEvent_WhenVeryLongLineIsLongerThanMaxLineSize(t *testing.T) {
 	assert.Equal(t, expectedEventType, event.Type)
 }
 
+func TestParseSSEEvent_ShouldReturnErrorWhenLineIsLongerThanMaxLineSize(t *testing.T) {
+	t.Parallel()
+	// given
+	veryLongLine := fmt.Sprintf("event: deployment_success\ndata: %s\n\n", strings.Repeat("a", 10240))
+	sscanner := bufio.NewScanner(strings.NewReader(veryLongLine))
+	sscanner.Buffer(make([]byte, 1024), 4096)
+	// when
+	_, err := ParseSSEEvent(sscanner)
+	// then
+	assert.Equal(t, bufio.ErrTooLong, err)
+}
+
 var scanLineCases = []struct {
 	in              []byte
 	atEOL           bool
@@ -254,6 +267,7 @@ var scanLineCases = []struct {
 	{[]byte("abcd"), false, 0, []byte(nil)},
 	{[]byte("abcd"), true, 4, []byte("abcd")},
 	{[]byte("abcd\n"), true, 5, []byte("abcd")},
+	{[]byte("\nevent: abcd\n"), false, 1, []byte("")},
 }
 
 func TestScanLine_TestCases(t *testing.T) {
@@ -267,3 +281,30 @@ func TestScanLine_TestCases(t *testing.T) {
 		assert.Equal(t, testCase.expectedToken, token)
 	}
 }
+
+var retryDelayTestsData = []struct {
+	delay    string
+	expected time.Duration
+	ok       bool
+}{
+	{"", 0, false},
+	{"1500", 1500 * time.Millisecond, true},
+	{"0", 0, true},
+	{"-10", 0, false},
+	{"1s", 0, false},
+}
+
+func TestSSEEvent_RetryDelay(t *testing.T) {
+	t.Parallel()
+	for _, testCase := range retryDelayTestsData {
+		// given
+		e := SSEEvent{Delay: testCase.delay}
+
+		// when
+		delay, ok := e.RetryDelay()
+
+		// then
+		assert.Equal(t, testCase.expected, delay, testCase.delay)
+		assert.Equal(t, testCase.ok, ok, testCase.delay)
+	}
+}
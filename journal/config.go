@@ -0,0 +1,13 @@
+package journal
+
+import "github.com/allegro/marathon-consul/time"
+
+type Config struct {
+	File string
+	// Size in megabytes after which the file is rotated, 0 disables size rotation
+	MaxSize int64
+	// Age after which the file is rotated, 0 disables age rotation
+	MaxAge time.Interval
+	// Number of rotated files to keep, 0 keeps all of them
+	MaxBackups int
+}
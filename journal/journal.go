@@ -0,0 +1,293 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allegro/marathon-consul/events"
+	"github.com/allegro/marathon-consul/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// Kinds of journal entries
+const (
+	KindReceived  = "received"
+	KindDropped   = "dropped"
+	KindProcessed = "processed"
+)
+
+// Outcomes of processed events
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+const rotatedSuffixLayout = "2006-01-02T15-04-05.000"
+
+// Entry is a single line of the journal file.
+// Received entries hold the event, the following dropped or processed entry with the same Seq holds its fate.
+type Entry struct {
+	Time      time.Time `json:"time"`
+	Seq       uint64    `json:"seq"`
+	Source    string    `json:"source,omitempty"`
+	Kind      string    `json:"kind"`
+	EventType string    `json:"eventType,omitempty"`
+	Body      string    `json:"body,omitempty"`
+	Outcome   string    `json:"outcome,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Journal appends received Marathon events and outcome of their processing to a file.
+// Writing errors are logged and never stop event processing.
+type Journal struct {
+	config   Config
+	lock     sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	seq      uint64
+	now      func() time.Time
+}
+
+func New(config Config) (*Journal, error) {
+	j := &Journal{config: config, now: time.Now}
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	// Seq continues after restart so entries appended to the same file never share it
+	seq, err := j.lastSeq()
+	if err != nil {
+		log.WithError(err).WithField("File", config.File).Warn("Could not read last Seq from events journal, starting from 1")
+	}
+	j.seq = seq
+	log.WithField("File", config.File).Info("Events journal enabled")
+	return j, nil
+}
+
+// ForSource returns journal marking entries with given Marathon source name
+func (j *Journal) ForSource(name string) events.Journal {
+	return sourceJournal{journal: j, source: name}
+}
+
+func (j *Journal) Received(e *events.Event) {
+	sourceJournal{journal: j}.Received(e)
+}
+
+func (j *Journal) Dropped(e events.Event) {
+	sourceJournal{journal: j}.Dropped(e)
+}
+
+func (j *Journal) Processed(e events.Event, err error) {
+	sourceJournal{journal: j}.Processed(e, err)
+}
+
+// Close closes the journal file, entries written afterwards are lost
+func (j *Journal) Close() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+func (j *Journal) nextSeq() uint64 {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.seq++
+	return j.seq
+}
+
+func (j *Journal) write(entry Entry) {
+	if entry.Time.IsZero() {
+		entry.Time = j.now()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		j.markError(err)
+		return
+	}
+	line = append(line, '\n')
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.file == nil {
+		return
+	}
+	if j.shouldRotate(int64(len(line))) {
+		if err := j.rotate(); err != nil {
+			j.markError(err)
+			if j.file == nil {
+				return
+			}
+		}
+	}
+	n, err := j.file.Write(line)
+	j.size += int64(n)
+	if err != nil {
+		j.markError(err)
+	}
+}
+
+func (j *Journal) markError(err error) {
+	metrics.Mark("journal.error")
+	log.WithError(err).WithField("File", j.config.File).Warn("Could not write events journal")
+}
+
+func (j *Journal) shouldRotate(lineSize int64) bool {
+	if j.size == 0 {
+		return false
+	}
+	if maxSize := j.config.MaxSize * 1024 * 1024; maxSize > 0 && j.size+lineSize > maxSize {
+		return true
+	}
+	return j.config.MaxAge.Duration > 0 && j.now().Sub(j.openedAt) >= j.config.MaxAge.Duration
+}
+
+func (j *Journal) open() error {
+	file, err := os.OpenFile(j.config.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("Could not open events journal: %s", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("Could not open events journal: %s", err)
+	}
+	j.file = file
+	j.size = info.Size()
+	j.openedAt = j.now()
+	return nil
+}
+
+// rotate renames the current file with time suffix, opens a new one and removes the oldest rotated files
+func (j *Journal) rotate() error {
+	if err := j.file.Close(); err != nil {
+		log.WithError(err).Warn("Could not close events journal")
+	}
+	j.file = nil
+	rotated := j.config.File + "." + j.now().Format(rotatedSuffixLayout)
+	if err := os.Rename(j.config.File, rotated); err != nil {
+		log.WithError(err).Warn("Could not rotate events journal, appending to the current file")
+	}
+	if err := j.open(); err != nil {
+		return err
+	}
+	metrics.Mark("journal.rotate")
+	log.WithField("File", rotated).Info("Events journal rotated")
+	return j.removeOldBackups()
+}
+
+func (j *Journal) removeOldBackups() error {
+	if j.config.MaxBackups <= 0 {
+		return nil
+	}
+	backups, err := j.backups()
+	if err != nil {
+		return err
+	}
+	for len(backups) > j.config.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// backups returns files rotated from the journal file, from the oldest one.
+// Other files sharing the journal file prefix (e.g. events.log.bak) are not considered backups.
+func (j *Journal) backups() ([]string, error) {
+	matches, err := filepath.Glob(j.config.File + ".*")
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, match := range matches {
+		suffix := strings.TrimPrefix(match, j.config.File+".")
+		if _, err := time.Parse(rotatedSuffixLayout, suffix); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	// time suffix sorts rotated files from the oldest one
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// lastSeq returns the highest Seq written to the journal file or, when it's empty, to the newest backup
+func (j *Journal) lastSeq() (uint64, error) {
+	backups, err := j.backups()
+	if err != nil {
+		return 0, err
+	}
+	files := []string{j.config.File}
+	for i := len(backups) - 1; i >= 0; i-- {
+		files = append(files, backups[i])
+	}
+	for _, file := range files {
+		seq, found, err := readLastSeq(file)
+		if err != nil || found {
+			return seq, err
+		}
+	}
+	return 0, nil
+}
+
+func readLastSeq(path string) (uint64, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, false, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxEntrySize)
+	var seq uint64
+	found := false
+	for scanner.Scan() {
+		var entry struct {
+			Seq uint64 `json:"seq"`
+		}
+		// line cut by a crash is not a reason to reuse Seq, skip it
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		found = true
+		if entry.Seq > seq {
+			seq = entry.Seq
+		}
+	}
+	return seq, found, scanner.Err()
+}
+
+type sourceJournal struct {
+	journal *Journal
+	source  string
+}
+
+func (s sourceJournal) Received(e *events.Event) {
+	e.Seq = s.journal.nextSeq()
+	s.journal.write(Entry{Time: e.Timestamp, Seq: e.Seq, Source: s.source, Kind: KindReceived,
+		EventType: e.EventType, Body: string(e.Body)})
+}
+
+func (s sourceJournal) Dropped(e events.Event) {
+	s.journal.write(Entry{Seq: e.Seq, Source: s.source, Kind: KindDropped, EventType: e.EventType})
+}
+
+func (s sourceJournal) Processed(e events.Event, err error) {
+	entry := Entry{Seq: e.Seq, Source: s.source, Kind: KindProcessed, EventType: e.EventType, Outcome: OutcomeSuccess}
+	if err != nil {
+		entry.Outcome = OutcomeError
+		entry.Error = err.Error()
+	}
+	s.journal.write(entry)
+}
@@ -0,0 +1,206 @@
+package journal
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/allegro/marathon-consul/events"
+	timeutil "github.com/allegro/marathon-consul/time"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal_ShouldRecordEventsAndOutcomes(t *testing.T) {
+	t.Parallel()
+	// given
+	file := filepath.Join(t.TempDir(), "events.log")
+	journal, err := New(Config{File: file})
+	require.NoError(t, err)
+	receivedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	first := events.Event{Timestamp: receivedAt, EventType: "status_update_event", Body: []byte(`{"a":1}`)}
+	second := events.Event{Timestamp: receivedAt, EventType: "app_terminated_event", Body: []byte(`{"b":`)}
+	third := events.Event{Timestamp: receivedAt, EventType: "deployment_success"}
+
+	// when
+	journal.Received(&first)
+	journal.ForSource("analytics").Received(&second)
+	journal.Received(&third)
+	journal.Processed(first, nil)
+	journal.ForSource("analytics").Processed(second, errors.New("failed"))
+	journal.Dropped(third)
+	require.NoError(t, journal.Close())
+
+	// then
+	assert.Equal(t, uint64(1), first.Seq)
+	assert.Equal(t, uint64(2), second.Seq)
+	assert.Equal(t, uint64(3), third.Seq)
+	entries := readEntries(t, file)
+	require.Len(t, entries, 6)
+	assert.Equal(t, Entry{Time: receivedAt, Seq: 1, Kind: KindReceived, EventType: "status_update_event", Body: `{"a":1}`}, entries[0])
+	assert.Equal(t, Entry{Time: receivedAt, Seq: 2, Source: "analytics", Kind: KindReceived, EventType: "app_terminated_event", Body: `{"b":`}, entries[1])
+	assert.Equal(t, KindProcessed, entries[3].Kind)
+	assert.Equal(t, OutcomeSuccess, entries[3].Outcome)
+	assert.Equal(t, uint64(2), entries[4].Seq)
+	assert.Equal(t, "analytics", entries[4].Source)
+	assert.Equal(t, OutcomeError, entries[4].Outcome)
+	assert.Equal(t, "failed", entries[4].Error)
+	assert.Equal(t, KindDropped, entries[5].Kind)
+	assert.Equal(t, uint64(3), entries[5].Seq)
+}
+
+func TestJournal_ShouldAppendToExistingFile(t *testing.T) {
+	t.Parallel()
+	// given
+	file := filepath.Join(t.TempDir(), "events.log")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`{"seq":1,"kind":"received"}`+"\n"), 0644))
+	journal, err := New(Config{File: file})
+	require.NoError(t, err)
+
+	// when
+	journal.Dropped(events.Event{Seq: 1})
+	require.NoError(t, journal.Close())
+
+	// then
+	assert.Len(t, readEntries(t, file), 2)
+}
+
+func TestJournal_ShouldContinueSeqOfExistingFile(t *testing.T) {
+	t.Parallel()
+	// given
+	file := filepath.Join(t.TempDir(), "events.log")
+	require.NoError(t, ioutil.WriteFile(file, []byte(
+		`{"seq":6,"kind":"received"}`+"\n"+
+			`{"seq":7,"kind":"received"}`+"\n"+
+			`{"seq":6,"kind":"processed"}`+"\n"+
+			`{"seq":8,"ki`), 0644))
+	journal, err := New(Config{File: file})
+	require.NoError(t, err)
+	event := events.Event{}
+
+	// when
+	journal.Received(&event)
+	require.NoError(t, journal.Close())
+
+	// then
+	assert.Equal(t, uint64(8), event.Seq)
+}
+
+func TestJournal_ShouldContinueSeqOfNewestBackupWhenFileIsEmpty(t *testing.T) {
+	t.Parallel()
+	// given
+	file := filepath.Join(t.TempDir(), "events.log")
+	require.NoError(t, ioutil.WriteFile(file+".2020-01-02T03-04-05.000", []byte(`{"seq":3,"kind":"received"}`+"\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(file+".2020-01-02T03-04-06.000", []byte(`{"seq":5,"kind":"received"}`+"\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(file+".bak", []byte(`{"seq":100,"kind":"received"}`+"\n"), 0644))
+	journal, err := New(Config{File: file})
+	require.NoError(t, err)
+	event := events.Event{}
+
+	// when
+	journal.Received(&event)
+	require.NoError(t, journal.Close())
+
+	// then
+	assert.Equal(t, uint64(6), event.Seq)
+}
+
+func TestJournal_ShouldRotateBySize(t *testing.T) {
+	t.Parallel()
+	// given
+	dir := t.TempDir()
+	file := filepath.Join(dir, "events.log")
+	journal, err := New(Config{File: file, MaxSize: 1, MaxBackups: 2})
+	require.NoError(t, err)
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	journal.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	body := []byte(strings.Repeat("x", 600*1024))
+
+	// when
+	for i := 0; i < 4; i++ {
+		journal.Received(&events.Event{Timestamp: now, Body: body})
+	}
+	require.NoError(t, journal.Close())
+
+	// then
+	backups, _ := filepath.Glob(file + ".*")
+	assert.Len(t, backups, 2)
+	assert.Len(t, readEntries(t, file), 1)
+	assert.Equal(t, uint64(4), readEntries(t, file)[0].Seq)
+	assert.Equal(t, uint64(3), readEntries(t, backups[1])[0].Seq)
+}
+
+func TestJournal_ShouldRotateByAge(t *testing.T) {
+	t.Parallel()
+	// given
+	file := filepath.Join(t.TempDir(), "events.log")
+	journal, err := New(Config{File: file, MaxAge: timeutil.Interval{Duration: time.Hour}})
+	require.NoError(t, err)
+	now := time.Now()
+	journal.now = func() time.Time { return now }
+
+	// when
+	journal.Dropped(events.Event{Seq: 1})
+	now = now.Add(time.Hour)
+	journal.Dropped(events.Event{Seq: 2})
+	require.NoError(t, journal.Close())
+
+	// then
+	backups, _ := filepath.Glob(file + ".*")
+	require.Len(t, backups, 1)
+	assert.Equal(t, uint64(1), readEntries(t, backups[0])[0].Seq)
+	assert.Equal(t, uint64(2), readEntries(t, file)[0].Seq)
+}
+
+func TestJournal_ShouldRemoveOnlyRotatedFiles(t *testing.T) {
+	t.Parallel()
+	// given
+	file := filepath.Join(t.TempDir(), "events.log")
+	unrelated := []string{file + ".bak", file + ".2020-01-02", file + ".old.2020-01-02T03-04-05.000"}
+	for _, path := range unrelated {
+		require.NoError(t, ioutil.WriteFile(path, []byte("keep\n"), 0644))
+	}
+	journal, err := New(Config{File: file, MaxAge: timeutil.Interval{Duration: time.Hour}, MaxBackups: 1})
+	require.NoError(t, err)
+	now := time.Now()
+	journal.now = func() time.Time { return now }
+
+	// when
+	for i := 0; i < 3; i++ {
+		journal.Dropped(events.Event{Seq: uint64(i)})
+		now = now.Add(time.Hour)
+	}
+	require.NoError(t, journal.Close())
+
+	// then
+	for _, path := range unrelated {
+		assert.FileExists(t, path)
+	}
+	backups, _ := journal.backups()
+	assert.Equal(t, []string{file + "." + now.Add(-time.Hour).Format(rotatedSuffixLayout)}, backups)
+}
+
+func TestJournal_NewShouldFailWhenFileCanNotBeOpened(t *testing.T) {
+	t.Parallel()
+	// when
+	_, err := New(Config{File: filepath.Join(t.TempDir(), "missing", "events.log")})
+
+	// then
+	assert.Error(t, err)
+}
+
+func readEntries(t *testing.T, path string) []Entry {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	entries, err := ReadEntries(file)
+	require.NoError(t, err)
+	return entries
+}
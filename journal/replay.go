@@ -0,0 +1,69 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/allegro/marathon-consul/events"
+	log "github.com/sirupsen/logrus"
+)
+
+// Journal lines hold whole event bodies, so they may be much longer than default scanner limit
+const maxEntrySize = 64 * 1024 * 1024
+
+// ReplayResult holds statistics of a journal replay
+type ReplayResult struct {
+	Replayed int `json:"replayed"`
+	Failed   int `json:"failed"`
+}
+
+// ReadEntries parses entries written to the journal
+func ReadEntries(r io.Reader) ([]Entry, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxEntrySize)
+	var entries []Entry
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("Invalid journal entry in line %d: %s", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Replay passes events received from given Marathon source (empty for the main one)
+// to the handler in the order they were read from the stream, including the dropped ones.
+func Replay(path string, source string, handle func(events.Event) error) (ReplayResult, error) {
+	result := ReplayResult{}
+	file, err := os.Open(path)
+	if err != nil {
+		return result, err
+	}
+	defer file.Close()
+	entries, err := ReadEntries(file)
+	if err != nil {
+		return result, err
+	}
+
+	for _, entry := range entries {
+		if entry.Kind != KindReceived || entry.Source != source {
+			continue
+		}
+		logger := log.WithFields(log.Fields{"Seq": entry.Seq, "EventType": entry.EventType, "ReceivedAt": entry.Time})
+		logger.Info("Replaying event")
+		result.Replayed++
+		event := events.Event{Timestamp: entry.Time, EventType: entry.EventType, Body: []byte(entry.Body), Seq: entry.Seq}
+		if err := handle(event); err != nil {
+			logger.WithError(err).Warn("Replayed event failed")
+			result.Failed++
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,62 @@
+package journal
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/allegro/marathon-consul/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadEntries_ShouldReportInvalidLine(t *testing.T) {
+	t.Parallel()
+	// when
+	_, err := ReadEntries(strings.NewReader(`{"seq":1,"kind":"received"}` + "\n\nnot json\n"))
+
+	// then
+	assert.EqualError(t, err, "Invalid journal entry in line 3: invalid character 'o' in literal null (expecting 'u')")
+}
+
+func TestReplay_ShouldPassReceivedEventsOfSourceInOrder(t *testing.T) {
+	t.Parallel()
+	// given
+	file := filepath.Join(t.TempDir(), "events.log")
+	require.NoError(t, ioutil.WriteFile(file, []byte(strings.Join([]string{
+		`{"seq":1,"kind":"received","eventType":"status_update_event","body":"{}"}`,
+		`{"seq":2,"source":"other","kind":"received","eventType":"status_update_event","body":"{}"}`,
+		`{"seq":1,"kind":"processed","eventType":"status_update_event","outcome":"success"}`,
+		`{"seq":3,"kind":"received","eventType":"app_terminated_event","body":"{\"appId\":\"/app\"}"}`,
+		`{"seq":3,"kind":"dropped","eventType":"app_terminated_event"}`,
+	}, "\n")), 0644))
+	var replayed []events.Event
+
+	// when
+	result, err := Replay(file, "", func(e events.Event) error {
+		replayed = append(replayed, e)
+		if e.Seq == 3 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	// then
+	require.NoError(t, err)
+	assert.Equal(t, ReplayResult{Replayed: 2, Failed: 1}, result)
+	require.Len(t, replayed, 2)
+	assert.Equal(t, uint64(1), replayed[0].Seq)
+	assert.Equal(t, "app_terminated_event", replayed[1].EventType)
+	assert.Equal(t, []byte(`{"appId":"/app"}`), replayed[1].Body)
+}
+
+func TestReplay_ShouldFailWhenFileIsMissing(t *testing.T) {
+	t.Parallel()
+	// when
+	_, err := Replay(filepath.Join(t.TempDir(), "missing.log"), "", nil)
+
+	// then
+	assert.Error(t, err)
+}
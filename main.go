@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"os/signal"
+	"syscall"
 
+	"github.com/allegro/marathon-consul/apps"
 	"github.com/allegro/marathon-consul/config"
 	"github.com/allegro/marathon-consul/consul"
+	"github.com/allegro/marathon-consul/journal"
 	"github.com/allegro/marathon-consul/marathon"
 	"github.com/allegro/marathon-consul/metrics"
 	"github.com/allegro/marathon-consul/sentry"
 	"github.com/allegro/marathon-consul/sse"
-	"github.com/allegro/marathon-consul/sync"
+	"github.com/allegro/marathon-consul/utils"
 	"github.com/allegro/marathon-consul/web"
 	log "github.com/sirupsen/logrus"
 )
@@ -19,6 +24,9 @@ var VERSION string
 func main() {
 	log.WithField("Version", VERSION).Info("Starting marathon-consul")
 
+	ctx, stopNotify := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopNotify()
+
 	config, err := config.New()
 	if err != nil {
 		log.Fatal(err.Error())
@@ -34,27 +42,129 @@ func main() {
 		log.Fatal(err.Error())
 	}
 
+	unhealthyTaskPolicy, err := apps.ParseUnhealthyTaskPolicy(config.Web.UnhealthyTaskPolicy)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	config.Web.UnhealthyTaskPolicy = string(unhealthyTaskPolicy)
+
+	overflowPolicy, err := sse.ParseOverflowPolicy(config.Web.QueueOverflowPolicy)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	if overflowPolicy == sse.OverflowSpill && config.Web.QueueSpillFile == "" {
+		log.Fatalf("events-queue-spill-file is required by %s overflow policy", sse.OverflowSpill)
+	}
+	config.Web.QueueOverflowPolicy = string(overflowPolicy)
+
+	addressFamily, err := utils.ParseAddressFamily(config.Consul.AddressFamily)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	config.Consul.AddressFamily = string(addressFamily)
+
+	if _, err := apps.ParseNameTemplate(config.Consul.NameTemplate); err != nil {
+		log.Fatalf("Invalid consul-name-template: %s", err)
+	}
+	if _, err := apps.ParseTagTemplates(config.Consul.GlobalTags); err != nil {
+		log.Fatalf("Invalid consul-global-tags: %s", err)
+	}
+
 	consulInstance := consul.New(config.Consul)
+	switch command, args := config.Command(); command {
+	case "":
+	case "replay":
+		if err := replay(config, consulInstance, args); err != nil {
+			log.Fatal(err.Error())
+		}
+		return
+	default:
+		log.Fatalf("Unknown command %q, expected: replay", command)
+	}
+
+	var eventsJournal *journal.Journal
+	if config.Journal.File != "" {
+		eventsJournal, err = journal.New(config.Journal)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+
+	var leaderLock *consul.LeaderLock
+	var elector marathon.LeaderElector
+	if config.Consul.LeaderElection.Enabled {
+		leaderLock, err = consulInstance.NewLeaderLock()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		leaderLock.Start()
+		elector = leaderLock
+	}
+
 	// TODO(tz) - move Leader from sync module to highest level config, access like config.Leader
-	remote, err := marathon.New(config.Marathon)
+	sources, err := newSources(config, consulInstance, elector, eventsJournal)
 	if err != nil {
 		log.Fatal(err.Error())
 	}
+	mainSource := sources[0]
+	for _, s := range sources {
+		s.start(ctx)
+	}
 
-	sync.New(config.Sync, remote, consulInstance, consulInstance.AddAgentsFromApps).StartSyncServicesJob()
+	if config.Web.Health.Readiness {
+		var checks []web.HealthCheck
+		for _, s := range sources {
+			checks = append(checks, s.healthChecks(config.Web.Health)...)
+		}
+		http.HandleFunc("/health", web.NewReadinessHandler(checks...))
+	} else {
+		http.HandleFunc("/health", web.HealthHandler)
+	}
+	mainSource.handle("")
+	for _, s := range sources[1:] {
+		s.handle("/sources/" + s.name)
+	}
+	http.HandleFunc("/status", web.NewStatusHandler(map[string]web.StatusProvider{
+		"leader": func() interface{} { return marathon.GetLeaderStatus(mainSource.marathon) },
+		"sse":    func() interface{} { return mainSource.sse.Status() },
+		"agents": func() interface{} { return consulInstance.AgentsStatus() },
+		"sync":   func() interface{} { return mainSource.sync.Status() },
+		"sources": func() interface{} {
+			status := make(map[string]interface{}, len(sources)-1)
+			for _, s := range sources[1:] {
+				status[s.name] = s.status()
+			}
+			return status
+		},
+	}))
+	if config.Metrics.Target == "prometheus" {
+		http.HandleFunc(config.Metrics.PrometheusPath, metrics.PrometheusHandler)
+	}
 
-	//TODO: Use context instead of stop function.
-	var stopSSE sse.Stop
+	server := &http.Server{Addr: config.Web.Listen}
 	go func() {
-		stopSSE, err = sse.NewHandler(config.SSE, config.Web, remote, consulInstance)
-		if err != nil {
-			log.WithError(err).Fatal("Cannot instantiate SSE handler")
+		log.WithField("Port", config.Web.Listen).Info("Listening")
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
 		}
 	}()
-	defer stopSSE()
 
-	http.HandleFunc("/health", web.HealthHandler)
+	<-ctx.Done()
+	log.WithField("Timeout", config.Web.ShutdownTimeout).Info("Shutting down marathon-consul")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.Web.ShutdownTimeout.Duration)
+	defer cancel()
 
-	log.WithField("Port", config.Web.Listen).Info("Listening")
-	log.Fatal(http.ListenAndServe(config.Web.Listen, nil))
+	stopSources(shutdownCtx, sources)
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.WithError(err).Error("Could not shut down web server gracefully")
+	}
+	if leaderLock != nil {
+		leaderLock.Stop()
+	}
+	if eventsJournal != nil {
+		if err := eventsJournal.Close(); err != nil {
+			log.WithError(err).Error("Could not close events journal")
+		}
+	}
+	log.Info("Marathon-consul stopped")
 }
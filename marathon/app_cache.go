@@ -0,0 +1,147 @@
+package marathon
+
+import (
+	"sync"
+	"time"
+
+	"github.com/allegro/marathon-consul/apps"
+	"github.com/allegro/marathon-consul/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// AppCache keeps app definitions and snapshots of app tasks, so handling a task event does not need to ask Marathon
+// for the whole app every time. Definition is fetched again when it expires, is invalidated (e.g., by a deployment)
+// or a newer version of the app is requested. Marathon does not return a single task, so tasks of the app
+// are fetched without its definition and the snapshot is reused by all events received before it was fetched.
+type AppCache struct {
+	marathon Marathoner
+	ttl      time.Duration
+	now      func() time.Time
+	metrics  metrics.Scope
+
+	lock sync.Mutex
+	apps map[apps.AppID]*cachedApp
+	// invalidations counts Invalidate calls, so app fetched before invalidation is not cached
+	invalidations uint64
+}
+
+// cachedApp is never modified, it is replaced with a new one instead
+type cachedApp struct {
+	definition   *apps.App
+	fetched      time.Time
+	tasks        []apps.Task
+	tasksFetched time.Time
+}
+
+// NewAppCache creates cache of apps of given Marathon, non-positive ttl disables caching
+func NewAppCache(marathon Marathoner, ttl time.Duration) *AppCache {
+	return &AppCache{
+		marathon: marathon,
+		ttl:      ttl,
+		now:      time.Now,
+		apps:     make(map[apps.AppID]*cachedApp),
+	}
+}
+
+// AppWithTask returns definition (without tasks) of the app in at least given version and its task in the state
+// known to Marathon not earlier than given time. Task is nil when it does not belong to the app.
+func (c *AppCache) AppWithTask(appID apps.AppID, taskID apps.TaskID, version string, since time.Time) (*apps.App, *apps.Task, error) {
+	now := c.now()
+	cached, invalidations := c.get(appID)
+	switch {
+	case c.isOutdated(cached, version, now):
+		fetched, err := c.fetch(appID, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		cached = fetched
+	case cached.tasksFetched.Before(since):
+		tasks, err := c.marathon.Tasks(appID)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.metrics.Mark("marathon.app_cache.tasks_miss")
+		cached = &cachedApp{definition: cached.definition, fetched: cached.fetched, tasks: tasks, tasksFetched: now}
+	default:
+		c.metrics.Mark("marathon.app_cache.hit")
+	}
+	c.put(appID, cached, invalidations)
+
+	task, found := apps.FindTaskByID(taskID, cached.tasks)
+	if !found {
+		return cached.definition, nil, nil
+	}
+	return cached.definition, &task, nil
+}
+
+// App returns definition (without tasks) of the app in at least given version. Tasks are not fetched
+// when cached definition is fresh, so it suits events which do not depend on the task state.
+func (c *AppCache) App(appID apps.AppID, version string) (*apps.App, error) {
+	now := c.now()
+	cached, invalidations := c.get(appID)
+	if !c.isOutdated(cached, version, now) {
+		c.metrics.Mark("marathon.app_cache.hit")
+		return cached.definition, nil
+	}
+	cached, err := c.fetch(appID, now)
+	if err != nil {
+		return nil, err
+	}
+	c.put(appID, cached, invalidations)
+	return cached.definition, nil
+}
+
+// UseMetrics makes cache hits and misses recorded within given scope
+func (c *AppCache) UseMetrics(scope metrics.Scope) {
+	c.metrics = scope
+}
+
+// Invalidate makes the app fetched again on the next use
+func (c *AppCache) Invalidate(appID apps.AppID) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.invalidations++
+	if _, ok := c.apps[appID]; ok {
+		log.WithField("AppId", appID).Debug("Invalidating cached app")
+		delete(c.apps, appID)
+	}
+}
+
+// Len returns number of cached apps
+func (c *AppCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.apps)
+}
+
+func (c *AppCache) isOutdated(cached *cachedApp, version string, now time.Time) bool {
+	return cached == nil || now.Sub(cached.fetched) >= c.ttl || version > cached.definition.Version
+}
+
+func (c *AppCache) fetch(appID apps.AppID, now time.Time) (*cachedApp, error) {
+	app, err := c.marathon.App(appID)
+	if err != nil {
+		return nil, err
+	}
+	c.metrics.Mark("marathon.app_cache.miss")
+	definition := *app
+	definition.Tasks = nil
+	return &cachedApp{definition: &definition, fetched: now, tasks: app.Tasks, tasksFetched: now}, nil
+}
+
+func (c *AppCache) get(appID apps.AppID) (*cachedApp, uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.apps[appID], c.invalidations
+}
+
+func (c *AppCache) put(appID apps.AppID, cached *cachedApp, invalidations uint64) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.invalidations == invalidations {
+		c.apps[appID] = cached
+	}
+}
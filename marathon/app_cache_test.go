@@ -0,0 +1,223 @@
+package marathon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/allegro/marathon-consul/apps"
+	"github.com/allegro/marathon-consul/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingMarathoner struct {
+	*MarathonerStub
+	appCalls   int
+	tasksCalls int
+}
+
+func (m *countingMarathoner) App(id apps.AppID) (*apps.App, error) {
+	m.appCalls++
+	return m.MarathonerStub.App(id)
+}
+
+func (m *countingMarathoner) Tasks(id apps.AppID) ([]apps.Task, error) {
+	m.tasksCalls++
+	return m.MarathonerStub.Tasks(id)
+}
+
+func newTestAppCache(ttl time.Duration, app *apps.App) (*AppCache, *countingMarathoner, *time.Time) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	marathon := &countingMarathoner{MarathonerStub: MarathonerStubForApps(app)}
+	cache := NewAppCache(marathon, ttl)
+	cache.now = func() time.Time { return now }
+	return cache, marathon, &now
+}
+
+func TestAppCache_ShouldReturnDefinitionWithoutTasksAndTheTask(t *testing.T) {
+	t.Parallel()
+	// given
+	cache, marathon, now := newTestAppCache(time.Minute, utils.ConsulApp("/app", 2))
+
+	// when
+	app, task, err := cache.AppWithTask("/app", "app.1", "", now.Add(-time.Second))
+
+	// then
+	require.NoError(t, err)
+	assert.Equal(t, apps.AppID("/app"), app.ID)
+	assert.Empty(t, app.Tasks)
+	require.NotNil(t, task)
+	assert.Equal(t, apps.TaskID("app.1"), task.ID)
+	assert.Equal(t, 1, marathon.appCalls)
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestAppCache_ShouldReuseTasksFetchedAfterEventWasReceived(t *testing.T) {
+	t.Parallel()
+	// given
+	cache, marathon, now := newTestAppCache(time.Minute, utils.ConsulApp("/app", 2))
+	received := now.Add(-time.Second)
+	_, _, err := cache.AppWithTask("/app", "app.0", "", received)
+	require.NoError(t, err)
+
+	// when
+	_, task, err := cache.AppWithTask("/app", "app.1", "", received)
+
+	// then
+	require.NoError(t, err)
+	assert.Equal(t, apps.TaskID("app.1"), task.ID)
+	assert.Equal(t, 1, marathon.appCalls)
+	assert.Equal(t, 0, marathon.tasksCalls)
+}
+
+func TestAppCache_ShouldFetchOnlyTasksForEventReceivedAfterSnapshot(t *testing.T) {
+	t.Parallel()
+	// given
+	cache, marathon, now := newTestAppCache(time.Minute, utils.ConsulApp("/app", 2))
+	_, _, err := cache.AppWithTask("/app", "app.0", "", now.Add(-time.Second))
+	require.NoError(t, err)
+	*now = now.Add(10 * time.Second)
+
+	// when
+	_, task, err := cache.AppWithTask("/app", "app.1", "", now.Add(-time.Second))
+
+	// then
+	require.NoError(t, err)
+	assert.Equal(t, apps.TaskID("app.1"), task.ID)
+	assert.Equal(t, 1, marathon.appCalls)
+	assert.Equal(t, 1, marathon.tasksCalls)
+}
+
+var appCacheRefetchTestsData = []struct {
+	name    string
+	elapsed time.Duration
+	version string
+	refetch bool
+}{
+	{"fresh", 10 * time.Second, "", false},
+	{"expired", time.Minute, "", true},
+	{"older version", 10 * time.Second, "2026-10-16T12:00:00.000Z", false},
+	{"newer version", 10 * time.Second, "2026-10-18T12:00:00.000Z", true},
+}
+
+func TestAppCache_ShouldFetchDefinitionAgainWhenExpiredOrOutdated(t *testing.T) {
+	t.Parallel()
+	for _, testCase := range appCacheRefetchTestsData {
+		// given
+		app := utils.ConsulApp("/app", 1)
+		app.Version = "2026-10-17T12:00:00.000Z"
+		cache, marathon, now := newTestAppCache(time.Minute, app)
+		_, _, err := cache.AppWithTask("/app", "app.0", "", now.Add(-time.Second))
+		require.NoError(t, err)
+		*now = now.Add(testCase.elapsed)
+
+		// when
+		_, _, err = cache.AppWithTask("/app", "app.0", testCase.version, now.Add(-time.Minute))
+
+		// then
+		require.NoError(t, err)
+		expectedCalls := 1
+		if testCase.refetch {
+			expectedCalls = 2
+		}
+		assert.Equal(t, expectedCalls, marathon.appCalls, testCase.name)
+	}
+}
+
+func TestAppCache_AppShouldReturnCachedDefinitionWithoutFetchingTasks(t *testing.T) {
+	t.Parallel()
+	// given
+	cache, marathon, now := newTestAppCache(time.Minute, utils.ConsulApp("/app", 2))
+	_, _, err := cache.AppWithTask("/app", "app.0", "", now.Add(-time.Second))
+	require.NoError(t, err)
+	*now = now.Add(10 * time.Second)
+
+	// when
+	app, err := cache.App("/app", "")
+
+	// then
+	require.NoError(t, err)
+	assert.Equal(t, apps.AppID("/app"), app.ID)
+	assert.Empty(t, app.Tasks)
+	assert.Equal(t, 1, marathon.appCalls)
+	assert.Equal(t, 0, marathon.tasksCalls)
+}
+
+func TestAppCache_AppShouldFetchAndCacheDefinitionWhenMissing(t *testing.T) {
+	t.Parallel()
+	// given
+	cache, marathon, now := newTestAppCache(time.Minute, utils.ConsulApp("/app", 2))
+
+	// when
+	_, err := cache.App("/app", "")
+	require.NoError(t, err)
+	_, task, err := cache.AppWithTask("/app", "app.1", "", now.Add(-time.Second))
+
+	// then
+	require.NoError(t, err)
+	assert.Equal(t, apps.TaskID("app.1"), task.ID)
+	assert.Equal(t, 1, marathon.appCalls)
+	assert.Equal(t, 0, marathon.tasksCalls)
+}
+
+func TestAppCache_InvalidateShouldMakeDefinitionFetchedAgain(t *testing.T) {
+	t.Parallel()
+	// given
+	cache, marathon, now := newTestAppCache(time.Minute, utils.ConsulApp("/app", 1))
+	_, _, err := cache.AppWithTask("/app", "app.0", "", now.Add(-time.Second))
+	require.NoError(t, err)
+
+	// when
+	cache.Invalidate("/app")
+	_, _, err = cache.AppWithTask("/app", "app.0", "", now.Add(-time.Second))
+
+	// then
+	require.NoError(t, err)
+	assert.Equal(t, 2, marathon.appCalls)
+}
+
+func TestAppCache_ShouldNotCacheWhenDisabled(t *testing.T) {
+	t.Parallel()
+	// given
+	cache, marathon, now := newTestAppCache(0, utils.ConsulApp("/app", 1))
+
+	// when
+	for i := 0; i < 2; i++ {
+		_, _, err := cache.AppWithTask("/app", "app.0", "", now.Add(-time.Second))
+		require.NoError(t, err)
+	}
+
+	// then
+	assert.Equal(t, 2, marathon.appCalls)
+	assert.Equal(t, 0, marathon.tasksCalls)
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestAppCache_ShouldReturnNilTaskWhenItDoesNotBelongToApp(t *testing.T) {
+	t.Parallel()
+	// given
+	cache, _, now := newTestAppCache(time.Minute, utils.ConsulApp("/app", 1))
+
+	// when
+	app, task, err := cache.AppWithTask("/app", "app.7", "", now.Add(-time.Second))
+
+	// then
+	require.NoError(t, err)
+	assert.NotNil(t, app)
+	assert.Nil(t, task)
+}
+
+func TestAppCache_ShouldReturnErrorWhenAppCanNotBeFetched(t *testing.T) {
+	t.Parallel()
+	// given
+	cache, _, now := newTestAppCache(time.Minute, utils.ConsulApp("/app", 1))
+
+	// when
+	app, task, err := cache.AppWithTask("/missing", "missing.0", "", now.Add(-time.Second))
+
+	// then
+	assert.True(t, IsNotFound(err))
+	assert.Nil(t, app)
+	assert.Nil(t, task)
+	assert.Equal(t, 0, cache.Len())
+}
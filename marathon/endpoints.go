@@ -0,0 +1,124 @@
+package marathon
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/allegro/marathon-consul/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+var errNoLocations = errors.New("No Marathon location configured")
+
+// endpoints holds locations of Marathon masters and remembers the one that should be asked first.
+// Location is preferred after it has answered successfully or when it is reported as the Marathon leader.
+type endpoints struct {
+	protocol  string
+	locations []string
+	metrics   metrics.Scope
+
+	lock      sync.RWMutex
+	preferred int
+}
+
+// newEndpoints creates endpoints from comma separated list of locations
+func newEndpoints(protocol, locations string) *endpoints {
+	e := &endpoints{protocol: protocol}
+	for _, location := range strings.Split(locations, ",") {
+		if location = strings.TrimSpace(location); location != "" {
+			e.locations = append(e.locations, location)
+		}
+	}
+	return e
+}
+
+// ordered returns all locations starting with the preferred one
+func (e *endpoints) ordered() []string {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	ordered := make([]string, 0, len(e.locations))
+	for i := range e.locations {
+		ordered = append(ordered, e.locations[(e.preferred+i)%len(e.locations)])
+	}
+	return ordered
+}
+
+// current returns the preferred location or empty string when there are no locations
+func (e *endpoints) current() string {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	if len(e.locations) == 0 {
+		return ""
+	}
+	return e.locations[e.preferred]
+}
+
+func (e *endpoints) prefer(location string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for i, l := range e.locations {
+		if l == location && i != e.preferred {
+			log.WithField("Location", location).Info("Switching to Marathon location")
+			e.metrics.Mark("marathon.failover")
+			e.preferred = i
+			return
+		}
+	}
+}
+
+// preferLeader makes location of given leader (host:port as returned by /v2/leader) the preferred one
+func (e *endpoints) preferLeader(leader string) {
+	for _, location := range e.ordered() {
+		if locationHost(location) == leader {
+			e.prefer(location)
+			return
+		}
+	}
+}
+
+// markError counts failed request to given location
+func (e *endpoints) markError(location string) {
+	e.metrics.Mark("marathon.endpoint." + metricName(location) + ".error")
+}
+
+// url returns absolute path to marathon endpoint
+// if location is given with path e.g. "localhost:8080/proxy/url", then
+// host and path parts are appended to respective url.URL fields
+func (e *endpoints) url(location string, path string, params params) string {
+	var marathon url.URL
+	if strings.Contains(location, "/") {
+		parts := strings.SplitN(location, "/", 2)
+		marathon = url.URL{
+			Scheme: e.protocol,
+			Host:   parts[0],
+			Path:   "/" + parts[1] + path,
+		}
+	} else {
+		marathon = url.URL{
+			Scheme: e.protocol,
+			Host:   location,
+			Path:   path,
+		}
+	}
+
+	query := marathon.Query()
+	for key, values := range params {
+		for _, value := range values {
+			query.Add(key, value)
+		}
+	}
+	marathon.RawQuery = query.Encode()
+	return marathon.String()
+}
+
+func locationHost(location string) string {
+	return strings.SplitN(location, "/", 2)[0]
+}
+
+var metricNameReplacer = strings.NewReplacer(".", "_", ":", "_", "/", "_")
+
+func metricName(location string) string {
+	return strings.ToLower(metricNameReplacer.Replace(location))
+}
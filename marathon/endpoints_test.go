@@ -0,0 +1,75 @@
+package marathon
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewEndpoints_ShouldSplitAndTrimLocations(t *testing.T) {
+	t.Parallel()
+
+	// when
+	e := newEndpoints("http", " marathon1:8080, ,marathon2:8080/proxy,")
+
+	// then
+	assert.Equal(t, []string{"marathon1:8080", "marathon2:8080/proxy"}, e.ordered())
+	assert.Equal(t, "marathon1:8080", e.current())
+}
+
+func TestEndpoints_OrderedShouldStartWithPreferredLocation(t *testing.T) {
+	t.Parallel()
+
+	// given
+	e := newEndpoints("http", "m1:8080,m2:8080,m3:8080")
+
+	// when
+	e.prefer("m2:8080")
+
+	// then
+	assert.Equal(t, []string{"m2:8080", "m3:8080", "m1:8080"}, e.ordered())
+	assert.Equal(t, "m2:8080", e.current())
+}
+
+func TestEndpoints_PreferShouldIgnoreUnknownLocation(t *testing.T) {
+	t.Parallel()
+
+	// given
+	e := newEndpoints("http", "m1:8080,m2:8080")
+
+	// when
+	e.prefer("m3:8080")
+
+	// then
+	assert.Equal(t, []string{"m1:8080", "m2:8080"}, e.ordered())
+}
+
+func TestEndpoints_PreferLeaderShouldMatchLocationHost(t *testing.T) {
+	t.Parallel()
+
+	// given
+	e := newEndpoints("http", "m1:8080/proxy,m2:8080/proxy")
+
+	// when
+	e.preferLeader("m2:8080")
+
+	// then
+	assert.Equal(t, "m2:8080/proxy", e.current())
+}
+
+func TestEndpoints_NoLocations(t *testing.T) {
+	t.Parallel()
+
+	// when
+	e := newEndpoints("http", "")
+
+	// then
+	assert.Empty(t, e.ordered())
+	assert.Equal(t, "", e.current())
+}
+
+func TestMetricName(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "marathon_example_com_8080_proxy", metricName("Marathon.example.com:8080/proxy"))
+}
@@ -26,18 +26,40 @@ type Marathoner interface {
 }
 
 type Marathon struct {
-	Location string
-	Protocol string
-	MyLeader string
-	username string
-	password string
-	client   *http.Client
+	Location  string
+	Protocol  string
+	MyLeader  string
+	username  string
+	password  string
+	client    *http.Client
+	elector   LeaderElector
+	endpoints *endpoints
+	metrics   metrics.Scope
+}
+
+// LeaderElector decides about leadership of this instance independently of Marathon leader
+type LeaderElector interface {
+	IsLeader() (bool, error)
 }
 
 type LeaderResponse struct {
 	Leader string `json:"leader"`
 }
 
+// LeaderStatus describes whether this instance acts as the Marathon leader
+type LeaderStatus struct {
+	Leader bool   `json:"leader"`
+	Error  string `json:"error,omitempty"`
+}
+
+func GetLeaderStatus(m Marathoner) LeaderStatus {
+	leading, err := m.IsLeader()
+	if err != nil {
+		return LeaderStatus{Leader: leading, Error: err.Error()}
+	}
+	return LeaderStatus{Leader: leading}
+}
+
 func New(config Config) (*Marathon, error) {
 	transport := &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
@@ -56,13 +78,14 @@ func New(config Config) (*Marathon, error) {
 			Transport: transport,
 			Timeout:   config.Timeout.Duration,
 		},
+		endpoints: newEndpoints(config.Protocol, config.Location),
 	}, nil
 }
 
 func (m Marathon) App(appID apps.AppID) (*apps.App, error) {
 	log.WithField("Location", m.Location).Debug("Asking Marathon for " + appID)
 
-	body, err := m.get(m.urlWithQuery(fmt.Sprintf("/v2/apps/%s", appID), params{"embed": []string{"apps.tasks"}}))
+	body, err := m.fetch(fmt.Sprintf("/v2/apps/%s", appID), params{"embed": []string{"apps.tasks"}})
 	if err != nil {
 		return nil, err
 	}
@@ -72,7 +95,7 @@ func (m Marathon) App(appID apps.AppID) (*apps.App, error) {
 
 func (m Marathon) ConsulApps() ([]*apps.App, error) {
 	log.WithField("Location", m.Location).Debug("Asking Marathon for apps")
-	body, err := m.get(m.urlWithQuery("/v2/apps", params{"embed": []string{"apps.tasks"}, "label": []string{apps.MarathonConsulLabel}}))
+	body, err := m.fetch("/v2/apps", params{"embed": []string{"apps.tasks"}, "label": []string{apps.MarathonConsulLabel}})
 	if err != nil {
 		return nil, err
 	}
@@ -87,7 +110,7 @@ func (m Marathon) Tasks(app apps.AppID) ([]apps.Task, error) {
 	}).Debug("asking Marathon for tasks")
 
 	trimmedAppID := strings.Trim(app.String(), "/")
-	body, err := m.get(m.url(fmt.Sprintf("/v2/apps/%s/tasks", trimmedAppID)))
+	body, err := m.fetch(fmt.Sprintf("/v2/apps/%s/tasks", trimmedAppID), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -98,13 +121,16 @@ func (m Marathon) Tasks(app apps.AppID) ([]apps.Task, error) {
 func (m Marathon) Leader() (string, error) {
 	log.WithField("Location", m.Location).Debug("Asking Marathon for leader")
 
-	body, err := m.get(m.url("/v2/leader"))
+	body, err := m.fetch("/v2/leader", nil)
 	if err != nil {
 		return "", err
 	}
 
 	leaderResponse := &LeaderResponse{}
 	err = json.Unmarshal(body, leaderResponse)
+	if err == nil {
+		m.endpoints.preferLeader(leaderResponse.Leader)
+	}
 
 	return leaderResponse.Leader, err
 }
@@ -112,8 +138,6 @@ func (m Marathon) Leader() (string, error) {
 // EventStream method creates Streamer handler which is configured based on marathon
 // client and credentials.
 func (m Marathon) EventStream(desiredEvents []string, retries int, retryBackoff time.Duration) (*Streamer, error) {
-	subURL := m.urlWithQuery("/v2/events", params{"event_type": desiredEvents})
-
 	// Before creating actual streamer, this function blocks until configured leader for this receiver is elected.
 	// When leaderPoll function successfully exit this instance of marathon-consul,
 	// consider itself as a new leader and initializes Streamer.
@@ -122,9 +146,11 @@ func (m Marathon) EventStream(desiredEvents []string, retries int, retryBackoff
 	}
 
 	return &Streamer{
-		subURL:   subURL,
-		username: m.username,
-		password: m.password,
+		endpoints: m.endpoints,
+		subPath:   "/v2/events",
+		subQuery:  params{"event_type": desiredEvents},
+		username:  m.username,
+		password:  m.password,
 		client: &http.Client{
 			Transport: m.client.Transport,
 		},
@@ -150,14 +176,55 @@ func (m Marathon) leaderPoll() error {
 			continue
 		}
 		if leading {
-			metrics.UpdateGauge("leader", int64(1))
+			m.metrics.UpdateGauge("leader", int64(1))
 			return nil
 		}
-		metrics.UpdateGauge("leader", int64(0))
+		m.metrics.UpdateGauge("leader", int64(0))
 	}
 	return nil
 }
 
+// fetch sends GET request to Marathon locations starting with the preferred one
+// until one of them responds. Client errors (4xx) are returned without trying other locations.
+func (m Marathon) fetch(path string, params params) ([]byte, error) {
+	err := errNoLocations
+	for _, location := range m.endpoints.ordered() {
+		var body []byte
+		body, err = m.get(m.endpoints.url(location, path, params))
+		if err == nil {
+			m.endpoints.prefer(location)
+			return body, nil
+		}
+		m.endpoints.markError(location)
+		if !shouldFailover(err) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+type statusError struct {
+	code int
+	path string
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("Expected 200 but got %d for %s", e.code, e.path)
+}
+
+// IsNotFound reports whether Marathon responded that the requested resource, e.g., an app, does not exist
+func IsNotFound(err error) bool {
+	status, ok := err.(statusError)
+	return ok && status.code == http.StatusNotFound
+}
+
+func shouldFailover(err error) bool {
+	if status, ok := err.(statusError); ok {
+		return status.code >= 500
+	}
+	return true
+}
+
 func (m Marathon) get(url string) ([]byte, error) {
 	request, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -174,17 +241,17 @@ func (m Marathon) get(url string) ([]byte, error) {
 
 	request.SetBasicAuth(m.username, m.password)
 	var response *http.Response
-	metrics.Time("marathon.get", func() { response, err = m.client.Do(request) })
+	m.metrics.Time("marathon.get", func() { response, err = m.client.Do(request) })
 	if err != nil {
-		metrics.Mark("marathon.get.error")
+		m.metrics.Mark("marathon.get.error")
 		m.logHTTPError(response, err)
 		return nil, err
 	}
 	defer response.Body.Close()
 	if response.StatusCode != 200 {
-		metrics.Mark("marathon.get.error")
-		metrics.Mark(fmt.Sprintf("marathon.get.error.%d", response.StatusCode))
-		err = fmt.Errorf("Expected 200 but got %d for %s", response.StatusCode, response.Request.URL.Path)
+		m.metrics.Mark("marathon.get.error")
+		m.metrics.Mark(fmt.Sprintf("marathon.get.error.%d", response.StatusCode))
+		err = statusError{code: response.StatusCode, path: response.Request.URL.Path}
 		m.logHTTPError(response, err)
 		return nil, err
 	}
@@ -211,37 +278,26 @@ func (m Marathon) url(path string) string {
 
 type params map[string][]string
 
-// urlWithQuery returns absolute path to marathon endpoint
-// if location is given with path e.g. "localhost:8080/proxy/url", then
-// host and path parts are appended to respective url.URL fields
+// urlWithQuery returns absolute path to endpoint of the preferred Marathon location
 func (m Marathon) urlWithQuery(path string, params params) string {
-	var marathon url.URL
-	if strings.Contains(m.Location, "/") {
-		parts := strings.SplitN(m.Location, "/", 2)
-		marathon = url.URL{
-			Scheme: m.Protocol,
-			Host:   parts[0],
-			Path:   "/" + parts[1] + path,
-		}
-	} else {
-		marathon = url.URL{
-			Scheme: m.Protocol,
-			Host:   m.Location,
-			Path:   path,
-		}
-	}
+	return m.endpoints.url(m.endpoints.current(), path, params)
+}
 
-	query := marathon.Query()
-	for key, values := range params {
-		for _, value := range values {
-			query.Add(key, value)
-		}
-	}
-	marathon.RawQuery = query.Encode()
-	return marathon.String()
+// UseMetrics makes metrics of this Marathon recorded within given scope
+func (m *Marathon) UseMetrics(scope metrics.Scope) {
+	m.metrics = scope
+	m.endpoints.metrics = scope
+}
+
+// UseLeaderElector makes leadership checks rely on given elector instead of Marathon /v2/leader
+func (m *Marathon) UseLeaderElector(elector LeaderElector) {
+	m.elector = elector
 }
 
 func (m *Marathon) IsLeader() (bool, error) {
+	if m.elector != nil {
+		return m.elector.IsLeader()
+	}
 	if m.MyLeader == "*" {
 		log.Debug("Leader detection disable")
 		return true, nil
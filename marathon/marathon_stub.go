@@ -2,6 +2,7 @@ package marathon
 
 import (
 	"errors"
+	"net/http"
 	"sync"
 	"time"
 
@@ -28,7 +29,7 @@ func (m *MarathonerStub) App(id apps.AppID) (*apps.App, error) {
 	if app, ok := m.AppStub[id]; ok {
 		return app, nil
 	}
-	return nil, errors.New("app not found")
+	return nil, statusError{code: http.StatusNotFound, path: "/v2/apps" + id.String()}
 }
 
 func (m *MarathonerStub) Tasks(appID apps.AppID) ([]apps.Task, error) {
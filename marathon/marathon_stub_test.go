@@ -42,3 +42,12 @@ func TestMarathonStub(t *testing.T) {
 	assert.Error(t, errOnNotExistingTasks)
 	assert.Nil(t, notExistingTasks)
 }
+
+func TestGetLeaderStatus(t *testing.T) {
+	t.Parallel()
+	// expect
+	assert.Equal(t, marathon.LeaderStatus{Leader: true},
+		marathon.GetLeaderStatus(marathon.MarathonerStubWithLeaderForApps("some.host:1234", "some.host:1234")))
+	assert.Equal(t, marathon.LeaderStatus{Leader: false},
+		marathon.GetLeaderStatus(marathon.MarathonerStubWithLeaderForApps("some.host:1234", "other.host:1234")))
+}
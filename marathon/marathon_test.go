@@ -373,6 +373,38 @@ func TestIsLeader_PassingRunningOnLeader(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+type electorStub struct {
+	leader bool
+	err    error
+}
+
+func (e electorStub) IsLeader() (bool, error) {
+	return e.leader, e.err
+}
+
+func TestIsLeader_ShouldDelegateToLeaderElector(t *testing.T) {
+	t.Parallel()
+
+	// given
+	calls := 0
+	server, transport := mockServer(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	})
+	defer server.Close()
+	url, _ := url.Parse(server.URL)
+	m, _ := New(Config{Location: url.Host, Protocol: "HTTP", Leader: "this.leader:8080"})
+	m.client.Transport = transport
+	m.UseLeaderElector(electorStub{leader: true})
+
+	// when
+	leading, err := m.IsLeader()
+
+	//then
+	assert.True(t, leading)
+	assert.NoError(t, err)
+	assert.Zero(t, calls)
+}
+
 func TestIsLeader_NotPassingNotRunningOnLeader(t *testing.T) {
 	t.Parallel()
 
@@ -508,6 +540,121 @@ func TestGET_WithAuthOnErrorErrShouldNotContainUserAndPass(t *testing.T) {
 	assert.Nil(t, res)
 }
 
+func TestMarathon_AppsShouldFailoverToNextLocationAndPreferIt(t *testing.T) {
+	t.Parallel()
+	// given
+	var requestedHosts []string
+	server, transport := mockServer(func(w http.ResponseWriter, r *http.Request) {
+		requestedHosts = append(requestedHosts, r.Host)
+		if r.Host == "down:8080" {
+			w.WriteHeader(503)
+			return
+		}
+		fmt.Fprintln(w, `{"apps": []}`)
+	})
+	defer server.Close()
+	m, _ := New(Config{Location: "down:8080,up:8080", Protocol: "HTTP"})
+	m.client.Transport = transport
+
+	// when
+	_, err := m.ConsulApps()
+	_, err2 := m.ConsulApps()
+
+	// then
+	assert.NoError(t, err)
+	assert.NoError(t, err2)
+	assert.Equal(t, []string{"down:8080", "up:8080", "up:8080"}, requestedHosts)
+}
+
+func TestMarathon_AppsShouldFailoverWhenLocationIsNotResponding(t *testing.T) {
+	t.Parallel()
+	// given
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"apps": []}`)
+	}))
+	defer up.Close()
+	downURL, _ := url.Parse(down.URL)
+	upURL, _ := url.Parse(up.URL)
+	m, _ := New(Config{Location: downURL.Host + "," + upURL.Host, Protocol: "HTTP"})
+
+	// when
+	apps, err := m.ConsulApps()
+
+	// then
+	assert.NoError(t, err)
+	assert.Empty(t, apps)
+	assert.Equal(t, upURL.Host, m.endpoints.current())
+}
+
+func TestMarathon_AppShouldNotFailoverOnClientError(t *testing.T) {
+	t.Parallel()
+	// given
+	var requests int
+	server, transport := mockServer(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(404)
+	})
+	defer server.Close()
+	m, _ := New(Config{Location: "m1:8080,m2:8080", Protocol: "HTTP"})
+	m.client.Transport = transport
+
+	// when
+	_, err := m.App("/app/id")
+
+	// then
+	assert.EqualError(t, err, "Expected 200 but got 404 for /v2/apps//app/id")
+	assert.Equal(t, 1, requests)
+}
+
+func TestMarathon_ShouldReturnLastErrorWhenAllLocationsFail(t *testing.T) {
+	t.Parallel()
+	// given
+	server, transport := mockServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(503)
+	})
+	defer server.Close()
+	m, _ := New(Config{Location: "m1:8080,m2:8080", Protocol: "HTTP"})
+	m.client.Transport = transport
+
+	// when
+	_, err := m.Tasks("/app/id")
+
+	// then
+	assert.EqualError(t, err, "Expected 200 but got 503 for /v2/apps/app/id/tasks")
+}
+
+func TestMarathon_ShouldReturnErrorWhenNoLocationIsConfigured(t *testing.T) {
+	t.Parallel()
+	// given
+	m, _ := New(Config{Location: "", Protocol: "HTTP"})
+
+	// when
+	_, err := m.ConsulApps()
+
+	// then
+	assert.Equal(t, errNoLocations, err)
+}
+
+func TestLeader_ShouldPreferLeaderLocation(t *testing.T) {
+	t.Parallel()
+	// given
+	server, transport := stubServer("/v2/leader", `{"leader": "m2:8080"}`)
+	defer server.Close()
+	m, _ := New(Config{Location: "m1:8080,m2:8080", Protocol: "HTTP"})
+	m.client.Transport = transport
+
+	// when
+	leader, err := m.Leader()
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "m2:8080", leader)
+	assert.Equal(t, "m2:8080", m.endpoints.current())
+	assert.Equal(t, "HTTP://m2:8080/v2/apps", m.url("/v2/apps"))
+}
+
 // http://keighl.com/post/mocking-http-responses-in-golang/
 func stubServer(uri string, body string) (*httptest.Server, *http.Transport) {
 	return mockServer(func(w http.ResponseWriter, r *http.Request) {
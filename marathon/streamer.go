@@ -6,44 +6,137 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
 type Streamer struct {
-	Scanner      *bufio.Scanner
-	cancel       context.CancelFunc
-	client       *http.Client
-	username     string
-	password     string
-	subURL       string
-	retries      int
-	retryBackoff time.Duration
-	noRecover    bool
+	Scanner        *bufio.Scanner
+	cancel         context.CancelFunc
+	client         *http.Client
+	username       string
+	password       string
+	endpoints      *endpoints
+	subPath        string
+	subQuery       params
+	retries        int
+	retryBackoff   time.Duration
+	noRecover      bool
+	stateLock      sync.RWMutex
+	connected      bool
+	disconnectedAt time.Time
+	lastEventID    string
+	serverDelay    time.Duration
 }
 
 func (s *Streamer) Stop() {
-	s.cancel()
+	s.setConnected(false)
+	s.cancelRequest()
 	s.noRecover = true
 }
 
+// Disconnect closes the subscription, unlike Stop it can be recovered later
+func (s *Streamer) Disconnect() {
+	s.setConnected(false)
+	s.cancelRequest()
+}
+
+func (s *Streamer) cancelRequest() {
+	s.stateLock.RLock()
+	cancel := s.cancel
+	s.stateLock.RUnlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// Connected reports whether subscription to the event stream is established
+func (s *Streamer) Connected() bool {
+	s.stateLock.RLock()
+	defer s.stateLock.RUnlock()
+	return s.connected
+}
+
+// DisconnectedSince returns time when established subscription was lost.
+// Second value is false when streamer is connected or has never been connected.
+func (s *Streamer) DisconnectedSince() (time.Time, bool) {
+	s.stateLock.RLock()
+	defer s.stateLock.RUnlock()
+	return s.disconnectedAt, !s.connected && !s.disconnectedAt.IsZero()
+}
+
+// SetLastEventID remembers ID of the last read event, it is sent with Last-Event-ID header when reconnecting
+func (s *Streamer) SetLastEventID(id string) {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+	s.lastEventID = id
+}
+
+// SetRetryDelay sets reconnection time sent by the server, it takes precedence over configured retry backoff
+func (s *Streamer) SetRetryDelay(delay time.Duration) {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+	s.serverDelay = delay
+}
+
+func (s *Streamer) reconnection() (lastEventID string, delay time.Duration, serverSent bool) {
+	s.stateLock.RLock()
+	defer s.stateLock.RUnlock()
+	if s.serverDelay > 0 {
+		return s.lastEventID, s.serverDelay, true
+	}
+	return s.lastEventID, s.retryBackoff, false
+}
+
+func (s *Streamer) setConnected(connected bool) {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+	if s.connected && !connected {
+		s.disconnectedAt = time.Now()
+	}
+	s.connected = connected
+}
+
+// Start subscribes to the event stream of the preferred Marathon location
+// and fails over to other locations when subscription could not be established
 func (s *Streamer) Start() error {
-	req, err := http.NewRequest("GET", s.subURL, nil)
+	err := errNoLocations
+	for _, location := range s.endpoints.ordered() {
+		if err = s.start(s.endpoints.url(location, s.subPath, s.subQuery)); err == nil {
+			s.endpoints.prefer(location)
+			return nil
+		}
+		s.endpoints.markError(location)
+		log.WithError(err).WithField("Location", location).Warn("Unable to subscribe to Marathon event stream")
+	}
+	return err
+}
+
+func (s *Streamer) start(subURL string) error {
+	req, err := http.NewRequest("GET", subURL, nil)
 	if err != nil {
 		return fmt.Errorf("Unable to create request: %s", err)
 	}
 	req.SetBasicAuth(s.username, s.password)
 	req.Header.Set("Accept", "text/event-stream")
+	if lastEventID, _, _ := s.reconnection(); lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
 	ctx, cancel := context.WithCancel(context.Background())
+	s.stateLock.Lock()
 	s.cancel = cancel
+	s.stateLock.Unlock()
 	req = req.WithContext(ctx)
 	res, err := s.client.Do(req)
 	if err != nil {
-		s.cancel()
+		cancel()
 		return fmt.Errorf("Subscription request errored: %s", err)
 	}
 	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		cancel()
 		return fmt.Errorf("Event stream not connected: Expected %d but got %d", http.StatusOK, res.StatusCode)
 	}
 	log.WithFields(log.Fields{
@@ -52,20 +145,28 @@ func (s *Streamer) Start() error {
 		"Method": "GET",
 	}).Debug("Subsciption success")
 	s.Scanner = bufio.NewScanner(res.Body)
+	s.setConnected(true)
 
 	return nil
 }
 
+// Recover reconnects to the event stream. When the server has sent reconnection time
+// it is waited before every attempt, otherwise only between retries.
 func (s *Streamer) Recover() error {
 	if s.noRecover {
 		return errors.New("Streamer is not recoverable")
 	}
-	s.cancel()
+	s.setConnected(false)
+	s.cancelRequest()
 
+	_, delay, serverSent := s.reconnection()
+	if serverSent {
+		time.Sleep(delay)
+	}
 	err := s.Start()
 	i := 0
 	for ; err != nil && i <= s.retries; err = s.Start() {
-		time.Sleep(s.retryBackoff)
+		time.Sleep(delay)
 		i++
 	}
 	if err != nil {
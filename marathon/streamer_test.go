@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"net/http"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -12,27 +13,27 @@ func TestStreamer_RecoverShouldReturnErrorWhenCantStart(t *testing.T) {
 	server, transport := stubServer("/v2/events", "")
 	defer server.Close()
 	client := &http.Client{Transport: transport}
-	s := Streamer{client: client}
+	s := Streamer{client: client, endpoints: newEndpoints("", "marathon"), subPath: "/v2/events"}
 	s.Start()
 
 	err := s.Recover()
 
-	assert.EqualError(t, err, "Cannot recover Streamer: Subscription request errored: Get : unsupported protocol scheme \"\"")
+	assert.EqualError(t, err, "Cannot recover Streamer: Subscription request errored: Get \"//marathon/v2/events\": unsupported protocol scheme \"\"")
 }
 
 func TestStreamer_StartShouldReturnErrorOnInvalidUrl(t *testing.T) {
-	s := Streamer{client: http.DefaultClient}
+	s := Streamer{client: http.DefaultClient, endpoints: newEndpoints("", "marathon"), subPath: "/v2/events"}
 
 	err := s.Start()
 
-	assert.EqualError(t, err, "Subscription request errored: Get : unsupported protocol scheme \"\"")
+	assert.EqualError(t, err, "Subscription request errored: Get \"//marathon/v2/events\": unsupported protocol scheme \"\"")
 }
 
 func TestStreamer_StartShouldReturnErrorOnNon200Response(t *testing.T) {
 	server, transport := stubServer("/v2/events", "")
 	defer server.Close()
 	client := &http.Client{Transport: transport}
-	s := Streamer{client: client, subURL: "http://marathon/invalid/path"}
+	s := Streamer{client: client, endpoints: newEndpoints("http", "marathon"), subPath: "/invalid/path"}
 
 	err := s.Start()
 
@@ -43,30 +44,69 @@ func TestStreamer_StartShouldReturnNoErrorIfSuccessfulConnects(t *testing.T) {
 	server, transport := stubServer("/v2/events", "")
 	defer server.Close()
 	client := &http.Client{Transport: transport}
-	s := Streamer{client: client, subURL: "http://marathon/v2/events"}
+	s := Streamer{client: client, endpoints: newEndpoints("http", "marathon"), subPath: "/v2/events"}
 
 	err := s.Start()
 
 	assert.NoError(t, err)
 }
 
+func TestStreamer_StartShouldFailoverToNextLocation(t *testing.T) {
+	server, transport := mockServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host == "down" {
+			w.WriteHeader(503)
+		}
+	})
+	defer server.Close()
+	client := &http.Client{Transport: transport}
+	endpoints := newEndpoints("http", "down,up")
+	s := Streamer{client: client, endpoints: endpoints, subPath: "/v2/events"}
+
+	err := s.Start()
+
+	assert.NoError(t, err)
+	assert.True(t, s.Connected())
+	assert.Equal(t, "up", endpoints.current())
+}
+
 func TestStreamer_RecoverShouldReturnNoErrorIfSuccessfulConnects(t *testing.T) {
 	server, transport := stubServer("/v2/events", "")
 	defer server.Close()
 	client := &http.Client{Transport: transport}
-	s := Streamer{client: client, subURL: "http://marathon/v2/events"}
+	s := Streamer{client: client, endpoints: newEndpoints("http", "marathon"), subPath: "/v2/events"}
+	s.Start()
+
+	err := s.Recover()
+
+	assert.NoError(t, err)
+}
+
+func TestStreamer_RecoverShouldSendLastEventIDAndWaitServerRetryDelay(t *testing.T) {
+	lastEventIDs := make(chan string, 2)
+	server, transport := mockServer(func(w http.ResponseWriter, r *http.Request) {
+		lastEventIDs <- r.Header.Get("Last-Event-ID")
+	})
+	defer server.Close()
+	client := &http.Client{Transport: transport}
+	s := Streamer{client: client, endpoints: newEndpoints("http", "marathon"), subPath: "/v2/events", retryBackoff: time.Hour}
 	s.Start()
+	s.SetLastEventID("42")
+	s.SetRetryDelay(20 * time.Millisecond)
 
+	before := time.Now()
 	err := s.Recover()
 
 	assert.NoError(t, err)
+	assert.True(t, time.Since(before) >= 20*time.Millisecond)
+	assert.Equal(t, "", <-lastEventIDs)
+	assert.Equal(t, "42", <-lastEventIDs)
 }
 
 func TestStreamer_StopShouldPreventRecovery(t *testing.T) {
 	server, transport := stubServer("/v2/events", "")
 	defer server.Close()
 	client := &http.Client{Transport: transport}
-	s := Streamer{client: client, subURL: "http://marathon/v2/events"}
+	s := Streamer{client: client, endpoints: newEndpoints("http", "marathon"), subPath: "/v2/events"}
 
 	s.Start()
 	s.Stop()
@@ -75,6 +115,22 @@ func TestStreamer_StopShouldPreventRecovery(t *testing.T) {
 	assert.Error(t, err, "Streamer is not recoverable")
 }
 
+func TestStreamer_DisconnectShouldAllowRecovery(t *testing.T) {
+	server, transport := stubServer("/v2/events", "")
+	defer server.Close()
+	client := &http.Client{Transport: transport}
+	s := Streamer{client: client, endpoints: newEndpoints("http", "marathon"), subPath: "/v2/events"}
+	s.Start()
+
+	s.Disconnect()
+	disconnected := s.Connected()
+	err := s.Recover()
+
+	assert.False(t, disconnected)
+	assert.NoError(t, err)
+	assert.True(t, s.Connected())
+}
+
 func TestStreamer_StopShouldCancelRequest(t *testing.T) {
 	ready := make(chan bool)
 	wait := make(chan bool)
@@ -84,7 +140,7 @@ func TestStreamer_StopShouldCancelRequest(t *testing.T) {
 	})
 	defer server.Close()
 	client := &http.Client{Transport: transport}
-	s := Streamer{client: client, subURL: "http://marathon/v2/events"}
+	s := Streamer{client: client, endpoints: newEndpoints("http", "marathon"), subPath: "/v2/events"}
 
 	go func() {
 		err := s.Start()
@@ -95,3 +151,38 @@ func TestStreamer_StopShouldCancelRequest(t *testing.T) {
 	s.Stop()
 	wait <- false
 }
+
+func TestStreamer_ShouldReportConnectionState(t *testing.T) {
+	server, transport := stubServer("/v2/events", "")
+	defer server.Close()
+	client := &http.Client{Transport: transport}
+	s := Streamer{client: client, endpoints: newEndpoints("http", "marathon"), subPath: "/v2/events"}
+
+	assert.False(t, s.Connected())
+
+	s.Start()
+	assert.True(t, s.Connected())
+
+	s.Stop()
+	assert.False(t, s.Connected())
+}
+
+func TestStreamer_ShouldReportDisconnectionTime(t *testing.T) {
+	server, transport := stubServer("/v2/events", "")
+	defer server.Close()
+	client := &http.Client{Transport: transport}
+	s := Streamer{client: client, endpoints: newEndpoints("http", "marathon"), subPath: "/v2/events"}
+
+	_, disconnected := s.DisconnectedSince()
+	assert.False(t, disconnected)
+
+	s.Start()
+	_, disconnected = s.DisconnectedSince()
+	assert.False(t, disconnected)
+
+	before := time.Now()
+	s.Stop()
+	since, disconnected := s.DisconnectedSince()
+	assert.True(t, disconnected)
+	assert.False(t, since.Before(before))
+}
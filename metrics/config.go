@@ -7,4 +7,6 @@ type Config struct {
 	Prefix   string
 	Interval time.Interval
 	Addr     string
+	// Path on the web listener where metrics are exposed when Target is prometheus
+	PrometheusPath string
 }
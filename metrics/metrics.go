@@ -41,7 +41,10 @@ func UpdateGauge(name string, value int64) {
 
 func Init(cfg Config) error {
 	pfx = cfg.Prefix
-	if pfx == "default" {
+	if pfx == "default" && cfg.Target == "prometheus" {
+		// hostname is a label added by Prometheus scrape, it should not be a part of the metric name
+		pfx = clean(filepath.Base(os.Args[0]))
+	} else if pfx == "default" {
 		prefix, err := defaultPrefix()
 		if err != nil {
 			return err
@@ -62,6 +65,13 @@ func Init(cfg Config) error {
 
 		log.Infof("Sending metrics to Graphite on %s as %q", cfg.Addr, pfx)
 		return initGraphite(cfg.Addr, cfg.Interval.Duration)
+	case "prometheus":
+		if cfg.PrometheusPath == "" {
+			return errors.New("metrics: prometheus path missing")
+		}
+
+		log.Infof("Exposing metrics for Prometheus on %s as %q", cfg.PrometheusPath, pfx)
+		return nil
 	case "":
 		log.Infof("Metrics disabled")
 		return nil
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+var quantiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+var invalidPrometheusNameChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+// PrometheusHandler exposes every metric from the default registry
+// in the Prometheus text exposition format (version 0.0.4).
+// Meters are exposed as counters, gauges as gauges and timers as summaries in seconds.
+func PrometheusHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write(prometheusExposition(metrics.DefaultRegistry))
+}
+
+func prometheusExposition(registry metrics.Registry) []byte {
+	all := map[string]interface{}{}
+	registry.Each(func(name string, metric interface{}) {
+		all[name] = metric
+	})
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		writePrometheusMetric(&buf, prometheusName(name), all[name])
+	}
+	return buf.Bytes()
+}
+
+func writePrometheusMetric(buf *bytes.Buffer, name string, metric interface{}) {
+	switch m := metric.(type) {
+	case metrics.Meter:
+		name += "_total"
+		fmt.Fprintf(buf, "# TYPE %s counter\n", name)
+		fmt.Fprintf(buf, "%s %d\n", name, m.Count())
+	case metrics.Counter:
+		fmt.Fprintf(buf, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(buf, "%s %d\n", name, m.Count())
+	case metrics.Gauge:
+		fmt.Fprintf(buf, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(buf, "%s %d\n", name, m.Value())
+	case metrics.GaugeFloat64:
+		fmt.Fprintf(buf, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(buf, "%s %g\n", name, m.Value())
+	case metrics.Timer:
+		t := m.Snapshot()
+		// go-metrics records durations in nanoseconds, Prometheus expects base units
+		scale := float64(time.Second)
+		writePrometheusSummary(buf, name+"_seconds", t.Percentiles(quantiles), t.Mean()*float64(t.Count()), t.Count(), scale)
+	case metrics.Histogram:
+		h := m.Snapshot()
+		writePrometheusSummary(buf, name, h.Percentiles(quantiles), h.Mean()*float64(h.Count()), h.Count(), 1)
+	}
+}
+
+// writePrometheusSummary writes a summary built from the sample kept by go-metrics.
+// Quantiles and sum are estimated from that sample, count is exact.
+func writePrometheusSummary(buf *bytes.Buffer, name string, values []float64, sum float64, count int64, scale float64) {
+	fmt.Fprintf(buf, "# TYPE %s summary\n", name)
+	for i, q := range quantiles {
+		fmt.Fprintf(buf, "%s{quantile=\"%g\"} %g\n", name, q, values[i]/scale)
+	}
+	fmt.Fprintf(buf, "%s_sum %g\n", name, sum/scale)
+	fmt.Fprintf(buf, "%s_count %d\n", name, count)
+}
+
+// prometheusName converts dotted go-metrics name into a valid Prometheus metric name
+// e.g., consul.register.error -> <prefix>_consul_register_error
+func prometheusName(name string) string {
+	if pfx != "" {
+		name = pfx + "_" + name
+	}
+	name = invalidPrometheusNameChars.ReplaceAllString(name, "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
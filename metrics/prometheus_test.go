@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsInit_ForPrometheus(t *testing.T) {
+	// given
+	os.Args = []string{"./marathon-consul"}
+
+	// when
+	err := Init(Config{Target: "prometheus", Prefix: "default", PrometheusPath: "/metrics"})
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "marathon-consul", pfx)
+}
+
+func TestMetricsInit_ForPrometheusWithNoPath(t *testing.T) {
+	err := Init(Config{Target: "prometheus", Prefix: "prefix"})
+	assert.Error(t, err)
+}
+
+func TestPrometheusName(t *testing.T) {
+	pfx = "marathon-consul"
+	defer func() { pfx = "" }()
+
+	assert.Equal(t, "marathon_consul_events_queue_len", prometheusName("events.queue.len"))
+	assert.Equal(t, "marathon_consul_marathon_get_error_500", prometheusName("marathon.get.error.500"))
+
+	pfx = ""
+	assert.Equal(t, "consul_register_error", prometheusName("consul.register.error"))
+	assert.Equal(t, "_1_minute", prometheusName("1.minute"))
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	// given
+	Init(Config{Target: "prometheus", Prefix: "", PrometheusPath: "/metrics"})
+	registry := metrics.NewRegistry()
+	metrics.GetOrRegisterMeter("consul.register.success", registry).Mark(3)
+	metrics.GetOrRegisterGauge("events.queue.len", registry).Update(7)
+	metrics.GetOrRegisterTimer("marathon.get", registry).Update(2 * time.Second)
+
+	// when
+	exposition := string(prometheusExposition(registry))
+
+	// then
+	assert.Equal(t, `# TYPE consul_register_success_total counter
+consul_register_success_total 3
+# TYPE events_queue_len gauge
+events_queue_len 7
+# TYPE marathon_get_seconds summary
+marathon_get_seconds{quantile="0.5"} 2
+marathon_get_seconds{quantile="0.75"} 2
+marathon_get_seconds{quantile="0.95"} 2
+marathon_get_seconds{quantile="0.99"} 2
+marathon_get_seconds{quantile="0.999"} 2
+marathon_get_seconds_sum 2
+marathon_get_seconds_count 1
+`, exposition)
+}
+
+func TestPrometheusHandler_ServesDefaultRegistry(t *testing.T) {
+	// given
+	Init(Config{Target: "prometheus", Prefix: "", PrometheusPath: "/metrics"})
+	Mark("prometheus.marker")
+	req, _ := http.NewRequest("GET", "http://example.com/metrics", nil)
+	recorder := httptest.NewRecorder()
+
+	// when
+	PrometheusHandler(recorder, req)
+
+	// then
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "text/plain; version=0.0.4", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), "prometheus_marker_total 1\n")
+
+	// when
+	Clear()
+}
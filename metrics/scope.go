@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"strings"
+
+	"github.com/rcrowley/go-metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+const scopesPrefix = "sources."
+
+// Scope records metrics of a single Marathon source under names prefixed with "sources.<name>.",
+// so metrics of different sources are not mixed. Zero value records metrics under their plain names.
+type Scope string
+
+func (s Scope) Mark(name string) {
+	Mark(s.Name(name))
+}
+
+func (s Scope) Time(name string, function func()) {
+	Time(s.Name(name), function)
+}
+
+func (s Scope) UpdateGauge(name string, value int64) {
+	UpdateGauge(s.Name(name), value)
+}
+
+// Clear unregisters metrics of the scope, metrics of other scopes are left untouched
+func (s Scope) Clear() {
+	log.WithField("Scope", string(s)).Info("Unregistering metrics of the scope.")
+	var names []string
+	metrics.DefaultRegistry.Each(func(name string, _ interface{}) {
+		if s.owns(name) {
+			names = append(names, name)
+		}
+	})
+	for _, name := range names {
+		metrics.DefaultRegistry.Unregister(name)
+	}
+}
+
+// Name returns given metric name within the scope
+func (s Scope) Name(name string) string {
+	if s == "" {
+		return name
+	}
+	return scopesPrefix + clean(string(s)) + "." + name
+}
+
+func (s Scope) owns(name string) bool {
+	if s == "" {
+		return !strings.HasPrefix(name, scopesPrefix)
+	}
+	return strings.HasPrefix(name, s.Name(""))
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+var scopeNameTestsData = []struct {
+	scope    Scope
+	name     string
+	expected string
+}{
+	{"", "sync.services", "sync.services"},
+	{"analytics", "sync.services", "sources.analytics.sync.services"},
+	{"data.team:1", "events.queue.len", "sources.data_team_1.events.queue.len"},
+}
+
+func TestScope_Name(t *testing.T) {
+	t.Parallel()
+	for _, testCase := range scopeNameTestsData {
+		// expect
+		assert.Equal(t, testCase.expected, testCase.scope.Name(testCase.name))
+	}
+}
+
+func TestScope_ShouldKeepGaugesOfScopesApart(t *testing.T) {
+	// given
+	Init(Config{Target: "stdout", Prefix: ""})
+
+	// when
+	Scope("").UpdateGauge("scoped.gauge", 1)
+	Scope("analytics").UpdateGauge("scoped.gauge", 2)
+
+	// then
+	main, _ := metrics.Get("scoped.gauge").(metrics.Gauge)
+	analytics, _ := metrics.Get("sources.analytics.scoped.gauge").(metrics.Gauge)
+	assert.Equal(t, int64(1), main.Value())
+	assert.Equal(t, int64(2), analytics.Value())
+}
+
+func TestScope_ClearShouldUnregisterOnlyMetricsOfTheScope(t *testing.T) {
+	// given
+	Init(Config{Target: "stdout", Prefix: ""})
+	Scope("").Mark("scoped.clear")
+	Scope("analytics").Mark("scoped.clear")
+	Scope("billing").Mark("scoped.clear")
+
+	// when
+	Scope("analytics").Clear()
+
+	// then
+	assert.NotNil(t, metrics.Get("scoped.clear"))
+	assert.Nil(t, metrics.Get("sources.analytics.scoped.clear"))
+	assert.NotNil(t, metrics.Get("sources.billing.scoped.clear"))
+
+	// when
+	Scope("").Clear()
+
+	// then
+	assert.Nil(t, metrics.Get("scoped.clear"))
+	assert.NotNil(t, metrics.Get("sources.billing.scoped.clear"))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/allegro/marathon-consul/apps"
+	"github.com/allegro/marathon-consul/config"
+	"github.com/allegro/marathon-consul/consul"
+	"github.com/allegro/marathon-consul/events"
+	"github.com/allegro/marathon-consul/journal"
+	"github.com/allegro/marathon-consul/marathon"
+	log "github.com/sirupsen/logrus"
+)
+
+// replay passes events recorded in the journal file through the event handler, one by one.
+// Apps are fetched from Marathon in their current state, so the outcome may differ from the recorded one.
+func replay(config *config.Config, registry *consul.Consul, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("Usage: marathon-consul [options] replay <journal-file> [source-name]")
+	}
+	sourceName := ""
+	marathonConfig := config.Marathon
+	if len(args) == 2 {
+		sourceName = args[1]
+		sourceConfig, err := findSource(config.Marathons, sourceName)
+		if err != nil {
+			return err
+		}
+		marathonConfig = sourceConfig.Config
+		registry = registry.WithTag(sourceConfig.ConsulTag)
+	}
+
+	remote, err := marathon.New(marathonConfig)
+	if err != nil {
+		return err
+	}
+	handler := events.NewEventHandler(0, registry, remote, nil, apps.UnhealthyTaskPolicy(config.Web.UnhealthyTaskPolicy))
+
+	log.WithField("File", args[0]).WithField("Source", sourceName).Info("Replaying events journal")
+	result, err := journal.Replay(args[0], sourceName, handler.Handle)
+	if err != nil {
+		return fmt.Errorf("Could not replay events journal: %s", err)
+	}
+	log.WithField("Replayed", result.Replayed).WithField("Failed", result.Failed).Info("Events journal replayed")
+	return nil
+}
+
+func findSource(sources []config.MarathonSource, name string) (config.MarathonSource, error) {
+	for _, source := range sources {
+		if source.Name == name {
+			return source, nil
+		}
+	}
+	return config.MarathonSource{}, fmt.Errorf("Unknown Marathon source %q", name)
+}
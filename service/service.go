@@ -18,6 +18,7 @@ type Service struct {
 	ID                ID
 	Name              string
 	Tags              []string
+	Meta              map[string]string
 	AgentAddress      string
 	EnableTagOverride bool
 }
@@ -31,6 +32,12 @@ func (s *Service) TaskID() (apps.TaskID, error) {
 	return apps.TaskID(""), errors.New("marathon-task tag missing")
 }
 
+// IsMarathonTaskTagOfApp checks if the tag is a marathon-task tag of a task of given app
+func IsMarathonTaskTagOfApp(tag string, appID apps.AppID) bool {
+	taskID := strings.TrimPrefix(tag, "marathon-task:")
+	return taskID != tag && strings.Contains(taskID, ".") && apps.TaskID(taskID).AppID() == appID
+}
+
 func MarathonTaskTag(taskID apps.TaskID) string {
 	return fmt.Sprintf("marathon-task:%s", taskID)
 }
@@ -38,7 +45,11 @@ func MarathonTaskTag(taskID apps.TaskID) string {
 type Registry interface {
 	GetAllServices() ([]*Service, error)
 	GetServices(name string) ([]*Service, error)
+	GetAppServices(appID apps.AppID) ([]*Service, error)
+	RegistrationIntents(task *apps.Task, app *apps.App) []apps.RegistrationIntent
 	Register(task *apps.Task, app *apps.App) error
 	DeregisterByTask(taskID apps.TaskID) error
 	Deregister(toDeregister *Service) error
+	EnableMaintenanceByTask(taskID apps.TaskID, reason string) error
+	DisableMaintenanceByTask(taskID apps.TaskID) error
 }
@@ -46,3 +46,23 @@ func TestServiceTaskId_NoMarathonTaskTag(t *testing.T) {
 	// then
 	assert.Error(t, err)
 }
+
+var isMarathonTaskTagOfAppTestsData = []struct {
+	tag      string
+	expected bool
+}{
+	{"marathon-task:test_app.1", true},
+	{"marathon-task:test_app_nested.1", false},
+	{"marathon-task:other.1", false},
+	{"marathon-task:malformed", false},
+	{"test_app.1", false},
+	{"marathon", false},
+}
+
+func TestIsMarathonTaskTagOfApp(t *testing.T) {
+	t.Parallel()
+	for _, testCase := range isMarathonTaskTagOfAppTestsData {
+		// expect
+		assert.Equal(t, testCase.expected, IsMarathonTaskTagOfApp(testCase.tag, "/test/app"), testCase.tag)
+	}
+}
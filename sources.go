@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/allegro/marathon-consul/config"
+	"github.com/allegro/marathon-consul/consul"
+	"github.com/allegro/marathon-consul/journal"
+	"github.com/allegro/marathon-consul/marathon"
+	"github.com/allegro/marathon-consul/metrics"
+	"github.com/allegro/marathon-consul/sse"
+	"github.com/allegro/marathon-consul/sync"
+	"github.com/allegro/marathon-consul/web"
+	log "github.com/sirupsen/logrus"
+)
+
+// source streams events and syncs services of a single Marathon instance
+type source struct {
+	name     string
+	marathon *marathon.Marathon
+	sync     *sync.Sync
+	sse      *sse.SSE
+}
+
+// newSources creates the main Marathon source followed by additional ones in the configured order
+func newSources(config *config.Config, registry *consul.Consul, elector marathon.LeaderElector,
+	eventsJournal *journal.Journal) ([]*source, error) {
+	mainSource, err := newSource("", config.Marathon, registry, config, elector, eventsJournal)
+	if err != nil {
+		return nil, err
+	}
+	sources := []*source{mainSource}
+	for _, sourceConfig := range config.Marathons {
+		log.WithField("Source", sourceConfig.Name).WithField("Location", sourceConfig.Location).
+			WithField("ConsulTag", sourceConfig.ConsulTag).Info("Adding Marathon source")
+		additionalSource, err := newSource(sourceConfig.Name, sourceConfig.Config,
+			registry.WithTag(sourceConfig.ConsulTag), config, elector, eventsJournal)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, additionalSource)
+	}
+	return sources, nil
+}
+
+func newSource(name string, marathonConfig marathon.Config, registry *consul.Consul, config *config.Config,
+	elector marathon.LeaderElector, eventsJournal *journal.Journal) (*source, error) {
+	remote, err := marathon.New(marathonConfig)
+	if err != nil {
+		return nil, err
+	}
+	if elector != nil {
+		remote.UseLeaderElector(elector)
+	}
+	// metrics of additional sources are prefixed with their names, metrics of the main one are left as they are
+	scope := metrics.Scope(name)
+	remote.UseMetrics(scope)
+	webConfig := config.Web
+	if name != "" && webConfig.QueueSpillFile != "" {
+		// every source has its own events queue
+		webConfig.QueueSpillFile += "." + name
+	}
+	s := &source{
+		name:     name,
+		marathon: remote,
+		sync:     sync.New(config.Sync, remote, registry, registry.AddAgentsFromApps),
+		sse:      sse.New(config.SSE, webConfig, remote, registry),
+	}
+	s.sync.UseMetrics(scope)
+	s.sse.UseMetrics(scope)
+	s.sse.OnReconnect(s.sync.CatchUp)
+	if eventsJournal != nil {
+		s.sse.UseJournal(eventsJournal.ForSource(name))
+	}
+	return s, nil
+}
+
+func (s *source) start(ctx context.Context) {
+	s.sync.StartSyncServicesJob(ctx)
+	go func() {
+		if err := s.sse.Start(); err != nil {
+			log.WithError(err).WithField("Source", s.name).Fatal("Cannot instantiate SSE handler")
+		}
+	}()
+}
+
+func (s *source) handle(prefix string) {
+	http.HandleFunc(prefix+"/sync", s.sync.TriggerHandler)
+	http.HandleFunc(prefix+"/sync/plan", s.sync.PlanHandler)
+	http.HandleFunc(prefix+"/events/dead-letters", s.sse.DeadLettersHandler)
+}
+
+func (s *source) healthChecks(config web.HealthConfig) []web.HealthCheck {
+	return []web.HealthCheck{
+		s.named(s.sse.StreamCheck(config.MaxSSEDisconnection.Duration)),
+		s.named(s.sse.QueueCheck(config.MaxQueueUtilization)),
+		s.named(s.sync.HealthCheck(config.MaxFailedSyncs)),
+	}
+}
+
+// named prefixes check failures with the source name, checks of the main Marathon are left as they are
+func (s *source) named(check func() error) web.HealthCheck {
+	if s.name == "" {
+		return check
+	}
+	return func() error {
+		if err := check(); err != nil {
+			return fmt.Errorf("%s: %s", s.name, err)
+		}
+		return nil
+	}
+}
+
+func (s *source) status() map[string]interface{} {
+	return map[string]interface{}{
+		"leader": marathon.GetLeaderStatus(s.marathon),
+		"sse":    s.sse.Status(),
+		"sync":   s.sync.Status(),
+	}
+}
+
+// stopSources stops event processing of all sources in parallel, so they share the shutdown timeout
+func stopSources(ctx context.Context, sources []*source) {
+	stopped := make(chan struct{}, len(sources))
+	for _, s := range sources {
+		go func(s *source) {
+			s.sse.Stop(ctx)
+			stopped <- struct{}{}
+		}(s)
+	}
+	for range sources {
+		<-stopped
+	}
+}
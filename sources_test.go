@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/allegro/marathon-consul/config"
+	"github.com/allegro/marathon-consul/consul"
+	"github.com/allegro/marathon-consul/marathon"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sourcesConfig(location string, additional ...config.MarathonSource) *config.Config {
+	cfg := &config.Config{Marathons: additional}
+	cfg.Marathon = marathon.Config{Location: location, Protocol: "http"}
+	cfg.Web.QueueSize = 10
+	cfg.Web.WorkersCount = 1
+	return cfg
+}
+
+func additionalSource(name, location string) config.MarathonSource {
+	return config.MarathonSource{
+		Name:      name,
+		Config:    marathon.Config{Location: location, Protocol: "http"},
+		ConsulTag: "marathon-" + name,
+	}
+}
+
+func TestNewSources_ShouldCreateMainSourceFollowedByAdditionalOnes(t *testing.T) {
+	t.Parallel()
+	// given
+	cfg := sourcesConfig("main:8080", additionalSource("analytics", "analytics:8080"), additionalSource("billing", "billing:8080"))
+
+	// when
+	sources, err := newSources(cfg, consul.New(cfg.Consul), nil, nil)
+
+	// then
+	require.NoError(t, err)
+	require.Len(t, sources, 3)
+	for i, expected := range []struct{ name, location string }{
+		{"", "main:8080"},
+		{"analytics", "analytics:8080"},
+		{"billing", "billing:8080"},
+	} {
+		assert.Equal(t, expected.name, sources[i].name)
+		assert.Equal(t, expected.location, sources[i].marathon.Location)
+	}
+}
+
+func TestNewSources_ShouldPrefixMetricsOfAdditionalSourceWithItsName(t *testing.T) {
+	t.Parallel()
+	// given
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"apps": []}`))
+	}))
+	defer server.Close()
+	location := strings.TrimPrefix(server.URL, "http://")
+	cfg := sourcesConfig("main.invalid:8080", additionalSource("metered", location))
+	sources, err := newSources(cfg, consul.New(cfg.Consul), nil, nil)
+	require.NoError(t, err)
+	req, _ := http.NewRequest("POST", "http://example.com/sources/metered/sync?force=true", nil)
+
+	// when
+	sources[1].sync.TriggerHandler(httptest.NewRecorder(), req)
+
+	// then
+	assert.NotNil(t, metrics.Get("sources.metered.marathon.get"))
+	assert.NotNil(t, metrics.Get("sources.metered.sync.services"))
+}
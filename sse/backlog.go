@@ -0,0 +1,286 @@
+package sse
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/allegro/marathon-consul/events"
+	log "github.com/sirupsen/logrus"
+)
+
+// coalesceBacklog keeps events in memory, event with the same coalesce key as a queued one replaces it.
+// Replaced event is the last queued one of its task, so it's replaced in place. Otherwise it's removed
+// and the new event is appended, so events of a single task are never reordered.
+type coalesceBacklog struct {
+	lock    sync.Mutex
+	entries []*coalescedEvent
+	byKey   map[string]*coalescedEvent
+	// the last queued event of each task, by supersede key
+	lastOfTask map[string]*coalescedEvent
+	tokens     uint64
+}
+
+type coalescedEvent struct {
+	event   events.Event
+	key     string
+	taskKey string
+	token   uint64
+}
+
+func newCoalesceBacklog() *coalesceBacklog {
+	return &coalesceBacklog{
+		byKey:      make(map[string]*coalescedEvent),
+		lastOfTask: make(map[string]*coalescedEvent),
+	}
+}
+
+func (b *coalesceBacklog) push(e events.Event) error {
+	b.add(e)
+	return nil
+}
+
+// add appends the event or replaces queued one with the same coalesce key, it returns true when the event was replaced
+func (b *coalesceBacklog) add(e events.Event) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.tokens++
+	key := events.CoalesceKey(e)
+	taskKey := events.SupersedeKey(e)
+	replaced, ok := b.byKey[key]
+	if ok && key != "" && b.lastOfTask[taskKey] == replaced {
+		replaced.event = e
+		replaced.token = b.tokens
+		return true
+	}
+	if ok && key != "" {
+		b.removeEntry(replaced)
+	}
+	entry := &coalescedEvent{event: e, key: key, taskKey: taskKey, token: b.tokens}
+	b.entries = append(b.entries, entry)
+	if key != "" {
+		b.byKey[key] = entry
+	}
+	if taskKey != "" {
+		b.lastOfTask[taskKey] = entry
+	}
+	return ok && key != ""
+}
+
+// removeEntry removes queued event which is not the last one of its task
+func (b *coalesceBacklog) removeEntry(entry *coalescedEvent) {
+	for i, e := range b.entries {
+		if e == entry {
+			b.entries = append(b.entries[:i], b.entries[i+1:]...)
+			break
+		}
+	}
+	delete(b.byKey, entry.key)
+}
+
+func (b *coalesceBacklog) peek() (events.Event, uint64, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if len(b.entries) == 0 {
+		return events.Event{}, 0, false
+	}
+	return b.entries[0].event, b.entries[0].token, true
+}
+
+func (b *coalesceBacklog) remove(token uint64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if len(b.entries) == 0 || b.entries[0].token != token {
+		return
+	}
+	head := b.entries[0]
+	b.entries[0] = nil
+	b.entries = b.entries[1:]
+	if head.key != "" {
+		delete(b.byKey, head.key)
+	}
+	if head.taskKey != "" && b.lastOfTask[head.taskKey] == head {
+		delete(b.lastOfTask, head.taskKey)
+	}
+}
+
+func (b *coalesceBacklog) len() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return len(b.entries)
+}
+
+func (b *coalesceBacklog) close() error {
+	return nil
+}
+
+// spillBacklog appends events to a file as JSON lines and reads them back in the same order.
+// File is truncated whenever all events were read. On close the file is compacted to events
+// left in it, they are read after the next start. After a crash already read events are read again.
+type spillBacklog struct {
+	lock    sync.Mutex
+	path    string
+	writer  *os.File
+	file    *os.File
+	reader  *bufio.Reader
+	pending int
+	head    *events.Event
+	token   uint64
+}
+
+func newSpillBacklog(path string) (*spillBacklog, error) {
+	if path == "" {
+		return nil, fmt.Errorf("Spill file is required by %s overflow policy", OverflowSpill)
+	}
+	writer, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open spill file: %s", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("Could not open spill file: %s", err)
+	}
+	b := &spillBacklog{path: path, writer: writer, file: file, reader: bufio.NewReader(file)}
+	if b.pending, err = countLines(path); err != nil {
+		b.close()
+		return nil, fmt.Errorf("Could not read spill file: %s", err)
+	}
+	if b.pending > 0 {
+		log.WithField("File", path).WithField("Events", b.pending).Info("Events left in spill file will be processed")
+	}
+	return b, nil
+}
+
+func (b *spillBacklog) push(e events.Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if _, err := b.writer.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	b.pending++
+	return nil
+}
+
+func (b *spillBacklog) peek() (events.Event, uint64, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for b.head == nil && b.pending > 0 {
+		line, err := b.reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			log.WithError(err).WithField("File", b.path).Error("Could not read spill file")
+			return events.Event{}, 0, false
+		}
+		e := events.Event{}
+		if err := json.Unmarshal(line, &e); err != nil {
+			log.WithError(err).WithField("File", b.path).Error("Skipping invalid event in spill file")
+			b.consumed()
+			continue
+		}
+		b.token++
+		b.head = &e
+	}
+	if b.head == nil {
+		return events.Event{}, 0, false
+	}
+	return *b.head, b.token, true
+}
+
+func (b *spillBacklog) remove(token uint64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.head == nil || b.token != token {
+		return
+	}
+	b.head = nil
+	b.consumed()
+}
+
+// consumed decreases number of pending events and truncates the file when all of them were read
+func (b *spillBacklog) consumed() {
+	b.pending--
+	if b.pending > 0 {
+		return
+	}
+	b.pending = 0
+	if err := b.writer.Truncate(0); err != nil {
+		log.WithError(err).WithField("File", b.path).Warn("Could not truncate spill file")
+		return
+	}
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		log.WithError(err).WithField("File", b.path).Warn("Could not rewind spill file")
+	}
+	b.reader.Reset(b.file)
+}
+
+func (b *spillBacklog) len() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.pending
+}
+
+func (b *spillBacklog) close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var remaining []byte
+	var err error
+	if b.pending > 0 {
+		remaining, err = b.unread()
+	}
+	b.file.Close()
+	if closeErr := b.writer.Close(); closeErr != nil {
+		return closeErr
+	}
+	if err != nil || b.pending == 0 {
+		return err
+	}
+	compacted := b.path + ".tmp"
+	if err := ioutil.WriteFile(compacted, remaining, 0644); err != nil {
+		return err
+	}
+	return os.Rename(compacted, b.path)
+}
+
+// unread returns lines of events not put into the queue yet
+func (b *spillBacklog) unread() ([]byte, error) {
+	var remaining []byte
+	if b.head != nil {
+		line, err := json.Marshal(b.head)
+		if err != nil {
+			return nil, err
+		}
+		remaining = append(line, '\n')
+	}
+	rest, err := ioutil.ReadAll(b.reader)
+	return append(remaining, rest...), err
+}
+
+func countLines(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	lines := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			lines++
+		}
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return lines, err
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package sse
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/allegro/marathon-consul/apps"
+	"github.com/allegro/marathon-consul/events"
+	"github.com/allegro/marathon-consul/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// OverflowPolicy decides what happens with events read from the stream when the events queue is full
+type OverflowPolicy string
+
+const (
+	// Events are dropped
+	OverflowDrop OverflowPolicy = "drop"
+	// Reading the stream is blocked until the queue has room, event is dropped when it does not happen in time
+	OverflowBlock OverflowPolicy = "block"
+	// Events are written to a file and moved to the queue in the same order when it has room
+	OverflowSpill OverflowPolicy = "spill"
+	// Events are kept in memory and moved to the queue when it has room,
+	// only the latest event of a task (or of a terminated app) is kept
+	OverflowCoalesce OverflowPolicy = "coalesce"
+)
+
+// ParseOverflowPolicy parses policy name, empty value means OverflowDrop
+func ParseOverflowPolicy(value string) (OverflowPolicy, error) {
+	switch policy := OverflowPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case OverflowDrop, OverflowBlock, OverflowSpill, OverflowCoalesce:
+		return policy, nil
+	case "":
+		return OverflowDrop, nil
+	default:
+		return "", fmt.Errorf("Unknown events queue overflow policy %q, expected one of: %s, %s, %s, %s",
+			value, OverflowDrop, OverflowBlock, OverflowSpill, OverflowCoalesce)
+	}
+}
+
+// backlog holds events that did not fit into the events queue.
+// Head of the backlog is removed only after it was put into the queue, so new events
+// are appended behind it and the order of events is kept.
+type backlog interface {
+	push(e events.Event) error
+	// peek returns the head with a token identifying it
+	peek() (events.Event, uint64, bool)
+	// remove removes the head if it still has given token, i.e., it was not replaced in the meantime
+	remove(token uint64)
+	len() int
+	close() error
+}
+
+// overflowQueue puts events into the events queue applying the overflow policy when it is full.
+// Apps of dropped events are resynced, so their services don't stay stale until the next sync.
+// Backlog and resyncs are moved to the queue by a separate goroutine.
+type overflowQueue struct {
+	policy       OverflowPolicy
+	blockTimeout time.Duration
+	queue        chan events.Event
+	backlog      backlog
+	journal      events.Journal
+	metrics      metrics.Scope
+
+	lock      sync.Mutex
+	resyncs   []apps.AppID
+	scheduled map[apps.AppID]struct{}
+
+	wakeUp   chan struct{}
+	done     chan struct{}
+	finished chan struct{}
+	stopOnce sync.Once
+}
+
+func newOverflowQueue(queue chan events.Event, policy OverflowPolicy, blockTimeout time.Duration, spillFile string) (*overflowQueue, error) {
+	q := &overflowQueue{
+		policy:       policy,
+		blockTimeout: blockTimeout,
+		queue:        queue,
+		scheduled:    make(map[apps.AppID]struct{}),
+		wakeUp:       make(chan struct{}, 1),
+		done:         make(chan struct{}),
+		finished:     make(chan struct{}),
+	}
+	switch policy {
+	case OverflowSpill:
+		spill, err := newSpillBacklog(spillFile)
+		if err != nil {
+			return nil, err
+		}
+		q.backlog = spill
+	case OverflowCoalesce:
+		q.backlog = newCoalesceBacklog()
+	}
+	go q.run()
+	return q, nil
+}
+
+// put enqueues the event, it returns false when the event was dropped
+func (q *overflowQueue) put(e events.Event) bool {
+	switch q.policy {
+	case OverflowBlock:
+		select {
+		case q.queue <- e:
+			return true
+		default:
+		}
+		q.metrics.Mark("events.queue.overflow")
+		timer := time.NewTimer(q.blockTimeout)
+		defer timer.Stop()
+		select {
+		case q.queue <- e:
+			return true
+		case <-timer.C:
+			q.drop(e, "Events queue full for too long. Dropping the event")
+		case <-q.done:
+			q.drop(e, "Events queue stopped. Dropping the event")
+		}
+		return false
+	case OverflowSpill, OverflowCoalesce:
+		if q.backlog.len() == 0 {
+			select {
+			case q.queue <- e:
+				return true
+			default:
+			}
+		}
+		if err := q.backlog.push(e); err != nil {
+			log.WithError(err).Error("Could not put event into events backlog")
+			q.drop(e, "Events queue full. Dropping the event")
+			return false
+		}
+		q.metrics.Mark("events.queue.overflow")
+		q.notify()
+		return true
+	default:
+		select {
+		case q.queue <- e:
+			return true
+		default:
+			q.drop(e, "Events queue full. Dropping the event")
+			return false
+		}
+	}
+}
+
+func (q *overflowQueue) drop(e events.Event, reason string) {
+	log.WithField("EventType", e.EventType).Error(reason)
+	q.metrics.Mark("events.read.drop")
+	if q.journal != nil {
+		q.journal.Dropped(e)
+	}
+	q.scheduleResync(events.AffectedAppIDs(e))
+}
+
+func (q *overflowQueue) scheduleResync(appIDs []apps.AppID) {
+	if len(appIDs) == 0 {
+		return
+	}
+	q.lock.Lock()
+	for _, appID := range appIDs {
+		if _, ok := q.scheduled[appID]; !ok {
+			log.WithField("AppId", appID).Info("Scheduling app resync")
+			q.scheduled[appID] = struct{}{}
+			q.resyncs = append(q.resyncs, appID)
+		}
+	}
+	q.lock.Unlock()
+	q.notify()
+}
+
+func (q *overflowQueue) notify() {
+	notify(q.wakeUp)
+}
+
+func (q *overflowQueue) run() {
+	defer close(q.finished)
+	for {
+		for q.moveBacklogHead() || q.moveResync() {
+		}
+		select {
+		case <-q.wakeUp:
+		case <-q.done:
+			return
+		}
+	}
+}
+
+// moveBacklogHead blocks until the head of the backlog is put into the queue, it returns false when there is nothing to move
+func (q *overflowQueue) moveBacklogHead() bool {
+	if q.backlog == nil {
+		return false
+	}
+	e, token, ok := q.backlog.peek()
+	if !ok {
+		return false
+	}
+	select {
+	case q.queue <- e:
+		q.backlog.remove(token)
+		return true
+	case <-q.done:
+		return false
+	}
+}
+
+func (q *overflowQueue) moveResync() bool {
+	q.lock.Lock()
+	if len(q.resyncs) == 0 {
+		q.lock.Unlock()
+		return false
+	}
+	appID := q.resyncs[0]
+	q.lock.Unlock()
+
+	select {
+	case q.queue <- events.NewResyncAppEvent(appID):
+		q.lock.Lock()
+		q.resyncs = q.resyncs[1:]
+		delete(q.scheduled, appID)
+		q.lock.Unlock()
+		return true
+	case <-q.done:
+		return false
+	}
+}
+
+// pending returns number of events waiting in the backlog and apps waiting for resync
+func (q *overflowQueue) pending() (backlog int, resyncs int) {
+	if q.backlog != nil {
+		backlog = q.backlog.len()
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return backlog, len(q.resyncs)
+}
+
+// stop stops moving events to the queue. Spilled events are left in the file for the next start.
+func (q *overflowQueue) stop() {
+	q.stopOnce.Do(func() {
+		close(q.done)
+		<-q.finished
+		backlog, resyncs := q.pending()
+		if backlog > 0 || resyncs > 0 {
+			log.WithField("Backlog", backlog).WithField("Resyncs", resyncs).Warn("Events left in events backlog on stop")
+		}
+		if q.backlog != nil {
+			if err := q.backlog.close(); err != nil {
+				log.WithError(err).Error("Could not close events backlog")
+			}
+		}
+	})
+}
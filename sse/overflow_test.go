@@ -0,0 +1,187 @@
+package sse
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/allegro/marathon-consul/apps"
+	"github.com/allegro/marathon-consul/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var parseOverflowPolicyTestsData = []struct {
+	value    string
+	expected OverflowPolicy
+	err      bool
+}{
+	{"", OverflowDrop, false},
+	{"drop", OverflowDrop, false},
+	{" Block ", OverflowBlock, false},
+	{"spill", OverflowSpill, false},
+	{"COALESCE", OverflowCoalesce, false},
+	{"retry", "", true},
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	t.Parallel()
+	for _, testCase := range parseOverflowPolicyTestsData {
+		// when
+		policy, err := ParseOverflowPolicy(testCase.value)
+
+		// then
+		assert.Equal(t, testCase.expected, policy, testCase.value)
+		assert.Equal(t, testCase.err, err != nil, testCase.value)
+	}
+}
+
+func TestOverflowQueue_DropShouldScheduleResyncOfAffectedApp(t *testing.T) {
+	t.Parallel()
+	// given
+	queue := make(chan events.Event, 1)
+	overflow, err := newOverflowQueue(queue, OverflowDrop, 0, "")
+	require.NoError(t, err)
+	defer overflow.stop()
+	journal := &journalMock{}
+	overflow.journal = journal
+
+	// when
+	accepted := overflow.put(statusUpdate("/app", "app.1", 1))
+	dropped := overflow.put(statusUpdate("/app", "app.2", 2))
+	overflow.put(statusUpdate("/app", "app.3", 3))
+
+	// then
+	assert.True(t, accepted)
+	assert.False(t, dropped)
+	assert.Equal(t, []uint64{2, 3}, journal.dropped)
+	assert.Equal(t, uint64(1), (<-queue).Seq)
+	resync := <-queue
+	assert.Equal(t, events.ResyncAppEventType, resync.EventType)
+	assert.JSONEq(t, `{"appId":"/app"}`, string(resync.Body))
+	eventually(t, func() bool {
+		_, resyncs := overflow.pending()
+		return resyncs == 0
+	})
+	assert.Empty(t, queue)
+}
+
+func TestOverflowQueue_BlockShouldWaitForRoomInQueue(t *testing.T) {
+	t.Parallel()
+	// given
+	queue := make(chan events.Event, 1)
+	overflow, err := newOverflowQueue(queue, OverflowBlock, time.Second, "")
+	require.NoError(t, err)
+	defer overflow.stop()
+	overflow.put(statusUpdate("/app", "app.1", 1))
+	go func() {
+		<-time.After(20 * time.Millisecond)
+		<-queue
+	}()
+
+	// when
+	accepted := overflow.put(statusUpdate("/app", "app.2", 2))
+
+	// then
+	assert.True(t, accepted)
+	assert.Equal(t, uint64(2), (<-queue).Seq)
+}
+
+func TestOverflowQueue_BlockShouldDropAfterTimeout(t *testing.T) {
+	t.Parallel()
+	// given
+	queue := make(chan events.Event, 1)
+	overflow, err := newOverflowQueue(queue, OverflowBlock, 10*time.Millisecond, "")
+	require.NoError(t, err)
+	overflow.put(statusUpdate("/app", "app.1", 1))
+
+	// when
+	accepted := overflow.put(statusUpdate("/other", "other.1", 2))
+
+	// then
+	assert.False(t, accepted)
+	overflow.stop()
+	_, resyncs := overflow.pending()
+	assert.Equal(t, 1, resyncs)
+}
+
+func TestOverflowQueue_CoalesceShouldKeepOrderAndLatestEventOfTask(t *testing.T) {
+	t.Parallel()
+	// given
+	queue := make(chan events.Event, 1)
+	overflow, err := newOverflowQueue(queue, OverflowCoalesce, 0, "")
+	require.NoError(t, err)
+	defer overflow.stop()
+
+	// when
+	overflow.put(statusUpdate("/app", "app.1", 1))
+	overflow.put(statusUpdate("/app", "app.2", 2))
+	overflow.put(statusUpdate("/app", "app.3", 3))
+	overflow.put(statusUpdate("/app", "app.2", 4))
+
+	// then
+	var received []uint64
+	for i := 0; i < 3; i++ {
+		received = append(received, (<-queue).Seq)
+	}
+	assert.Equal(t, []uint64{1, 4, 3}, received)
+}
+
+func TestOverflowQueue_SpillShouldKeepOrderAndSurviveRestart(t *testing.T) {
+	t.Parallel()
+	// given
+	file := filepath.Join(t.TempDir(), "spill.log")
+	queue := make(chan events.Event, 1)
+	overflow, err := newOverflowQueue(queue, OverflowSpill, 0, file)
+	require.NoError(t, err)
+
+	// when
+	for seq := uint64(1); seq <= 4; seq++ {
+		assert.True(t, overflow.put(statusUpdate("/app", "app.1", seq)))
+	}
+	assert.Equal(t, uint64(1), (<-queue).Seq)
+	assert.Equal(t, uint64(2), (<-queue).Seq)
+	eventually(t, func() bool { return len(queue) == 1 })
+	overflow.stop()
+	<-queue
+
+	// then
+	restarted, err := newOverflowQueue(queue, OverflowSpill, 0, file)
+	require.NoError(t, err)
+	defer restarted.stop()
+	assert.Equal(t, uint64(4), (<-queue).Seq)
+	eventually(t, func() bool {
+		backlog, _ := restarted.pending()
+		return backlog == 0
+	})
+	assert.True(t, restarted.put(statusUpdate("/app", "app.1", 5)))
+	assert.Equal(t, uint64(5), (<-queue).Seq)
+}
+
+func TestOverflowQueue_SpillRequiresFile(t *testing.T) {
+	t.Parallel()
+	// when
+	_, err := newOverflowQueue(make(chan events.Event), OverflowSpill, 0, "")
+
+	// then
+	assert.EqualError(t, err, "Spill file is required by spill overflow policy")
+}
+
+func statusUpdate(appID apps.AppID, taskID apps.TaskID, seq uint64) events.Event {
+	return events.Event{
+		Timestamp: time.Now(),
+		EventType: events.StatusUpdateEventType,
+		Body:      []byte(`{"appId":"` + appID.String() + `","taskId":"` + taskID.String() + `","taskStatus":"TASK_KILLED"}`),
+		Seq:       seq,
+	}
+}
+
+type journalMock struct {
+	dropped []uint64
+}
+
+func (j *journalMock) Received(e *events.Event)            {}
+func (j *journalMock) Processed(e events.Event, err error) {}
+func (j *journalMock) Dropped(e events.Event) {
+	j.dropped = append(j.dropped, e.Seq)
+}
@@ -0,0 +1,201 @@
+package sse
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/allegro/marathon-consul/events"
+	"github.com/allegro/marathon-consul/metrics"
+)
+
+// partitions move events from the events queue to workers. Events of one app always go to the same worker,
+// so events of a task are processed one at a time in the order they were read. Pending event of a task
+// is replaced in place by its later event of the same type, e.g., only the latest health status is processed.
+// Events concerning many apps (deployments) are routed by their first app, events without an app
+// are spread across workers.
+type partitions struct {
+	queue      <-chan events.Event
+	partitions []*partition
+	capacity   int
+	next       uint32
+	// retries of events superseded by events read from the queue are dropped
+	retries *retryQueue
+	metrics metrics.Scope
+
+	done     chan struct{}
+	finished sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// partition holds events waiting for a single worker
+type partition struct {
+	backlog *coalesceBacklog
+	// worker reads events from this channel
+	out    chan events.Event
+	wakeUp chan struct{}
+	room   chan struct{}
+	// event passed to the worker most recently, it is processed until the worker takes the next one
+	delivered *events.Event
+}
+
+// newPartitions creates given number of partitions sharing queueSize equally and starts moving events.
+// Without partitions events stay in the queue. Retries may be nil.
+func newPartitions(queue <-chan events.Event, count int, queueSize int, retries *retryQueue) *partitions {
+	capacity := 1
+	if count > 0 && queueSize/count > 1 {
+		capacity = queueSize / count
+	}
+	p := &partitions{
+		queue:    queue,
+		capacity: capacity,
+		retries:  retries,
+		done:     make(chan struct{}),
+	}
+	for i := 0; i < count; i++ {
+		p.partitions = append(p.partitions, &partition{
+			backlog: newCoalesceBacklog(),
+			out:     make(chan events.Event),
+			wakeUp:  make(chan struct{}, 1),
+			room:    make(chan struct{}, 1),
+		})
+	}
+	if count < 1 {
+		return p
+	}
+	p.finished.Add(len(p.partitions) + 1)
+	for _, partition := range p.partitions {
+		go p.feed(partition)
+	}
+	go p.dispatch()
+	return p
+}
+
+// worker returns channel from which i-th worker reads its events
+func (p *partitions) worker(i int) <-chan events.Event {
+	return p.partitions[i].out
+}
+
+func (p *partitions) dispatch() {
+	defer p.finished.Done()
+	for {
+		select {
+		case e := <-p.queue:
+			p.updateQueueMetrics()
+			if !p.put(p.partitionFor(e), e) {
+				return
+			}
+			// after put, so retry of a failed event is either cancelled here or sees this event in flight
+			if p.retries != nil {
+				p.retries.superseded(e)
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *partitions) updateQueueMetrics() {
+	queueLength := int64(len(p.queue))
+	p.metrics.UpdateGauge("events.queue.len", queueLength)
+	utilization := int64(0)
+	if queueCapacity := int64(cap(p.queue)); queueCapacity > 0 {
+		utilization = 100 * queueLength / queueCapacity
+	}
+	p.metrics.UpdateGauge("events.queue.util", utilization)
+}
+
+func (p *partitions) partitionFor(e events.Event) *partition {
+	if appIDs := events.AffectedAppIDs(e); len(appIDs) > 0 {
+		hash := fnv.New32a()
+		hash.Write([]byte(appIDs[0]))
+		return p.partitions[hash.Sum32()%uint32(len(p.partitions))]
+	}
+	return p.partitions[atomic.AddUint32(&p.next, 1)%uint32(len(p.partitions))]
+}
+
+// putRetried puts the event retried after failure to its partition
+func (p *partitions) putRetried(e events.Event) bool {
+	if len(p.partitions) == 0 {
+		return false
+	}
+	return p.put(p.partitionFor(e), e)
+}
+
+// put blocks until the partition has room for the event, it returns false when partitions were stopped
+func (p *partitions) put(partition *partition, e events.Event) bool {
+	for partition.backlog.len() >= p.capacity {
+		select {
+		case <-partition.room:
+		case <-p.done:
+			return false
+		}
+	}
+	coalesced := partition.backlog.add(e)
+	if coalesced {
+		p.metrics.Mark("events.coalesced")
+	}
+	if p.retries != nil {
+		p.retries.entered(e, coalesced)
+	}
+	notify(partition.wakeUp)
+	return true
+}
+
+// feed passes events of the partition to its worker one by one
+func (p *partitions) feed(partition *partition) {
+	defer p.finished.Done()
+	for {
+		e, token, ok := partition.backlog.peek()
+		if !ok {
+			select {
+			case <-partition.wakeUp:
+				continue
+			case <-p.done:
+				return
+			}
+		}
+		select {
+		case partition.out <- e:
+			partition.backlog.remove(token)
+			notify(partition.room)
+			if p.retries != nil {
+				if partition.delivered != nil {
+					p.retries.processed(*partition.delivered)
+				}
+				partition.delivered = &e
+			}
+		case <-partition.wakeUp:
+			// head could be replaced by a later event of the same task
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// pending returns number of events waiting in partitions
+func (p *partitions) pending() int {
+	pending := 0
+	for _, partition := range p.partitions {
+		pending += partition.backlog.len()
+	}
+	return pending
+}
+
+// stop stops moving events to workers, events left in partitions are dropped
+func (p *partitions) stop() {
+	p.stopOnce.Do(func() {
+		close(p.done)
+		p.finished.Wait()
+		if pending := p.pending(); pending > 0 {
+			p.metrics.UpdateGauge("events.queue.dropped_on_shutdown", int64(pending+len(p.queue)))
+		}
+	})
+}
+
+func notify(channel chan struct{}) {
+	select {
+	case channel <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,141 @@
+package sse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/allegro/marathon-consul/apps"
+	"github.com/allegro/marathon-consul/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitions_ShouldPassEventsOfAppToTheSameWorkerInOrder(t *testing.T) {
+	t.Parallel()
+	// given
+	queue := make(chan events.Event, 10)
+	partitions := newPartitions(queue, 3, 10, nil)
+	defer partitions.stop()
+
+	// when
+	queue <- statusUpdate("/app", "app.1", 1)
+	queue <- healthChanged("/app", "app.1", 2)
+	queue <- statusUpdate("/app", "app.2", 3)
+
+	// then
+	worker := workerOf(t, partitions, 1)
+	assert.Equal(t, uint64(2), receive(t, worker).Seq)
+	assert.Equal(t, uint64(3), receive(t, worker).Seq)
+}
+
+func TestPartitions_ShouldCoalescePendingEventsOfTask(t *testing.T) {
+	t.Parallel()
+	// given
+	queue := make(chan events.Event, 10)
+	partitions := newPartitions(queue, 1, 10, nil)
+	defer partitions.stop()
+	worker := partitions.worker(0)
+	queue <- healthChanged("/app", "app.1", 1)
+	assert.Equal(t, uint64(1), receive(t, worker).Seq)
+
+	// when
+	queue <- healthChanged("/app", "app.1", 2)
+	queue <- statusUpdate("/app", "app.1", 3)
+	queue <- healthChanged("/app", "app.1", 4)
+	eventually(t, func() bool { return len(queue) == 0 })
+
+	// then
+	assert.Equal(t, uint64(3), receive(t, worker).Seq)
+	assert.Equal(t, uint64(4), receive(t, worker).Seq)
+	eventually(t, func() bool { return partitions.pending() == 0 })
+}
+
+func TestPartitions_ShouldKeepOrderOfTaskEventsWhenCoalescing(t *testing.T) {
+	t.Parallel()
+	// given
+	queue := make(chan events.Event, 10)
+	partitions := newPartitions(queue, 1, 10, nil)
+	defer partitions.stop()
+	worker := partitions.worker(0)
+	queue <- healthChanged("/app", "app.1", 1)
+	assert.Equal(t, uint64(1), receive(t, worker).Seq)
+
+	// when
+	queue <- statusUpdate("/app", "app.1", 2)
+	queue <- healthChanged("/app", "app.1", 3)
+	queue <- statusUpdate("/app", "app.2", 4)
+	queue <- statusUpdate("/app", "app.1", 5)
+	queue <- statusUpdate("/app", "app.2", 6)
+	eventually(t, func() bool { return len(queue) == 0 })
+
+	// then
+	assert.Equal(t, uint64(3), receive(t, worker).Seq)
+	assert.Equal(t, uint64(6), receive(t, worker).Seq)
+	assert.Equal(t, uint64(5), receive(t, worker).Seq)
+	eventually(t, func() bool { return partitions.pending() == 0 })
+}
+
+func TestPartitions_ShouldNotMoveEventsWithoutWorkers(t *testing.T) {
+	t.Parallel()
+	// given
+	queue := make(chan events.Event, 10)
+	partitions := newPartitions(queue, 0, 10, nil)
+
+	// when
+	queue <- statusUpdate("/app", "app.1", 1)
+	partitions.stop()
+
+	// then
+	assert.Len(t, queue, 1)
+}
+
+// workerOf returns channel of the worker that receives the first event, failing when the event is not received
+func workerOf(t *testing.T, partitions *partitions, seq uint64) <-chan events.Event {
+	deadline := time.After(time.Second)
+	for {
+		for i := range partitions.partitions {
+			select {
+			case e := <-partitions.worker(i):
+				assert.Equal(t, seq, e.Seq)
+				return partitions.worker(i)
+			default:
+			}
+		}
+		select {
+		case <-deadline:
+			t.Fatal("Event was not passed to any worker")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+// eventually waits until the condition is met, failing the test after a second.
+// assert.Eventually of the used testify version panics when the condition is still being checked on return.
+func eventually(t *testing.T, condition func() bool) {
+	deadline := time.After(time.Second)
+	for !condition() {
+		select {
+		case <-deadline:
+			t.Fatal("Condition never satisfied")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func receive(t *testing.T, worker <-chan events.Event) events.Event {
+	select {
+	case e := <-worker:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("Event was not passed to the worker")
+		return events.Event{}
+	}
+}
+
+func healthChanged(appID apps.AppID, taskID apps.TaskID, seq uint64) events.Event {
+	return events.Event{
+		Timestamp: time.Now(),
+		EventType: events.HealthStatusChangedEventType,
+		Body:      []byte(`{"appId":"` + appID.String() + `","taskId":"` + taskID.String() + `","alive":true}`),
+		Seq:       seq,
+	}
+}
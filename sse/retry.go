@@ -0,0 +1,279 @@
+package sse
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/allegro/marathon-consul/events"
+	"github.com/allegro/marathon-consul/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// DeadLetter describes an event that failed too many times or can't be processed at all
+type DeadLetter struct {
+	Time      time.Time `json:"time"`
+	EventType string    `json:"eventType"`
+	Seq       uint64    `json:"seq,omitempty"`
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error"`
+	Body      string    `json:"body"`
+}
+
+// retryQueue puts failed events back to partitions after exponential backoff.
+// Event that failed maxAttempts times or with an error that is not retriable is moved to dead letters.
+// Waiting retry is dropped when a later event of the same task (of any type) is read, so retry never undoes newer state.
+// For the same reason failed event is not retried when a later event of its task was read before it failed
+// (e.g., it waits in a partition), read order is given by Seq.
+type retryQueue struct {
+	maxAttempts     int
+	backoff         time.Duration
+	maxBackoff      time.Duration
+	deadLettersSize int
+	put             func(events.Event) bool
+	metrics         metrics.Scope
+
+	lock    sync.Mutex
+	waiting map[*retry]struct{}
+	byKey   map[string]*retry
+	letters []DeadLetter
+	stopped bool
+	// events in partitions or being processed by workers, by supersede key
+	inFlight map[string]*flight
+}
+
+// flight counts events of a key in partitions or being processed and remembers the last read of them
+type flight struct {
+	events  int
+	lastSeq uint64
+}
+
+type retry struct {
+	event events.Event
+	key   string
+	timer *time.Timer
+}
+
+func newRetryQueue(maxAttempts int, backoff, maxBackoff time.Duration, deadLettersSize int, put func(events.Event) bool) *retryQueue {
+	return &retryQueue{
+		maxAttempts:     maxAttempts,
+		backoff:         backoff,
+		maxBackoff:      maxBackoff,
+		deadLettersSize: deadLettersSize,
+		put:             put,
+		waiting:         make(map[*retry]struct{}),
+		byKey:           make(map[string]*retry),
+		inFlight:        make(map[string]*flight),
+	}
+}
+
+// Retry schedules the event to be processed again or moves it to dead letters
+func (q *retryQueue) Retry(e events.Event, err error) {
+	e.Attempt++
+	key := events.SupersedeKey(e)
+	if events.Retriable(err) && q.readLater(e, key) {
+		log.WithError(err).WithField("EventType", e.EventType).WithField("Seq", e.Seq).
+			Info("Not retrying failed event, a later event of the same task was read")
+		q.metrics.Mark("events.retry.superseded")
+		return
+	}
+	if !events.Retriable(err) || e.Attempt > q.maxAttempts {
+		q.deadLetter(e, err)
+		return
+	}
+	delay := q.delay(e.Attempt)
+	log.WithError(err).WithField("EventType", e.EventType).WithField("Attempt", e.Attempt).
+		WithField("Delay", delay).Warn("Retrying failed event")
+	q.metrics.Mark("events.retry")
+
+	r := &retry{event: e, key: key}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.stopped {
+		return
+	}
+	if previous, ok := q.byKey[r.key]; ok && r.key != "" {
+		q.cancel(previous)
+	}
+	q.waiting[r] = struct{}{}
+	if r.key != "" {
+		q.byKey[r.key] = r
+	}
+	r.timer = time.AfterFunc(delay, func() { q.due(r) })
+}
+
+// delay returns backoff doubled for every failed attempt but the first one, limited by positive maxBackoff
+func (q *retryQueue) delay(attempt int) time.Duration {
+	delay := q.backoff
+	for i := 1; i < attempt && (q.maxBackoff <= 0 || delay < q.maxBackoff); i++ {
+		delay *= 2
+	}
+	if q.maxBackoff > 0 && delay > q.maxBackoff {
+		delay = q.maxBackoff
+	}
+	return delay
+}
+
+func (q *retryQueue) due(r *retry) {
+	q.lock.Lock()
+	if _, ok := q.waiting[r]; !ok {
+		q.lock.Unlock()
+		return
+	}
+	q.remove(r)
+	q.lock.Unlock()
+	if !q.put(r.event) {
+		log.WithField("EventType", r.event.EventType).Warn("Events processing stopped. Dropping retried event")
+	}
+}
+
+// superseded drops waiting retry of the same task as given event read from the stream
+func (q *retryQueue) superseded(e events.Event) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if len(q.byKey) == 0 {
+		return
+	}
+	if r, ok := q.byKey[events.SupersedeKey(e)]; ok {
+		log.WithField("EventType", r.event.EventType).Debug("Dropping retry superseded by a later event")
+		q.metrics.Mark("events.retry.superseded")
+		q.cancel(r)
+	}
+}
+
+// entered records the event put into a partition, coalesced is true when it replaced a pending event of the same task
+func (q *retryQueue) entered(e events.Event, coalesced bool) {
+	key := events.SupersedeKey(e)
+	if key == "" {
+		return
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	f, ok := q.inFlight[key]
+	if !ok {
+		f = &flight{}
+		q.inFlight[key] = f
+	}
+	if !coalesced {
+		f.events++
+	}
+	if e.Seq > f.lastSeq {
+		f.lastSeq = e.Seq
+	}
+}
+
+// processed records the event was processed by a worker
+func (q *retryQueue) processed(e events.Event) {
+	key := events.SupersedeKey(e)
+	if key == "" {
+		return
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if f, ok := q.inFlight[key]; ok {
+		f.events--
+		if f.events <= 0 {
+			delete(q.inFlight, key)
+		}
+	}
+}
+
+// readLater checks if an event of the same key read after given one is in a partition or being processed
+func (q *retryQueue) readLater(e events.Event, key string) bool {
+	if key == "" || e.Seq == 0 {
+		return false
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	f, ok := q.inFlight[key]
+	return ok && f.lastSeq > e.Seq
+}
+
+func (q *retryQueue) cancel(r *retry) {
+	r.timer.Stop()
+	q.remove(r)
+}
+
+func (q *retryQueue) remove(r *retry) {
+	delete(q.waiting, r)
+	if q.byKey[r.key] == r {
+		delete(q.byKey, r.key)
+	}
+}
+
+func (q *retryQueue) deadLetter(e events.Event, err error) {
+	log.WithError(err).WithField("EventType", e.EventType).WithField("Attempts", e.Attempt).
+		Error("Giving up processing event, moving it to dead letters")
+	q.metrics.Mark("events.dead_letter")
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.deadLettersSize <= 0 {
+		return
+	}
+	if len(q.letters) >= q.deadLettersSize {
+		q.letters = q.letters[len(q.letters)-q.deadLettersSize+1:]
+	}
+	q.letters = append(q.letters, DeadLetter{
+		Time:      time.Now(),
+		EventType: e.EventType,
+		Seq:       e.Seq,
+		Attempts:  e.Attempt,
+		Error:     err.Error(),
+		Body:      string(e.Body),
+	})
+}
+
+// deadLetters returns copy of dead letters, the oldest first
+func (q *retryQueue) deadLetters() []DeadLetter {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return append([]DeadLetter{}, q.letters...)
+}
+
+func (q *retryQueue) clearDeadLetters() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.letters = nil
+}
+
+func (q *retryQueue) pending() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.waiting)
+}
+
+// stop cancels waiting retries, their events are lost
+func (q *retryQueue) stop() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.stopped = true
+	if len(q.waiting) > 0 {
+		log.WithField("Retries", len(q.waiting)).Warn("Failed events waiting for retry dropped on stop")
+	}
+	for r := range q.waiting {
+		q.cancel(r)
+	}
+}
+
+// deadLettersHandler responds with dead letters on GET and clears them on DELETE
+func (q *retryQueue) deadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, q.deadLetters())
+	case http.MethodDelete:
+		q.clearDeadLetters()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodDelete)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Only GET and DELETE methods are allowed"})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.WithError(err).Error("Could not write response")
+	}
+}
@@ -0,0 +1,308 @@
+package sse
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/allegro/marathon-consul/apps"
+	"github.com/allegro/marathon-consul/consul"
+	"github.com/allegro/marathon-consul/events"
+	"github.com/allegro/marathon-consul/marathon"
+	"github.com/allegro/marathon-consul/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var retryDelayTestsData = []struct {
+	attempt    int
+	maxBackoff time.Duration
+	expected   time.Duration
+}{
+	{1, time.Minute, time.Second},
+	{2, time.Minute, 2 * time.Second},
+	{4, time.Minute, 8 * time.Second},
+	{10, time.Minute, time.Minute},
+	{10, 0, 512 * time.Second},
+}
+
+func TestRetryQueue_Delay(t *testing.T) {
+	t.Parallel()
+	for _, testCase := range retryDelayTestsData {
+		// given
+		retries := newRetryQueue(10, time.Second, testCase.maxBackoff, 0, nil)
+
+		// when
+		delay := retries.delay(testCase.attempt)
+
+		// then
+		assert.Equal(t, testCase.expected, delay, "attempt %d", testCase.attempt)
+	}
+}
+
+func TestRetryQueue_ShouldPutFailedEventAgainAfterBackoff(t *testing.T) {
+	t.Parallel()
+	// given
+	retried := make(chan events.Event, 1)
+	retries := newRetryQueue(3, time.Millisecond, time.Millisecond, 10, putTo(retried))
+	defer retries.stop()
+
+	// when
+	retries.Retry(statusUpdate("/app", "app.1", 1), errors.New("Consul agent unavailable"))
+
+	// then
+	e := <-retried
+	assert.Equal(t, uint64(1), e.Seq)
+	assert.Equal(t, 1, e.Attempt)
+	assert.Equal(t, 0, retries.pending())
+	assert.Empty(t, retries.deadLetters())
+}
+
+func TestRetryQueue_ShouldMoveEventToDeadLettersAfterMaxAttempts(t *testing.T) {
+	t.Parallel()
+	// given
+	retries := newRetryQueue(2, time.Hour, time.Hour, 10, nil)
+	e := statusUpdate("/app", "app.1", 1)
+	e.Attempt = 2
+
+	// when
+	retries.Retry(e, errors.New("Consul agent unavailable"))
+
+	// then
+	assert.Equal(t, 0, retries.pending())
+	require.Len(t, retries.deadLetters(), 1)
+	deadLetter := retries.deadLetters()[0]
+	assert.Equal(t, events.StatusUpdateEventType, deadLetter.EventType)
+	assert.Equal(t, uint64(1), deadLetter.Seq)
+	assert.Equal(t, 3, deadLetter.Attempts)
+	assert.Equal(t, "Consul agent unavailable", deadLetter.Error)
+	assert.Equal(t, string(e.Body), deadLetter.Body)
+}
+
+func TestRetryQueue_ShouldNotRetryMalformedEvent(t *testing.T) {
+	t.Parallel()
+	// given
+	retries := newRetryQueue(2, time.Hour, time.Hour, 10, nil)
+	_, err := events.ParseTaskHealthChange([]byte("{"))
+	require.Error(t, err)
+
+	// when
+	retries.Retry(healthChanged("/app", "app.1", 1), err)
+
+	// then
+	assert.Equal(t, 0, retries.pending())
+	assert.Len(t, retries.deadLetters(), 1)
+}
+
+func TestRetryQueue_ShouldKeepOnlyLatestDeadLetters(t *testing.T) {
+	t.Parallel()
+	// given
+	retries := newRetryQueue(0, time.Hour, time.Hour, 2, nil)
+
+	// when
+	for seq := uint64(1); seq <= 3; seq++ {
+		retries.Retry(statusUpdate("/app", "app.1", seq), errors.New("error"))
+	}
+
+	// then
+	deadLetters := retries.deadLetters()
+	require.Len(t, deadLetters, 2)
+	assert.Equal(t, uint64(2), deadLetters[0].Seq)
+	assert.Equal(t, uint64(3), deadLetters[1].Seq)
+}
+
+func TestRetryQueue_ShouldDropRetrySupersededByLaterEventOfTask(t *testing.T) {
+	t.Parallel()
+	// given
+	retried := make(chan events.Event, 2)
+	retries := newRetryQueue(3, 20*time.Millisecond, time.Second, 10, putTo(retried))
+	defer retries.stop()
+	retries.Retry(healthChanged("/app", "app.1", 1), errors.New("error"))
+	retries.Retry(healthChanged("/app", "app.2", 2), errors.New("error"))
+
+	// when
+	retries.superseded(healthChanged("/app", "app.1", 3))
+
+	// then
+	assert.Equal(t, uint64(2), (<-retried).Seq)
+	assert.Equal(t, 0, retries.pending())
+	assert.Empty(t, retried)
+}
+
+func TestRetryQueue_ShouldDropRetrySupersededByLaterEventOfTaskOfAnotherType(t *testing.T) {
+	t.Parallel()
+	// given
+	retried := make(chan events.Event, 2)
+	retries := newRetryQueue(3, 20*time.Millisecond, time.Second, 10, putTo(retried))
+	defer retries.stop()
+	retries.Retry(healthChanged("/app", "app.1", 1), errors.New("error"))
+	retries.Retry(statusUpdate("/app", "app.2", 2), errors.New("error"))
+
+	// when
+	retries.superseded(statusUpdate("/app", "app.1", 3))
+	retries.superseded(healthChanged("/app", "app.2", 4))
+
+	// then
+	assert.Equal(t, 0, retries.pending())
+	assert.Empty(t, retried)
+}
+
+func TestRetryQueue_ShouldNotRetryEventWhenLaterEventOfTaskWasRead(t *testing.T) {
+	t.Parallel()
+	// given
+	retried := make(chan events.Event, 1)
+	retries := newRetryQueue(3, time.Millisecond, time.Millisecond, 10, putTo(retried))
+	defer retries.stop()
+	retries.entered(healthChanged("/app", "app.1", 1), false)
+	retries.entered(healthChanged("/app", "app.2", 2), false)
+	retries.entered(healthChanged("/app", "app.1", 3), false)
+
+	// when
+	retries.Retry(healthChanged("/app", "app.1", 1), errors.New("error"))
+	retries.Retry(healthChanged("/app", "app.2", 2), errors.New("error"))
+
+	// then
+	assert.Equal(t, uint64(2), (<-retried).Seq)
+	assert.Equal(t, 0, retries.pending())
+	assert.Empty(t, retries.deadLetters())
+}
+
+func TestRetryQueue_ShouldRetryEventWhenLaterEventOfTaskWasProcessedBeforeIt(t *testing.T) {
+	t.Parallel()
+	// given
+	retried := make(chan events.Event, 1)
+	retries := newRetryQueue(3, time.Millisecond, time.Millisecond, 10, putTo(retried))
+	defer retries.stop()
+	retries.entered(healthChanged("/app", "app.1", 1), false)
+	retries.processed(healthChanged("/app", "app.1", 1))
+	retries.entered(healthChanged("/app", "app.1", 2), false)
+
+	// when
+	retries.Retry(healthChanged("/app", "app.1", 2), errors.New("error"))
+
+	// then
+	assert.Equal(t, uint64(2), (<-retried).Seq)
+}
+
+// deregisterFailingOnce fails the first deregistration when it is released, so events can be queued in the meantime
+type deregisterFailingOnce struct {
+	*consul.Stub
+	calls         int32
+	deregistering chan struct{}
+	release       chan struct{}
+}
+
+func (r *deregisterFailingOnce) DeregisterByTask(taskID apps.TaskID) error {
+	if atomic.AddInt32(&r.calls, 1) == 1 {
+		r.deregistering <- struct{}{}
+		<-r.release
+		return errors.New("Consul agent unavailable")
+	}
+	return r.Stub.DeregisterByTask(taskID)
+}
+
+func TestRetries_FailedEventShouldNotUndoLaterEventWaitingInPartition(t *testing.T) {
+	t.Parallel()
+	// given
+	app := utils.ConsulApp("/test/app", 1)
+	registry := &deregisterFailingOnce{
+		Stub:          consul.NewConsulStub(),
+		deregistering: make(chan struct{}),
+		release:       make(chan struct{}),
+	}
+	require.NoError(t, registry.Register(&app.Tasks[0], app))
+	queue := make(chan events.Event, 10)
+	var partitions *partitions
+	retries := newRetryQueue(3, time.Millisecond, time.Millisecond, 10,
+		func(e events.Event) bool { return partitions.putRetried(e) })
+	partitions = newPartitions(queue, 1, 10, retries)
+	defer partitions.stop()
+	defer retries.stop()
+	handler := events.NewEventHandler(0, registry, marathon.MarathonerStubForApps(app), partitions.worker(0),
+		apps.UnhealthyTaskDeregister)
+	handler.UseRetries(retries)
+	stop := handler.Start()
+	defer func() { stop <- events.StopEvent{} }()
+
+	// when
+	queue <- healthStatus("/test/app", "test_app.0", false, 1)
+	<-registry.deregistering
+	queue <- healthStatus("/test/app", "test_app.0", true, 2)
+	eventually(t, func() bool { return len(queue) == 0 && partitions.pending() == 1 })
+	close(registry.release)
+
+	// then
+	eventually(t, func() bool { return partitions.pending() == 0 })
+	time.Sleep(20 * time.Millisecond)
+	services, err := registry.GetAllServices()
+	require.NoError(t, err)
+	assert.Len(t, services, 1)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&registry.calls))
+	assert.Equal(t, 0, retries.pending())
+	assert.Empty(t, retries.deadLetters())
+}
+
+func TestRetryQueue_StopShouldCancelWaitingRetries(t *testing.T) {
+	t.Parallel()
+	// given
+	retried := make(chan events.Event, 1)
+	retries := newRetryQueue(3, 20*time.Millisecond, time.Second, 10, putTo(retried))
+	retries.Retry(statusUpdate("/app", "app.1", 1), errors.New("error"))
+
+	// when
+	retries.stop()
+
+	// then
+	assert.Equal(t, 0, retries.pending())
+	select {
+	case <-retried:
+		t.Error("Event retried after stop")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRetryQueue_DeadLettersHandler(t *testing.T) {
+	t.Parallel()
+	// given
+	retries := newRetryQueue(0, time.Hour, time.Hour, 10, nil)
+	retries.Retry(statusUpdate("/app", "app.1", 1), errors.New("error"))
+
+	// when
+	get := httptest.NewRecorder()
+	retries.deadLettersHandler(get, httptest.NewRequest(http.MethodGet, "/events/dead-letters", nil))
+	deleted := httptest.NewRecorder()
+	retries.deadLettersHandler(deleted, httptest.NewRequest(http.MethodDelete, "/events/dead-letters", nil))
+	post := httptest.NewRecorder()
+	retries.deadLettersHandler(post, httptest.NewRequest(http.MethodPost, "/events/dead-letters", nil))
+
+	// then
+	assert.Equal(t, http.StatusOK, get.Code)
+	assert.Equal(t, "application/json", get.Header().Get("Content-Type"))
+	var deadLetters []DeadLetter
+	require.NoError(t, json.Unmarshal(get.Body.Bytes(), &deadLetters))
+	require.Len(t, deadLetters, 1)
+	assert.Equal(t, "error", deadLetters[0].Error)
+	assert.Equal(t, http.StatusNoContent, deleted.Code)
+	assert.Empty(t, retries.deadLetters())
+	assert.Equal(t, http.StatusMethodNotAllowed, post.Code)
+	assert.Equal(t, "GET, DELETE", post.Header().Get("Allow"))
+}
+
+func putTo(queue chan<- events.Event) func(events.Event) bool {
+	return func(e events.Event) bool {
+		queue <- e
+		return true
+	}
+}
+
+func healthStatus(appID apps.AppID, taskID apps.TaskID, alive bool, seq uint64) events.Event {
+	e := healthChanged(appID, taskID, seq)
+	if !alive {
+		e.Body = []byte(`{"appId":"` + appID.String() + `","taskId":"` + taskID.String() + `","alive":false}`)
+	}
+	return e
+}
@@ -1,82 +1,338 @@
 package sse
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/allegro/marathon-consul/apps"
 	"github.com/allegro/marathon-consul/events"
 	"github.com/allegro/marathon-consul/marathon"
+	"github.com/allegro/marathon-consul/metrics"
 	"github.com/allegro/marathon-consul/service"
 	"github.com/allegro/marathon-consul/web"
 )
 
-type Stop func()
 type Handler func(w http.ResponseWriter, r *http.Request)
 
-func NewHandler(config Config, webConfig web.Config, marathon marathon.Marathoner, serviceOperations service.Registry) (Stop, error) {
-	stopChannels := make([]chan<- events.StopEvent, webConfig.WorkersCount)
-	stopFunc := stop(stopChannels)
-	eventQueue := make(chan events.Event, webConfig.QueueSize)
-	for i := 0; i < webConfig.WorkersCount; i++ {
-		handler := events.NewEventHandler(i, serviceOperations, marathon, eventQueue)
-		stopChannels[i] = handler.Start()
+// SSE owns the events queue shared by the Marathon event stream reader and workers processing events
+type SSE struct {
+	config            Config
+	webConfig         web.Config
+	marathon          marathon.Marathoner
+	serviceOperations service.Registry
+	eventQueue        chan events.Event
+	overflow          *overflowQueue
+	partitions        *partitions
+	retries           *retryQueue
+	lock              sync.RWMutex
+	handler           *HandlerSSE
+	lifecycle         sync.Mutex
+	stopped           bool
+	workers           []chan<- events.StopEvent
+	streamStops       []chan<- events.StopEvent
+	reconnected       func()
+	journal           events.Journal
+	metrics           metrics.Scope
+}
+
+// Status describes live state of the event stream and the events queue
+type Status struct {
+	Started   bool `json:"started"`
+	Connected bool `json:"connected"`
+	// Stream is paused while this instance is not the leader
+	Paused            bool       `json:"paused"`
+	DisconnectedSince *time.Time `json:"disconnectedSince,omitempty"`
+	LastEventAt       *time.Time `json:"lastEventAt,omitempty"`
+	// Events waiting in the queue and in partitions of workers
+	QueueLength   int `json:"queueLength"`
+	QueueCapacity int `json:"queueCapacity"`
+	// Events waiting for room in the queue, see OverflowPolicy
+	BacklogLength int `json:"backlogLength"`
+	// Apps waiting for resync after their events were dropped
+	PendingResyncs int `json:"pendingResyncs"`
+	// Failed events waiting for retry
+	PendingRetries int `json:"pendingRetries"`
+	DeadLetters    int `json:"deadLetters"`
+}
+
+func New(config Config, webConfig web.Config, marathon marathon.Marathoner, serviceOperations service.Registry) *SSE {
+	s := &SSE{
+		config:            config,
+		webConfig:         webConfig,
+		marathon:          marathon,
+		serviceOperations: serviceOperations,
+		eventQueue:        make(chan events.Event, webConfig.QueueSize),
+	}
+	s.retries = newRetryQueue(webConfig.RetryMaxAttempts, webConfig.RetryBackoff.Duration,
+		webConfig.RetryMaxBackoff.Duration, webConfig.DeadLettersSize, s.putRetried)
+	return s
+}
+
+// Start spawns workers and subscribes to Marathon event stream.
+// It blocks until this instance becomes the Marathon leader.
+// Stream is not subscribed when Stop was called in the meantime.
+func (s *SSE) Start() error {
+	s.lifecycle.Lock()
+	if s.stopped {
+		s.lifecycle.Unlock()
+		return nil
+	}
+	overflow, err := s.newOverflowQueue()
+	if err != nil {
+		s.lifecycle.Unlock()
+		return err
+	}
+	partitions := newPartitions(s.eventQueue, s.webConfig.WorkersCount, s.webConfig.QueueSize, s.retries)
+	partitions.metrics = s.metrics
+	s.lock.Lock()
+	s.overflow = overflow
+	s.partitions = partitions
+	s.lock.Unlock()
+	appCache := marathon.NewAppCache(s.marathon, s.webConfig.AppCacheTTL.Duration)
+	appCache.UseMetrics(s.metrics)
+	for i := 0; i < s.webConfig.WorkersCount; i++ {
+		handler := events.NewEventHandler(i, s.serviceOperations, s.marathon, partitions.worker(i),
+			apps.UnhealthyTaskPolicy(s.webConfig.UnhealthyTaskPolicy))
+		if s.journal != nil {
+			handler.UseJournal(s.journal)
+		}
+		handler.UseRetries(s.retries)
+		handler.UseAppCache(appCache)
+		handler.UseMetrics(s.metrics)
+		s.workers = append(s.workers, handler.Start())
 	}
+	s.lifecycle.Unlock()
 
-	sse, err := newSSEHandler(eventQueue, marathon, webConfig.MaxEventSize, config)
+	sse, err := newSSEHandler(overflow, s.marathon, s.webConfig.MaxEventSize, s.config, s.reconnected)
 	if err != nil {
-		stopFunc()
-		return nil, fmt.Errorf("Cannot create SSE handler: %s", err)
+		return fmt.Errorf("Cannot create SSE handler: %s", err)
+	}
+	sse.journal = s.journal
+	sse.metrics = s.metrics
+
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+	if s.stopped {
+		log.Info("SSE stopped before subscribing to the event stream")
+		return nil
 	}
 	dispatcherStop, err := sse.start()
 	if err != nil {
-		stopFunc()
-		return nil, fmt.Errorf("Cannot start SSE handler: %s", err)
+		return fmt.Errorf("Cannot start SSE handler: %s", err)
+	}
+
+	s.lock.Lock()
+	s.handler = sse
+	s.lock.Unlock()
+
+	s.streamStops = []chan<- events.StopEvent{dispatcherStop, leaderGuard(sse, s.marathon, leaderGuardInterval)}
+	return nil
+}
+
+func (s *SSE) putRetried(e events.Event) bool {
+	s.lock.RLock()
+	partitions := s.partitions
+	s.lock.RUnlock()
+	return partitions != nil && partitions.putRetried(e)
+}
+
+func (s *SSE) newOverflowQueue() (*overflowQueue, error) {
+	policy, err := ParseOverflowPolicy(s.webConfig.QueueOverflowPolicy)
+	if err != nil {
+		return nil, err
+	}
+	overflow, err := newOverflowQueue(s.eventQueue, policy, s.webConfig.QueueBlockTimeout.Duration, s.webConfig.QueueSpillFile)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot create events queue: %s", err)
 	}
+	overflow.journal = s.journal
+	overflow.metrics = s.metrics
+	return overflow, nil
+}
 
-	guardQuit := leaderGuard(sse.Streamer, marathon)
-	stopChannels = append(stopChannels, dispatcherStop, guardQuit)
+// OnReconnect sets listener called after the event stream was recovered, it has to be set before Start.
+// Marathon does not replay events, so the listener should catch up with changes made during disconnection.
+func (s *SSE) OnReconnect(listener func()) {
+	s.reconnected = listener
+}
+
+// UseJournal makes read events and outcome of their processing recorded in given journal, it has to be set before Start
+func (s *SSE) UseJournal(journal events.Journal) {
+	s.journal = journal
+}
+
+// UseMetrics makes metrics of the stream, the events queue and workers recorded within given scope,
+// it has to be set before Start
+func (s *SSE) UseMetrics(scope metrics.Scope) {
+	s.metrics = scope
+	s.retries.metrics = scope
+}
 
-	return stop(stopChannels), nil
+// DeadLettersHandler responds with events given up after failed retries on GET and forgets them on DELETE
+func (s *SSE) DeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	s.retries.deadLettersHandler(w, r)
 }
 
-func stop(channels []chan<- events.StopEvent) Stop {
-	return func() {
-		for _, channel := range channels {
-			channel <- events.StopEvent{}
+// Stop unsubscribes from the event stream, lets workers process already queued events
+// and stops them. Events left in the queue when the context is done are dropped.
+func (s *SSE) Stop(ctx context.Context) {
+	s.lifecycle.Lock()
+	defer s.lifecycle.Unlock()
+	if s.stopped {
+		return
+	}
+	s.stopped = true
+
+	stop(ctx, s.streamStops)
+	s.drain(ctx)
+	if s.overflow != nil {
+		s.overflow.stop()
+	}
+	s.retries.stop()
+	if s.partitions != nil {
+		s.partitions.stop()
+	}
+	stop(ctx, s.workers)
+	log.Info("SSE stopped")
+}
+
+func (s *SSE) drain(ctx context.Context) {
+	if len(s.workers) == 0 {
+		return
+	}
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for len(s.eventQueue) > 0 || s.backlogged() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.WithField("QueueLength", len(s.eventQueue)).Warn("Shutdown timeout reached, dropping queued events")
+			s.metrics.UpdateGauge("events.queue.dropped_on_shutdown", int64(len(s.eventQueue)))
+			return
+		}
+	}
+}
+
+func (s *SSE) backlogged() bool {
+	if s.partitions != nil && s.partitions.pending() > 0 {
+		return true
+	}
+	if s.overflow == nil {
+		return false
+	}
+	backlog, resyncs := s.overflow.pending()
+	return backlog > 0 || resyncs > 0
+}
+
+func (s *SSE) Status() Status {
+	status := Status{
+		QueueLength:   len(s.eventQueue),
+		QueueCapacity: cap(s.eventQueue),
+	}
+	s.lock.RLock()
+	handler := s.handler
+	overflow := s.overflow
+	partitions := s.partitions
+	s.lock.RUnlock()
+	if partitions != nil {
+		status.QueueLength += partitions.pending()
+	}
+	status.PendingRetries = s.retries.pending()
+	status.DeadLetters = len(s.retries.deadLetters())
+	if overflow != nil {
+		status.BacklogLength, status.PendingResyncs = overflow.pending()
+	}
+	if handler != nil {
+		status.Started = true
+		status.Connected = handler.Streamer.Connected()
+		status.Paused = handler.isPaused()
+		if since, disconnected := handler.Streamer.DisconnectedSince(); disconnected {
+			status.DisconnectedSince = &since
 		}
+		status.LastEventAt = handler.lastEventAt()
 	}
+	return status
 }
 
+// StreamCheck reports an error when started event stream is disconnected for longer than given duration.
+// Stream that was not started yet or is paused (e.g., instance is not a leader) is not checked.
+func (s *SSE) StreamCheck(maxDisconnection time.Duration) func() error {
+	return func() error {
+		status := s.Status()
+		if status.Paused || status.DisconnectedSince == nil {
+			return nil
+		}
+		if disconnection := time.Since(*status.DisconnectedSince); disconnection > maxDisconnection {
+			return fmt.Errorf("SSE stream disconnected for %s", disconnection.Round(time.Second))
+		}
+		return nil
+	}
+}
+
+// QueueCheck reports an error when events queue utilization reaches given percentage, non-positive value disables the check
+func (s *SSE) QueueCheck(maxUtilization int) func() error {
+	return func() error {
+		status := s.Status()
+		if status.QueueCapacity == 0 || maxUtilization <= 0 {
+			return nil
+		}
+		if utilization := 100 * status.QueueLength / status.QueueCapacity; utilization >= maxUtilization {
+			return fmt.Errorf("Events queue saturated: %d of %d events queued", status.QueueLength, status.QueueCapacity)
+		}
+		return nil
+	}
+}
+
+// stop notifies all channels, giving up on those not listening when the context is done
+func stop(ctx context.Context, channels []chan<- events.StopEvent) {
+	for _, channel := range channels {
+		select {
+		case channel <- events.StopEvent{}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// leaderGuardInterval is how often leaderGuard checks leadership of this instance
+const leaderGuardInterval = 5 * time.Second
+
 // leaderGuard is a watchdog goroutine,
-// periodically checks if leader has changed
-// if change is detected, passed streamer is stopped - unable to recover
-// if this goroutine is quited, agent is stopped - unable to recover
-func leaderGuard(s *marathon.Streamer, m marathon.Marathoner) chan<- events.StopEvent {
-	// TODO(tz) - consider launching this goroutine from marathon,
-	// no need to pass marathon reciever then ??
-	quit := make(chan events.StopEvent)
+// periodically checks if this instance is still the leader.
+// When leadership is lost (e.g., Consul lock was lost) the stream is paused and it is resumed
+// when this instance leads again, so the stream is never read by two instances at once.
+// When this goroutine is quit, the stream is stopped.
+func leaderGuard(h *HandlerSSE, m marathon.Marathoner, interval time.Duration) chan<- events.StopEvent {
+	// buffered, guard may be stopped after the handler was stopped
+	quit := make(chan events.StopEvent, 1)
 
 	go func() {
-		ticker := time.NewTicker(5 * time.Second)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
-				if iAMLeader, err := m.IsLeader(); !iAMLeader && err != nil {
-					// Leader changed, not revocerable.
-					ticker.Stop()
-					s.Stop()
-					log.Error("Tearing down SSE stream, marathon leader changed.")
-					return
-				} else if err != nil {
+				iAMLeader, err := m.IsLeader()
+				if err != nil {
 					log.WithError(err).Error("Leader Guard error while checking leader.")
+					continue
+				}
+				if !iAMLeader && !h.isPaused() {
+					log.Warn("Leadership lost, pausing SSE stream until this instance leads again")
+					h.metrics.Mark("events.stream.pause")
+					h.pause()
+				} else if iAMLeader && h.isPaused() {
+					log.Info("Leadership regained, resuming SSE stream")
+					h.resume()
 				}
 			case <-quit:
 				log.Info("Recieved quit notification. Quit checker")
-				ticker.Stop()
-				s.Stop()
+				h.stop()
 				return
 			}
 		}
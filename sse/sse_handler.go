@@ -1,8 +1,10 @@
 package sse
 
 import (
+	"bufio"
 	"fmt"
-	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -12,19 +14,35 @@ import (
 	"github.com/allegro/marathon-consul/metrics"
 )
 
+// initialLineBufferSize is the initial size of the buffer for lines of the stream
+const initialLineBufferSize = 4096
+
 // HandlerSSE defines handler for marathon event stream, opening and closing
 // subscription
 type HandlerSSE struct {
 	config      Config
-	eventQueue  chan events.Event
+	queue       *overflowQueue
 	Streamer    *marathon.Streamer
 	maxLineSize int64
+	lastEvent   int64
+	// sequence number of the last read event, used when there is no journal to number events
+	seq      uint64
+	done     chan struct{}
+	stopOnce sync.Once
+	// called after the stream is recovered, events sent in the meantime may be lost
+	reconnected func()
+	journal     events.Journal
+	metrics     metrics.Scope
+	pauseLock   sync.Mutex
+	// closed when paused stream is resumed, nil when the stream is not paused
+	resumed chan struct{}
 }
 
-func newSSEHandler(eventQueue chan events.Event, service marathon.Marathoner, maxLineSize int64, config Config) (*HandlerSSE, error) {
+func newSSEHandler(queue *overflowQueue, service marathon.Marathoner, maxLineSize int64, config Config,
+	reconnected func()) (*HandlerSSE, error) {
 
 	streamer, err := service.EventStream(
-		[]string{events.StatusUpdateEventType, events.HealthStatusChangedEventType},
+		events.SupportedEventTypes,
 		config.Retries,
 		config.RetryBackoff.Duration,
 	)
@@ -34,9 +52,11 @@ func newSSEHandler(eventQueue chan events.Event, service marathon.Marathoner, ma
 
 	return &HandlerSSE{
 		config:      config,
-		eventQueue:  eventQueue,
+		queue:       queue,
 		Streamer:    streamer,
 		maxLineSize: maxLineSize,
+		done:        make(chan struct{}),
+		reconnected: reconnected,
 	}, nil
 }
 
@@ -55,52 +75,171 @@ func (h *HandlerSSE) start() (chan<- events.StopEvent, error) {
 	go func() {
 		defer h.stop()
 
-		// buffer used for token storage,
-		// if token is greater than buffer, empty token is stored
-		buffer := make([]byte, h.maxLineSize)
-		// configure streamer scanner :)
-		h.Streamer.Scanner.Buffer(buffer, cap(buffer))
-		h.Streamer.Scanner.Split(events.ScanLines)
-		for {
-			metrics.Time("events.read", func() { h.handle() })
+		h.configureScanner()
+		for !h.stopping() {
+			h.metrics.Time("events.read", func() { h.handle() })
 		}
 	}()
 	return stopChan, nil
 }
 
+// configureScanner makes scanner of the stream split lines also on CR and read lines up to maxLineSize.
+// Buffer starts small and grows only for big events (e.g., deployments carrying whole app definitions).
+// Streamer creates a new scanner on every (re)connection, so it has to be called after each of them.
+func (h *HandlerSSE) configureScanner() {
+	size := initialLineBufferSize
+	if h.maxLineSize < int64(size) {
+		size = int(h.maxLineSize)
+	}
+	h.Streamer.Scanner.Buffer(make([]byte, size), int(h.maxLineSize))
+	h.Streamer.Scanner.Split(events.ScanLines)
+}
+
 func (h *HandlerSSE) handle() {
 	e, err := events.ParseSSEEvent(h.Streamer.Scanner)
+	h.rememberReconnection(e)
 	if err != nil {
-		if err == io.EOF {
-			// Event could be partial at this point
-			h.enqueueEvent(e)
+		if h.stopping() {
+			return
+		}
+		if h.waitWhilePaused() {
+			return
+		}
+		// Event read before the error is incomplete, it is dropped
+		// and its app is synced after reconnection like apps of all events lost in the meantime
+		if err == bufio.ErrTooLong {
+			log.WithError(err).WithField("MaxSize", h.maxLineSize).
+				Error("Event exceeds event-max-size, dropping it")
+			h.metrics.Mark("events.read.too_long")
+		} else {
+			log.WithError(err).Error("Error when parsing the event")
 		}
-		log.WithError(err).Error("Error when parsing the event")
 		err = h.Streamer.Recover()
 		if err != nil {
 			log.WithError(err).Fatalf("Unable to recover streamer")
 		}
+		h.configureScanner()
+		if h.isPaused() {
+			// paused while reconnecting, next read fails and waits for resume
+			h.Streamer.Disconnect()
+		}
+		h.metrics.Mark("events.stream.reconnect")
+		if h.reconnected != nil {
+			h.reconnected()
+		}
+		return
 	}
-	metrics.Mark("events.read." + e.Type)
-	if e.Type != events.StatusUpdateEventType && e.Type != events.HealthStatusChangedEventType {
+	atomic.StoreInt64(&h.lastEvent, time.Now().UnixNano())
+	h.metrics.Mark("events.read." + e.Type)
+	if !isSupported(e.Type) {
 		log.Debugf("%s is not supported", e.Type)
-		metrics.Mark("events.read.drop")
+		h.metrics.Mark("events.read.drop")
 		return
 	}
 	h.enqueueEvent(e)
 }
 
+// rememberReconnection passes event id and retry fields to the streamer, so they are used when recovering the stream
+func (h *HandlerSSE) rememberReconnection(e events.SSEEvent) {
+	if e.ID != "" {
+		h.Streamer.SetLastEventID(e.ID)
+	}
+	if delay, ok := e.RetryDelay(); ok {
+		h.Streamer.SetRetryDelay(delay)
+	}
+}
+
 func (h *HandlerSSE) enqueueEvent(e events.SSEEvent) {
+	event := events.Event{Timestamp: time.Now(), EventType: e.Type, Body: e.Body}
+	if h.journal != nil {
+		h.journal.Received(&event)
+	} else {
+		h.seq++
+		event.Seq = h.seq
+	}
+	if h.queue.put(event) {
+		h.metrics.Mark("events.read.accept")
+	}
+}
+
+func isSupported(eventType string) bool {
+	for _, supported := range events.SupportedEventTypes {
+		if eventType == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// lastEventAt returns time when the last event was read from the stream, nil if none was read yet
+func (h *HandlerSSE) lastEventAt() *time.Time {
+	nanos := atomic.LoadInt64(&h.lastEvent)
+	if nanos == 0 {
+		return nil
+	}
+	t := time.Unix(0, nanos)
+	return &t
+}
+
+// pause disconnects the stream until resume is called, e.g., when this instance is not the leader anymore
+func (h *HandlerSSE) pause() {
+	h.pauseLock.Lock()
+	defer h.pauseLock.Unlock()
+	if h.resumed != nil {
+		return
+	}
+	h.resumed = make(chan struct{})
+	h.Streamer.Disconnect()
+}
+
+// resume lets paused stream reconnect, events sent in the meantime are caught up like after any reconnection
+func (h *HandlerSSE) resume() {
+	h.pauseLock.Lock()
+	defer h.pauseLock.Unlock()
+	if h.resumed == nil {
+		return
+	}
+	close(h.resumed)
+	h.resumed = nil
+}
+
+func (h *HandlerSSE) isPaused() bool {
+	h.pauseLock.Lock()
+	defer h.pauseLock.Unlock()
+	return h.resumed != nil
+}
+
+// waitWhilePaused blocks until paused stream is resumed, it returns true when the handler was stopped in the meantime
+func (h *HandlerSSE) waitWhilePaused() bool {
+	h.pauseLock.Lock()
+	resumed := h.resumed
+	h.pauseLock.Unlock()
+	if resumed == nil {
+		return false
+	}
+	log.Info("SSE stream paused")
 	select {
-	case h.eventQueue <- events.Event{Timestamp: time.Now(), EventType: e.Type, Body: e.Body}:
-		metrics.Mark("events.read.accept")
-	default:
-		log.Error("Events queue full. Dropping the event")
-		metrics.Mark("events.read.drop")
+	case <-resumed:
+		log.Info("SSE stream resumed")
+		return false
+	case <-h.done:
+		return true
 	}
 }
 
 // Close connections managed by context
 func (h *HandlerSSE) stop() {
-	h.Streamer.Stop()
+	h.stopOnce.Do(func() {
+		close(h.done)
+		h.Streamer.Stop()
+	})
+}
+
+func (h *HandlerSSE) stopping() bool {
+	select {
+	case <-h.done:
+		return true
+	default:
+		return false
+	}
 }
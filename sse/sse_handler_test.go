@@ -0,0 +1,156 @@
+package sse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/allegro/marathon-consul/events"
+	"github.com/allegro/marathon-consul/marathon"
+	timeutil "github.com/allegro/marathon-consul/time"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerSSE_ShouldReadEventBiggerThanInitialBuffer(t *testing.T) {
+	t.Parallel()
+	// given
+	deployment := deploymentSuccess(t)
+	require.True(t, len(deployment) > initialLineBufferSize)
+	server, _ := eventStreamServer(sseEvent(events.DeploymentSuccessEventType, deployment))
+	defer server.Close()
+	queue := make(chan events.Event, 10)
+	handler := newTestSSEHandler(t, server, queue, 10485760)
+
+	// when
+	stop, err := handler.start()
+	require.NoError(t, err)
+	defer func() { stop <- events.StopEvent{} }()
+
+	// then
+	e := receive(t, queue)
+	assert.Equal(t, events.DeploymentSuccessEventType, e.EventType)
+	assert.Equal(t, append(deployment, '\n'), e.Body)
+}
+
+func TestHandlerSSE_ShouldDropEventBiggerThanMaxSizeAndReconnect(t *testing.T) {
+	t.Parallel()
+	// given
+	deployment := deploymentSuccess(t)
+	statusUpdate := []byte(`{"appId":"/test/app","taskId":"test_app.1","taskStatus":"TASK_RUNNING"}`)
+	server, connections := eventStreamServer(
+		sseEvent(events.DeploymentSuccessEventType, deployment),
+		sseEvent(events.StatusUpdateEventType, statusUpdate),
+	)
+	defer server.Close()
+	queue := make(chan events.Event, 10)
+	handler := newTestSSEHandler(t, server, queue, int64(len(deployment)/2))
+
+	// when
+	stop, err := handler.start()
+	require.NoError(t, err)
+	defer func() { stop <- events.StopEvent{} }()
+
+	// then
+	e := receive(t, queue)
+	assert.Equal(t, events.StatusUpdateEventType, e.EventType)
+	assert.True(t, atomic.LoadInt32(connections) > 1)
+}
+
+// eventStreamServer sends the n-th of given events on the n-th connection (the last one on all next connections)
+// and then keeps the connection open
+func eventStreamServer(sseEvents ...string) (*httptest.Server, *int32) {
+	connections := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(connections, 1))
+		if n > len(sseEvents) {
+			n = len(sseEvents)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, sseEvents[n-1])
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	return server, connections
+}
+
+func newTestSSEHandler(t *testing.T, server *httptest.Server, queue chan events.Event, maxLineSize int64) *HandlerSSE {
+	location, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	remote, err := marathon.New(marathon.Config{Location: location.Host, Protocol: "http", Leader: "*"})
+	require.NoError(t, err)
+	overflow, err := newOverflowQueue(queue, OverflowDrop, 0, "")
+	require.NoError(t, err)
+	config := Config{Retries: 3, RetryBackoff: timeutil.Interval{Duration: 10 * time.Millisecond}}
+	handler, err := newSSEHandler(overflow, remote, maxLineSize, config, nil)
+	require.NoError(t, err)
+	return handler
+}
+
+// deploymentSuccess returns real deployment event in a single line as it is sent by Marathon
+func deploymentSuccess(t *testing.T) []byte {
+	body, err := ioutil.ReadFile("../events/testdata/deployment_success.json")
+	require.NoError(t, err)
+	compacted := &bytes.Buffer{}
+	require.NoError(t, json.Compact(compacted, body))
+	return compacted.Bytes()
+}
+
+func sseEvent(eventType string, data []byte) string {
+	return fmt.Sprintf("event: %s\ndata: %s\n\n", eventType, data)
+}
+
+type leaderStub struct {
+	marathon.Marathoner
+	leading int32
+}
+
+func (m *leaderStub) IsLeader() (bool, error) {
+	return atomic.LoadInt32(&m.leading) == 1, nil
+}
+
+func TestLeaderGuard_ShouldPauseStreamWhenLeadershipIsLostAndResumeWhenRegained(t *testing.T) {
+	t.Parallel()
+	// given
+	statusUpdate := []byte(`{"appId":"/test/app","taskId":"test_app.1","taskStatus":"TASK_RUNNING"}`)
+	server, connections := eventStreamServer(sseEvent(events.StatusUpdateEventType, statusUpdate))
+	defer server.Close()
+	queue := make(chan events.Event, 10)
+	handler := newTestSSEHandler(t, server, queue, 10485760)
+	reconnected := new(int32)
+	handler.reconnected = func() { atomic.AddInt32(reconnected, 1) }
+	leader := &leaderStub{leading: 1}
+	stop, err := handler.start()
+	require.NoError(t, err)
+	guard := leaderGuard(handler, leader, time.Millisecond)
+	defer func() { guard <- events.StopEvent{} }()
+	receive(t, queue)
+
+	// when
+	atomic.StoreInt32(&leader.leading, 0)
+
+	// then
+	eventually(t, handler.isPaused)
+	assert.False(t, handler.Streamer.Connected())
+	assert.False(t, handler.stopping())
+	assert.Empty(t, queue)
+	assert.Equal(t, int32(1), atomic.LoadInt32(connections))
+
+	// when
+	atomic.StoreInt32(&leader.leading, 1)
+
+	// then
+	assert.Equal(t, events.StatusUpdateEventType, receive(t, queue).EventType)
+	assert.False(t, handler.isPaused())
+	assert.True(t, handler.Streamer.Connected())
+	assert.Equal(t, int32(2), atomic.LoadInt32(connections))
+	assert.Equal(t, int32(1), atomic.LoadInt32(reconnected))
+	stop <- events.StopEvent{}
+}
@@ -0,0 +1,105 @@
+package sse
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/allegro/marathon-consul/consul"
+	"github.com/allegro/marathon-consul/events"
+	"github.com/allegro/marathon-consul/marathon"
+	"github.com/allegro/marathon-consul/web"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSE_StatusBeforeStart(t *testing.T) {
+	t.Parallel()
+	// given
+	sse := New(Config{}, web.Config{QueueSize: 10}, marathon.MarathonerStubForApps(), consul.NewConsulStub())
+	sse.eventQueue <- events.Event{}
+
+	// when
+	status := sse.Status()
+
+	// then
+	assert.Equal(t, Status{Started: false, Connected: false, LastEventAt: nil, QueueLength: 1, QueueCapacity: 10}, status)
+}
+
+func TestSSE_StreamCheckShouldIgnoreStreamNotStarted(t *testing.T) {
+	t.Parallel()
+	// given
+	sse := New(Config{}, web.Config{QueueSize: 10}, marathon.MarathonerStubForApps(), consul.NewConsulStub())
+
+	// expect
+	assert.NoError(t, sse.StreamCheck(0)())
+}
+
+func TestSSE_QueueCheck(t *testing.T) {
+	t.Parallel()
+	// given
+	sse := New(Config{}, web.Config{QueueSize: 2}, marathon.MarathonerStubForApps(), consul.NewConsulStub())
+
+	// expect
+	assert.NoError(t, sse.QueueCheck(50)())
+
+	// when
+	sse.eventQueue <- events.Event{}
+
+	// then
+	assert.EqualError(t, sse.QueueCheck(50)(), "Events queue saturated: 1 of 2 events queued")
+	assert.NoError(t, sse.QueueCheck(100)())
+}
+
+func TestSSE_StopShouldWaitForQueuedEvents(t *testing.T) {
+	t.Parallel()
+	// given
+	sse := New(Config{}, web.Config{QueueSize: 10, WorkersCount: 1}, marathon.MarathonerStubForApps(), consul.NewConsulStub())
+	sse.lifecycle.Lock()
+	sse.workers = []chan<- events.StopEvent{make(chan events.StopEvent, 1)}
+	sse.lifecycle.Unlock()
+	sse.eventQueue <- events.Event{}
+	go func() {
+		<-time.After(20 * time.Millisecond)
+		<-sse.eventQueue
+	}()
+
+	// when
+	sse.Stop(context.Background())
+
+	// then
+	assert.Empty(t, sse.eventQueue)
+}
+
+func TestSSE_StopShouldDropQueuedEventsOnTimeout(t *testing.T) {
+	t.Parallel()
+	// given
+	sse := New(Config{}, web.Config{QueueSize: 10, WorkersCount: 1}, marathon.MarathonerStubForApps(), consul.NewConsulStub())
+	worker := make(chan events.StopEvent)
+	sse.lifecycle.Lock()
+	sse.workers = []chan<- events.StopEvent{worker}
+	sse.lifecycle.Unlock()
+	sse.eventQueue <- events.Event{}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// when
+	sse.Stop(ctx)
+
+	// then
+	assert.Len(t, sse.eventQueue, 1)
+}
+
+func TestSSE_ShouldNotStartAfterStop(t *testing.T) {
+	t.Parallel()
+	// given
+	sse := New(Config{}, web.Config{QueueSize: 10, WorkersCount: 2}, marathon.MarathonerStubForApps(), consul.NewConsulStub())
+	sse.Stop(context.Background())
+
+	// when
+	err := sse.Start()
+
+	// then
+	assert.NoError(t, err)
+	assert.Empty(t, sse.workers)
+	assert.False(t, sse.Status().Started)
+}
@@ -5,6 +5,7 @@ import "github.com/allegro/marathon-consul/time"
 type Config struct {
 	Enabled  bool
 	Force    bool
+	DryRun   bool
 	Interval time.Interval
 	Leader   string
 }
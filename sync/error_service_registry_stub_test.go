@@ -18,6 +18,14 @@ func (c errorServiceRegistry) GetAllServices() ([]*service.Service, error) {
 	return nil, errors.New("Error occured")
 }
 
+func (c errorServiceRegistry) GetAppServices(appID apps.AppID) ([]*service.Service, error) {
+	return nil, errors.New("Error occured")
+}
+
+func (c errorServiceRegistry) RegistrationIntents(task *apps.Task, app *apps.App) []apps.RegistrationIntent {
+	return nil
+}
+
 func (c errorServiceRegistry) Register(task *apps.Task, app *apps.App) error {
 	return errors.New("Error occured")
 }
@@ -29,3 +37,11 @@ func (c errorServiceRegistry) DeregisterByTask(taskID apps.TaskID) error {
 func (c errorServiceRegistry) Deregister(toDeregister *service.Service) error {
 	return errors.New("Error occured")
 }
+
+func (c errorServiceRegistry) EnableMaintenanceByTask(taskID apps.TaskID, reason string) error {
+	return errors.New("Error occured")
+}
+
+func (c errorServiceRegistry) DisableMaintenanceByTask(taskID apps.TaskID) error {
+	return errors.New("Error occured")
+}
@@ -0,0 +1,75 @@
+package sync
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// TriggerHandler performs sync on POST request and responds with its result.
+// Sync is performed only on leader unless it's forced with config or force=true query parameter.
+func (s *Sync) TriggerHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{"Only POST method is allowed"})
+		return
+	}
+
+	force := s.config.Force
+	if value := r.URL.Query().Get("force"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{"Invalid force parameter: " + value})
+			return
+		}
+		force = force || parsed
+	}
+
+	log.WithField("Force", force).Info("Sync triggered on demand")
+	result, err := s.sync(force)
+	switch {
+	case err == ErrSyncInProgress:
+		writeJSON(w, http.StatusConflict, errorResponse{err.Error()})
+	case err != nil:
+		log.WithError(err).Error("An error occured while performing sync")
+		writeJSON(w, http.StatusInternalServerError, errorResponse{err.Error()})
+	case result == nil:
+		writeJSON(w, http.StatusConflict, errorResponse{"Node is not a leader, sync skipped"})
+	default:
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// PlanHandler responds with changes sync would make, nothing is applied.
+func (s *Sync) PlanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{"Only GET method is allowed"})
+		return
+	}
+
+	plan, err := s.Plan()
+	switch {
+	case err == ErrSyncInProgress:
+		writeJSON(w, http.StatusConflict, errorResponse{err.Error()})
+	case err != nil:
+		log.WithError(err).Error("An error occured while planning sync")
+		writeJSON(w, http.StatusInternalServerError, errorResponse{err.Error()})
+	default:
+		writeJSON(w, http.StatusOK, plan)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.WithError(err).Error("Could not write response")
+	}
+}
@@ -0,0 +1,205 @@
+package sync
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/allegro/marathon-consul/consul"
+	"github.com/allegro/marathon-consul/marathon"
+	. "github.com/allegro/marathon-consul/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTriggerHandler_ShouldSyncAndReturnResult(t *testing.T) {
+	t.Parallel()
+	// given
+	marathoner := marathon.MarathonerStubForApps(ConsulApp("app1", 2))
+	consulStub := consul.NewConsulStub()
+	notMarathonApp := ConsulApp("/not/marathon", 1)
+	consulStub.Register(&notMarathonApp.Tasks[0], notMarathonApp)
+	sync := newSyncWithDefaultConfig(marathoner, consulStub)
+	req, _ := http.NewRequest("POST", "http://example.com/sync", nil)
+	recorder := httptest.NewRecorder()
+
+	// when
+	sync.TriggerHandler(recorder, req)
+
+	// then
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"registered": 2, "registerErrors": 0, "deregistered": 1, "deregisterErrors": 0}`, recorder.Body.String())
+}
+
+func TestTriggerHandler_ShouldAcceptOnlyPost(t *testing.T) {
+	t.Parallel()
+	// given
+	marathoner := marathon.MarathonerStubForApps(ConsulApp("app1", 1))
+	consulStub := consul.NewConsulStub()
+	sync := newSyncWithDefaultConfig(marathoner, consulStub)
+	req, _ := http.NewRequest("GET", "http://example.com/sync", nil)
+	recorder := httptest.NewRecorder()
+
+	// when
+	sync.TriggerHandler(recorder, req)
+
+	// then
+	assert.Equal(t, 405, recorder.Code)
+	assert.False(t, marathoner.Interactions())
+}
+
+func TestTriggerHandler_ShouldNotSyncWithoutLeadership(t *testing.T) {
+	t.Parallel()
+	// given
+	app := ConsulApp("app1", 1)
+	marathoner := marathon.MarathonerStubWithLeaderForApps("leader:8080", "different.node:8090", app)
+	services := newConsulServicesMock()
+	sync := New(Config{}, marathoner, services, noopSyncStartedListener)
+	req, _ := http.NewRequest("POST", "http://example.com/sync", nil)
+	recorder := httptest.NewRecorder()
+
+	// when
+	sync.TriggerHandler(recorder, req)
+
+	// then
+	assert.Equal(t, 409, recorder.Code)
+	assert.Zero(t, services.RegistrationsCount(app.Tasks[0].ID.String()))
+}
+
+func TestTriggerHandler_ShouldSyncWithoutLeadershipWhenForced(t *testing.T) {
+	t.Parallel()
+	// given
+	app := ConsulApp("app1", 1)
+	marathoner := marathon.MarathonerStubWithLeaderForApps("leader:8080", "different.node:8090", app)
+	services := newConsulServicesMock()
+	sync := New(Config{}, marathoner, services, noopSyncStartedListener)
+	req, _ := http.NewRequest("POST", "http://example.com/sync?force=true", nil)
+	recorder := httptest.NewRecorder()
+
+	// when
+	sync.TriggerHandler(recorder, req)
+
+	// then
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, 1, services.RegistrationsCount(app.Tasks[0].ID.String()))
+}
+
+func TestTriggerHandler_ShouldRejectInvalidForceParameter(t *testing.T) {
+	t.Parallel()
+	// given
+	marathoner := marathon.MarathonerStubForApps(ConsulApp("app1", 1))
+	sync := newSyncWithDefaultConfig(marathoner, consul.NewConsulStub())
+	req, _ := http.NewRequest("POST", "http://example.com/sync?force=maybe", nil)
+	recorder := httptest.NewRecorder()
+
+	// when
+	sync.TriggerHandler(recorder, req)
+
+	// then
+	assert.Equal(t, 400, recorder.Code)
+}
+
+func TestTriggerHandler_ShouldNotStartSecondSyncWhileOneIsRunning(t *testing.T) {
+	t.Parallel()
+	// given
+	marathoner := marathon.MarathonerStubForApps(ConsulApp("app1", 1))
+	sync := newSyncWithDefaultConfig(marathoner, consul.NewConsulStub())
+	sync.running = 1
+	req, _ := http.NewRequest("POST", "http://example.com/sync", nil)
+	recorder := httptest.NewRecorder()
+
+	// when
+	sync.TriggerHandler(recorder, req)
+
+	// then
+	assert.Equal(t, 409, recorder.Code)
+	assert.JSONEq(t, `{"error": "Sync is already in progress"}`, recorder.Body.String())
+	assert.False(t, marathoner.Interactions())
+}
+
+func TestTriggerHandler_ShouldReturnPlanInDryRunMode(t *testing.T) {
+	t.Parallel()
+	// given
+	app := ConsulApp("app1", 1)
+	marathoner := marathon.MarathonerStubForApps(app)
+	services := newConsulServicesMock()
+	sync := New(Config{Force: true, DryRun: true}, marathoner, services, noopSyncStartedListener)
+	req, _ := http.NewRequest("POST", "http://example.com/sync", nil)
+	recorder := httptest.NewRecorder()
+
+	// when
+	sync.TriggerHandler(recorder, req)
+
+	// then
+	assert.Equal(t, 200, recorder.Code)
+	assert.Zero(t, services.RegistrationsCount(app.Tasks[0].ID.String()))
+	assert.JSONEq(t, `{
+		"registered": 0, "registerErrors": 0, "deregistered": 0, "deregisterErrors": 0,
+		"dryRun": true,
+		"plan": {
+			"register": [{"taskId": "app1.0", "appId": "app1", "intents": [{"name": "app1", "port": 8080, "tags": []}]}],
+			"deregister": []
+		}
+	}`, recorder.Body.String())
+}
+
+func TestPlanHandler_ShouldReturnPlan(t *testing.T) {
+	t.Parallel()
+	// given
+	marathoner := marathon.MarathonerStubForApps(ConsulApp("app1", 1))
+	consulStub := consul.NewConsulStub()
+	notMarathonApp := ConsulApp("/not/marathon", 1)
+	consulStub.Register(&notMarathonApp.Tasks[0], notMarathonApp)
+	sync := newSyncWithDefaultConfig(marathoner, consulStub)
+	req, _ := http.NewRequest("GET", "http://example.com/sync/plan", nil)
+	recorder := httptest.NewRecorder()
+
+	// when
+	sync.PlanHandler(recorder, req)
+
+	// then
+	assert.Equal(t, 200, recorder.Code)
+	assert.JSONEq(t, `{
+		"register": [{"taskId": "app1.0", "appId": "app1", "intents": [{"name": "app1", "port": 8080, "tags": []}]}],
+		"deregister": [{
+			"serviceId": "not_marathon.0_not.marathon_8080",
+			"name": "not.marathon",
+			"agentAddress": "127.0.0.1",
+			"reason": "task not found in Marathon apps and fresh task info unavailable"
+		}]
+	}`, recorder.Body.String())
+	services, _ := consulStub.GetAllServices()
+	assert.Len(t, services, 1)
+}
+
+func TestPlanHandler_ShouldNotPlanWhileSyncIsRunning(t *testing.T) {
+	t.Parallel()
+	// given
+	marathoner := marathon.MarathonerStubForApps(ConsulApp("app1", 1))
+	sync := newSyncWithDefaultConfig(marathoner, consul.NewConsulStub())
+	sync.running = 1
+	req, _ := http.NewRequest("GET", "http://example.com/sync/plan", nil)
+	recorder := httptest.NewRecorder()
+
+	// when
+	sync.PlanHandler(recorder, req)
+
+	// then
+	assert.Equal(t, 409, recorder.Code)
+	assert.JSONEq(t, `{"error": "Sync is already in progress"}`, recorder.Body.String())
+	assert.False(t, marathoner.Interactions())
+}
+
+func TestPlanHandler_ShouldReturnErrorOnMarathonProblems(t *testing.T) {
+	t.Parallel()
+	// given
+	sync := newSyncWithDefaultConfig(errorMarathon{}, nil)
+	req, _ := http.NewRequest("GET", "http://example.com/sync/plan", nil)
+	recorder := httptest.NewRecorder()
+
+	// when
+	sync.PlanHandler(recorder, req)
+
+	// then
+	assert.Equal(t, 500, recorder.Code)
+}
@@ -0,0 +1,128 @@
+package sync
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/allegro/marathon-consul/apps"
+	"github.com/allegro/marathon-consul/service"
+	log "github.com/sirupsen/logrus"
+)
+
+// Reasons why sync decided to deregister a service
+const (
+	ReasonMissingTaskTag      = "marathon-task tag missing"
+	ReasonTaskNotRunning      = "task not running in Marathon"
+	ReasonTaskInfoUnavailable = "task not found in Marathon apps and fresh task info unavailable"
+)
+
+// Plan holds changes that sync would apply to the service registry
+type Plan struct {
+	Register   []PlannedRegistration   `json:"register"`
+	Deregister []PlannedDeregistration `json:"deregister"`
+}
+
+type PlannedRegistration struct {
+	TaskID  apps.TaskID               `json:"taskId"`
+	AppID   apps.AppID                `json:"appId"`
+	Intents []apps.RegistrationIntent `json:"intents"`
+	task    *apps.Task
+	app     *apps.App
+}
+
+type PlannedDeregistration struct {
+	ServiceID    service.ID `json:"serviceId"`
+	Name         string     `json:"name"`
+	AgentAddress string     `json:"agentAddress"`
+	Reason       string     `json:"reason"`
+	service      *service.Service
+}
+
+func newPlannedDeregistration(s *service.Service, reason string) PlannedDeregistration {
+	return PlannedDeregistration{
+		ServiceID:    s.ID,
+		Name:         s.Name,
+		AgentAddress: s.AgentAddress,
+		Reason:       reason,
+		service:      s,
+	}
+}
+
+// Plan computes changes required to bring service registry in line with Marathon, without applying them.
+// Unlike sync it does not depend on leadership since it's read only, but it's never computed
+// concurrently with a running sync and returns ErrSyncInProgress instead.
+func (s *Sync) Plan() (*Plan, error) {
+	if !atomic.CompareAndSwapInt32(&s.running, 0, 1) {
+		return nil, ErrSyncInProgress
+	}
+	defer atomic.StoreInt32(&s.running, 0)
+
+	apps, err := s.consulApps()
+	if err != nil {
+		return nil, err
+	}
+	return s.plan(apps)
+}
+
+func (s *Sync) consulApps() ([]*apps.App, error) {
+	apps, err := s.marathon.ConsulApps()
+	if err != nil {
+		return nil, fmt.Errorf("Can't get Marathon apps: %v", err)
+	}
+	return apps, nil
+}
+
+func (s *Sync) plan(apps []*apps.App) (*Plan, error) {
+	services, err := s.serviceRegistry.GetAllServices()
+	if err != nil {
+		return nil, fmt.Errorf("Can't get Consul services: %v", err)
+	}
+
+	return &Plan{
+		Register:   s.registerAppTasksNotFoundInConsul(apps, services),
+		Deregister: s.deregisterConsulServicesNotFoundInMarathon(apps, services),
+	}, nil
+}
+
+func (s *Sync) apply(plan *Plan) *Result {
+	result := &Result{}
+	for _, r := range plan.Register {
+		if err := s.serviceRegistry.Register(r.task, r.app); err != nil {
+			log.WithError(err).WithField("Id", r.TaskID).WithField("Sync", true).Error("Can't register task")
+			result.RegisterErrors++
+		} else {
+			result.Registered++
+		}
+	}
+	for _, d := range plan.Deregister {
+		if err := s.serviceRegistry.Deregister(d.service); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"Id":      d.ServiceID,
+				"Address": d.AgentAddress,
+				"Sync":    true,
+			}).Error("Can't deregister service")
+			result.DeregisterErrors++
+		} else {
+			result.Deregistered++
+		}
+	}
+	return result
+}
+
+func (p *Plan) log() {
+	for _, r := range p.Register {
+		log.WithFields(log.Fields{
+			"Id":      r.TaskID,
+			"Intents": r.Intents,
+			"DryRun":  true,
+		}).Info("Would register task")
+	}
+	for _, d := range p.Deregister {
+		log.WithFields(log.Fields{
+			"Id":      d.ServiceID,
+			"Address": d.AgentAddress,
+			"Reason":  d.Reason,
+			"DryRun":  true,
+		}).Info("Would deregister service")
+	}
+}
@@ -1,7 +1,11 @@
 package sync
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/allegro/marathon-consul/apps"
@@ -16,79 +20,210 @@ type Sync struct {
 	marathon            marathon.Marathoner
 	serviceRegistry     service.Registry
 	syncStartedListener startedListener
+	running             int32
+	statusLock          sync.RWMutex
+	status              Status
+	catchUp             chan struct{}
+	metrics             metrics.Scope
 }
 
+// Result holds statistics of a single sync run.
+// In dry-run mode nothing is applied and only the plan is filled.
+type Result struct {
+	Registered       int   `json:"registered"`
+	RegisterErrors   int   `json:"registerErrors"`
+	Deregistered     int   `json:"deregistered"`
+	DeregisterErrors int   `json:"deregisterErrors"`
+	DryRun           bool  `json:"dryRun,omitempty"`
+	Plan             *Plan `json:"plan,omitempty"`
+}
+
+// Outcomes of a sync run
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+	OutcomeSkipped = "skipped"
+)
+
+// Status describes the last finished sync run
+type Status struct {
+	Running             bool       `json:"running"`
+	LastSyncAt          *time.Time `json:"lastSyncAt,omitempty"`
+	Outcome             string     `json:"outcome,omitempty"`
+	Error               string     `json:"error,omitempty"`
+	Result              *Result    `json:"result,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+}
+
+var ErrSyncInProgress = errors.New("Sync is already in progress")
+
 type startedListener func(apps []*apps.App)
 
 func New(config Config, marathon marathon.Marathoner, serviceRegistry service.Registry, syncStartedListener startedListener) *Sync {
-	return &Sync{config, marathon, serviceRegistry, syncStartedListener}
+	return &Sync{
+		config:              config,
+		marathon:            marathon,
+		serviceRegistry:     serviceRegistry,
+		syncStartedListener: syncStartedListener,
+		catchUp:             make(chan struct{}, 1),
+	}
 }
 
-func (s *Sync) StartSyncServicesJob() {
-	if !s.config.Enabled {
-		log.Info("Marathon-consul sync disabled")
-		return
-	}
+// UseMetrics makes sync metrics recorded within given scope, it has to be set before the sync job is started
+func (s *Sync) UseMetrics(scope metrics.Scope) {
+	s.metrics = scope
+}
 
-	log.WithFields(log.Fields{
-		"Interval": s.config.Interval,
-		"Leader":   s.config.Leader,
-		"Force":    s.config.Force,
-	}).Info("Marathon-consul sync job started")
+// StartSyncServicesJob runs sync periodically and on catch-up requests until given context is done.
+// With sync disabled only catch-up syncs are run.
+func (s *Sync) StartSyncServicesJob(ctx context.Context) {
+	if s.config.Enabled {
+		log.WithFields(log.Fields{
+			"Interval": s.config.Interval,
+			"Leader":   s.config.Leader,
+			"Force":    s.config.Force,
+		}).Info("Marathon-consul sync job started")
+	} else {
+		log.Info("Marathon-consul scheduled sync disabled, only catch-up syncs will be run")
+	}
 
-	ticker := time.NewTicker(s.config.Interval.Duration)
 	go func() {
-		if err := s.SyncServices(); err != nil {
-			log.WithError(err).Error("An error occured while performing sync")
-		}
-		for range ticker.C {
+		// nil channel never ticks when scheduled sync is disabled
+		var tick <-chan time.Time
+		if s.config.Enabled {
+			ticker := time.NewTicker(s.config.Interval.Duration)
+			defer ticker.Stop()
+			tick = ticker.C
 			if err := s.SyncServices(); err != nil {
 				log.WithError(err).Error("An error occured while performing sync")
 			}
 		}
+		for {
+			select {
+			case <-tick:
+				if err := s.SyncServices(); err != nil {
+					log.WithError(err).Error("An error occured while performing sync")
+				}
+			case <-s.catchUp:
+				log.Info("Running catch-up sync")
+				s.metrics.Mark("sync.catchup")
+				if err := s.SyncServices(); err != nil {
+					log.WithError(err).Error("An error occured while performing catch-up sync")
+				}
+			case <-ctx.Done():
+				log.Info("Marathon-consul sync job stopped")
+				return
+			}
+		}
 	}()
 }
 
+// CatchUp schedules sync out of the regular interval, e.g., after events could have been lost.
+// Marathon does not replay events missed since Last-Event-ID, so the whole registry is synced
+// instead of apps affected by them, even when the scheduled sync is disabled.
+// Requests made before scheduled sync starts are merged into one.
+func (s *Sync) CatchUp() {
+	select {
+	case s.catchUp <- struct{}{}:
+	default:
+	}
+}
+
 func (s *Sync) SyncServices() error {
-	var err error
-	metrics.Time("sync.services", func() { err = s.syncServices() })
+	_, err := s.sync(s.config.Force)
 	return err
 }
 
-func (s *Sync) syncServices() error {
-	if check, err := s.shouldPerformSync(); !check {
-		metrics.Clear()
-		return err
+// sync runs a single sync unless another one is in progress.
+// Returned result is nil when sync was skipped because node is not a leader.
+func (s *Sync) sync(force bool) (*Result, error) {
+	if !atomic.CompareAndSwapInt32(&s.running, 0, 1) {
+		return nil, ErrSyncInProgress
+	}
+	defer atomic.StoreInt32(&s.running, 0)
+
+	var result *Result
+	var err error
+	s.metrics.Time("sync.services", func() { result, err = s.syncServices(force) })
+	s.recordStatus(result, err)
+	return result, err
+}
+
+func (s *Sync) recordStatus(result *Result, err error) {
+	now := time.Now()
+	status := Status{LastSyncAt: &now, Result: result}
+	switch {
+	case err != nil:
+		status.Outcome = OutcomeError
+		status.Error = err.Error()
+	case result == nil:
+		status.Outcome = OutcomeSkipped
+	default:
+		status.Outcome = OutcomeSuccess
+	}
+
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+	switch status.Outcome {
+	case OutcomeError:
+		status.ConsecutiveFailures = s.status.ConsecutiveFailures + 1
+	case OutcomeSkipped:
+		status.ConsecutiveFailures = s.status.ConsecutiveFailures
+	}
+	s.status = status
+}
+
+func (s *Sync) Status() Status {
+	s.statusLock.RLock()
+	status := s.status
+	s.statusLock.RUnlock()
+	status.Running = atomic.LoadInt32(&s.running) == 1
+	return status
+}
+
+func (s *Sync) syncServices(force bool) (*Result, error) {
+	if check, err := s.shouldPerformSync(force); !check {
+		s.metrics.Clear()
+		return nil, err
 	}
 	log.Info("Syncing services started")
 
-	apps, err := s.marathon.ConsulApps()
+	apps, err := s.consulApps()
 	if err != nil {
-		return fmt.Errorf("Can't get Marathon apps: %v", err)
+		return nil, err
 	}
 
-	s.syncStartedListener(apps)
+	// Listener may change state (e.g. Consul agents pool) so it's notified only when changes are applied.
+	if !s.config.DryRun {
+		s.syncStartedListener(apps)
+	}
 
-	services, err := s.serviceRegistry.GetAllServices()
+	plan, err := s.plan(apps)
 	if err != nil {
-		return fmt.Errorf("Can't get Consul services: %v", err)
+		return nil, err
 	}
 
-	registerCount, registerErrorsCount := s.registerAppTasksNotFoundInConsul(apps, services)
-	deregisterCount, deregisterErrorsCount := s.deregisterConsulServicesNotFoundInMarathon(apps, services)
+	if s.config.DryRun {
+		plan.log()
+		log.Infof("Syncing services finished in dry-run mode. Plan, register: %d, deregister: %d.",
+			len(plan.Register), len(plan.Deregister))
+		return &Result{DryRun: true, Plan: plan}, nil
+	}
+
+	result := s.apply(plan)
 
-	metrics.UpdateGauge("sync.register.success", int64(registerCount))
-	metrics.UpdateGauge("sync.register.error", int64(registerErrorsCount))
-	metrics.UpdateGauge("sync.deregister.success", int64(deregisterCount))
-	metrics.UpdateGauge("sync.deregister.error", int64(deregisterErrorsCount))
+	s.metrics.UpdateGauge("sync.register.success", int64(result.Registered))
+	s.metrics.UpdateGauge("sync.register.error", int64(result.RegisterErrors))
+	s.metrics.UpdateGauge("sync.deregister.success", int64(result.Deregistered))
+	s.metrics.UpdateGauge("sync.deregister.error", int64(result.DeregisterErrors))
 
 	log.Infof("Syncing services finished. Stats, registerd: %d (failed: %d), deregister: %d (failed: %d).",
-		registerCount, registerErrorsCount, deregisterCount, deregisterErrorsCount)
-	return nil
+		result.Registered, result.RegisterErrors, result.Deregistered, result.DeregisterErrors)
+	return result, nil
 }
 
-func (s *Sync) shouldPerformSync() (bool, error) {
-	if s.config.Force {
+func (s *Sync) shouldPerformSync(force bool) (bool, error) {
+	if force {
 		log.Debug("Forcing sync")
 		return true, nil
 	}
@@ -104,8 +239,20 @@ func (s *Sync) shouldPerformSync() (bool, error) {
 	return false, nil
 }
 
-func (s *Sync) deregisterConsulServicesNotFoundInMarathon(marathonApps []*apps.App, services []*service.Service) (deregisterCount int, errorCount int) {
+// HealthCheck reports an error when given number of the most recent syncs failed, non-positive number disables the check
+func (s *Sync) HealthCheck(maxFailedSyncs int) func() error {
+	return func() error {
+		status := s.Status()
+		if maxFailedSyncs > 0 && status.ConsecutiveFailures >= maxFailedSyncs {
+			return fmt.Errorf("Last %d syncs failed: %s", status.ConsecutiveFailures, status.Error)
+		}
+		return nil
+	}
+}
+
+func (s *Sync) deregisterConsulServicesNotFoundInMarathon(marathonApps []*apps.App, services []*service.Service) []PlannedDeregistration {
 	runningTasks := marathonTaskIdsSet(marathonApps)
+	deregistrations := []PlannedDeregistration{}
 	for _, service := range services {
 		logFields := log.Fields{
 			"Id":      service.ID,
@@ -115,12 +262,7 @@ func (s *Sync) deregisterConsulServicesNotFoundInMarathon(marathonApps []*apps.A
 		if taskIDInTag, err := service.TaskID(); err != nil {
 			log.WithField("Id", service.ID).WithError(err).
 				Warn("Couldn't extract marathon task id, deregistering since sync should have reregistered it already")
-			if err := s.serviceRegistry.Deregister(service); err != nil {
-				log.WithError(err).WithFields(logFields).Error("Can't deregister service")
-				errorCount++
-			} else {
-				deregisterCount++
-			}
+			deregistrations = append(deregistrations, newPlannedDeregistration(service, ReasonMissingTaskTag))
 		} else if _, isRunning := runningTasks[taskIDInTag]; !isRunning {
 			// Check latest marathon state to prevent deregistration of live service.
 			tasks, err := s.marathon.Tasks(taskIDInTag.AppID())
@@ -132,59 +274,60 @@ func (s *Sync) deregisterConsulServicesNotFoundInMarathon(marathonApps []*apps.A
 			_, taskIsRunning := apps.FindTaskByID(taskIDInTag, tasks)
 
 			if !taskIsRunning {
-				if err := s.serviceRegistry.Deregister(service); err != nil {
-					log.WithError(err).WithFields(logFields).Error("Can't deregister service")
-					errorCount++
-				} else {
-					deregisterCount++
+				reason := ReasonTaskNotRunning
+				if err != nil {
+					reason = ReasonTaskInfoUnavailable
 				}
+				deregistrations = append(deregistrations, newPlannedDeregistration(service, reason))
 			}
 		} else {
 			log.WithField("Id", service.ID).Debug("Service is running")
 		}
 	}
-	return
+	return deregistrations
 }
 
-func (s *Sync) registerAppTasksNotFoundInConsul(marathonApps []*apps.App, services []*service.Service) (registerCount int, errorCount int) {
+func (s *Sync) registerAppTasksNotFoundInConsul(marathonApps []*apps.App, services []*service.Service) []PlannedRegistration {
 	registrationsUnderTaskIds := taskIdsInConsulServices(services)
+	registrations := []PlannedRegistration{}
 	for _, app := range marathonApps {
 		if !app.IsConsulApp() {
 			log.WithField("Id", app.ID).Debug("Not a Consul app, skipping registration")
 			continue
 		}
 		expectedRegistrations := app.RegistrationIntentsNumber()
-		for _, task := range app.Tasks {
-			registrations := registrationsUnderTaskIds[task.ID]
+		for i := range app.Tasks {
+			task := &app.Tasks[i]
+			existingRegistrations := registrationsUnderTaskIds[task.ID]
 			logFields := log.Fields{
 				"Id":                    task.ID,
-				"HasRegistrations":      registrations,
+				"HasRegistrations":      existingRegistrations,
 				"ExpectedRegistrations": expectedRegistrations,
 				"Sync":                  true,
 			}
-			if registrations < expectedRegistrations {
-				if registrations != 0 {
+			if existingRegistrations < expectedRegistrations {
+				if existingRegistrations != 0 {
 					log.WithFields(logFields).Info("Registering missing service registrations")
 				}
 				if task.IsHealthy() {
-					err := s.serviceRegistry.Register(&task, app)
-					if err != nil {
-						log.WithError(err).WithFields(logFields).Error("Can't register task")
-						errorCount++
-					} else {
-						registerCount++
-					}
+					registrations = append(registrations, PlannedRegistration{
+						TaskID:  task.ID,
+						AppID:   app.ID,
+						Intents: s.serviceRegistry.RegistrationIntents(task, app),
+						task:    task,
+						app:     app,
+					})
 				} else {
 					log.WithFields(logFields).Debug("Task is not healthy. Not Registering")
 				}
-			} else if registrations > expectedRegistrations {
+			} else if existingRegistrations > expectedRegistrations {
 				log.WithFields(logFields).Warn("Skipping task with excess registrations")
 			} else {
 				log.WithFields(logFields).Debug("Task already registered in Consul")
 			}
 		}
 	}
-	return
+	return registrations
 }
 
 func taskIdsInConsulServices(services []*service.Service) map[apps.TaskID]int {
@@ -1,6 +1,7 @@
 package sync
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"testing"
@@ -30,7 +31,7 @@ func TestSyncJob_ShouldSyncOnLeadership(t *testing.T) {
 	}, marathon, services, noopSyncStartedListener)
 
 	// when
-	sync.StartSyncServicesJob()
+	sync.StartSyncServicesJob(context.Background())
 
 	// then
 	<-time.After(15 * time.Millisecond)
@@ -49,13 +50,78 @@ func TestSyncJob_ShouldNotSyncWhenDisabled(t *testing.T) {
 	}, marathon, services, noopSyncStartedListener)
 
 	// when
-	sync.StartSyncServicesJob()
+	sync.StartSyncServicesJob(context.Background())
 
 	// then
 	<-time.After(15 * time.Millisecond)
 	assert.Equal(t, 0, services.RegistrationsCount(app.Tasks[0].ID.String()))
 }
 
+func TestSyncJob_ShouldStopWhenContextIsDone(t *testing.T) {
+	t.Parallel()
+	// given
+	app := ConsulApp("app1", 1)
+	marathon := marathon.MarathonerStubWithLeaderForApps("current.leader:8080", "current.leader:8080", app)
+	services := newConsulServicesMock()
+	sync := New(Config{
+		Enabled:  true,
+		Interval: timeutil.Interval{Duration: 10 * time.Millisecond},
+	}, marathon, services, noopSyncStartedListener)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// when
+	sync.StartSyncServicesJob(ctx)
+	<-time.After(5 * time.Millisecond)
+	cancel()
+
+	// then
+	<-time.After(30 * time.Millisecond)
+	assert.Equal(t, 1, services.RegistrationsCount(app.Tasks[0].ID.String()))
+}
+
+func TestSyncJob_ShouldSyncOnCatchUp(t *testing.T) {
+	t.Parallel()
+	// given
+	app := ConsulApp("app1", 1)
+	marathon := marathon.MarathonerStubWithLeaderForApps("current.leader:8080", "current.leader:8080", app)
+	services := newConsulServicesMock()
+	sync := New(Config{
+		Enabled:  true,
+		Interval: timeutil.Interval{Duration: time.Hour},
+	}, marathon, services, noopSyncStartedListener)
+	sync.StartSyncServicesJob(context.Background())
+	<-time.After(10 * time.Millisecond)
+
+	// when
+	sync.CatchUp()
+
+	// then
+	<-time.After(20 * time.Millisecond)
+	assert.Equal(t, 2, services.RegistrationsCount(app.Tasks[0].ID.String()))
+}
+
+func TestSyncJob_ShouldSyncOnCatchUpWhenDisabled(t *testing.T) {
+	t.Parallel()
+	// given
+	app := ConsulApp("app1", 1)
+	marathon := marathon.MarathonerStubWithLeaderForApps("current.leader:8080", "current.leader:8080", app)
+	services := newConsulServicesMock()
+	sync := New(Config{
+		Enabled:  false,
+		Interval: timeutil.Interval{Duration: 10 * time.Millisecond},
+	}, marathon, services, noopSyncStartedListener)
+	sync.StartSyncServicesJob(context.Background())
+	<-time.After(15 * time.Millisecond)
+	assert.Equal(t, 0, services.RegistrationsCount(app.Tasks[0].ID.String()))
+
+	// when
+	sync.CatchUp()
+
+	// then
+	<-time.After(20 * time.Millisecond)
+	assert.Equal(t, 1, services.RegistrationsCount(app.Tasks[0].ID.String()))
+}
+
 func TestSyncServices_ShouldNotSyncOnNoForceNorLeaderSpecified(t *testing.T) {
 	t.Parallel()
 	// given
@@ -65,7 +131,7 @@ func TestSyncServices_ShouldNotSyncOnNoForceNorLeaderSpecified(t *testing.T) {
 	sync := New(Config{}, marathon, services, noopSyncStartedListener)
 
 	// when
-	sync.StartSyncServicesJob()
+	sync.StartSyncServicesJob(context.Background())
 
 	// then
 	assert.Zero(t, services.RegistrationsCount(app.Tasks[0].ID.String()))
@@ -122,6 +188,14 @@ func (c *ConsulServicesMock) GetAllServices() ([]*service.Service, error) {
 	return nil, nil
 }
 
+func (c *ConsulServicesMock) GetAppServices(appID apps.AppID) ([]*service.Service, error) {
+	return nil, nil
+}
+
+func (c *ConsulServicesMock) RegistrationIntents(task *apps.Task, app *apps.App) []apps.RegistrationIntent {
+	return app.RegistrationIntents(task, ".")
+}
+
 func (c *ConsulServicesMock) Register(task *apps.Task, app *apps.App) error {
 	c.Lock()
 	defer c.Unlock()
@@ -143,6 +217,14 @@ func (c *ConsulServicesMock) Deregister(toDeregister *service.Service) error {
 	return nil
 }
 
+func (c *ConsulServicesMock) EnableMaintenanceByTask(taskID apps.TaskID, reason string) error {
+	return nil
+}
+
+func (c *ConsulServicesMock) DisableMaintenanceByTask(taskID apps.TaskID) error {
+	return nil
+}
+
 func TestSyncAppsFromMarathonToConsul(t *testing.T) {
 	t.Parallel()
 	// given
@@ -479,3 +561,111 @@ func TestSync_AddingAgentsFromMarathonTasks(t *testing.T) {
 	assert.Len(t, serviceNames, 1)
 	assert.Contains(t, serviceNames, "serviceA")
 }
+
+func TestSync_ShouldNotifyListenerOnlyWhenChangesAreApplied(t *testing.T) {
+	t.Parallel()
+	// given
+	app := ConsulApp("app1", 1)
+	marathon := marathon.MarathonerStubForApps(app)
+	var notified [][]*apps.App
+	listener := func(apps []*apps.App) { notified = append(notified, apps) }
+	sync := New(Config{Force: true}, marathon, newConsulServicesMock(), listener)
+	dryRunSync := New(Config{Force: true, DryRun: true}, marathon, newConsulServicesMock(), listener)
+
+	// when
+	_, planErr := sync.Plan()
+	_, dryRunErr := dryRunSync.sync(false)
+
+	// then
+	assert.NoError(t, planErr)
+	assert.NoError(t, dryRunErr)
+	assert.Empty(t, notified)
+
+	// when
+	_, err := sync.sync(false)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, [][]*apps.App{{app}}, notified)
+}
+
+func TestPlan_ShouldNotRunWhileSyncIsInProgress(t *testing.T) {
+	t.Parallel()
+	// given
+	marathoner := marathon.MarathonerStubForApps(ConsulApp("app1", 1))
+	sync := newSyncWithDefaultConfig(marathoner, newConsulServicesMock())
+	sync.running = 1
+
+	// when
+	plan, err := sync.Plan()
+
+	// then
+	assert.Nil(t, plan)
+	assert.Equal(t, ErrSyncInProgress, err)
+	assert.False(t, marathoner.Interactions())
+}
+
+func TestSync_ShouldReportStatusOfLastSync(t *testing.T) {
+	t.Parallel()
+	// given
+	marathon := marathon.MarathonerStubForApps(ConsulApp("/test/app", 2))
+	sync := newSyncWithDefaultConfig(marathon, consul.NewConsulStub())
+
+	// expect
+	assert.Equal(t, Status{}, sync.Status())
+
+	// when
+	err := sync.SyncServices()
+
+	// then
+	assert.NoError(t, err)
+	status := sync.Status()
+	assert.False(t, status.Running)
+	assert.NotNil(t, status.LastSyncAt)
+	assert.Equal(t, OutcomeSuccess, status.Outcome)
+	assert.Equal(t, &Result{Registered: 2}, status.Result)
+}
+
+func TestSync_ShouldReportStatusOfFailedSync(t *testing.T) {
+	t.Parallel()
+	// given
+	sync := newSyncWithDefaultConfig(errorMarathon{}, nil)
+
+	// when
+	err := sync.SyncServices()
+
+	// then
+	assert.Error(t, err)
+	status := sync.Status()
+	assert.Equal(t, OutcomeError, status.Outcome)
+	assert.Equal(t, err.Error(), status.Error)
+	assert.Nil(t, status.Result)
+	assert.Equal(t, 1, status.ConsecutiveFailures)
+}
+
+func TestSync_HealthCheckShouldFailAfterConsecutiveFailedSyncs(t *testing.T) {
+	t.Parallel()
+	// given
+	sync := newSyncWithDefaultConfig(errorMarathon{}, consul.NewConsulStub())
+	check := sync.HealthCheck(2)
+
+	// when
+	sync.SyncServices()
+
+	// then
+	assert.NoError(t, check())
+
+	// when
+	sync.SyncServices()
+
+	// then
+	assert.EqualError(t, check(), "Last 2 syncs failed: Could not get Marathon leader: Error")
+
+	// when
+	sync.marathon = marathon.MarathonerStubForApps()
+	sync.SyncServices()
+
+	// then
+	assert.NoError(t, check())
+	assert.Zero(t, sync.Status().ConsecutiveFailures)
+}
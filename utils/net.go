@@ -2,18 +2,85 @@ package utils
 
 import (
 	"errors"
+	"fmt"
 	"net"
+	"strconv"
+	"strings"
 )
 
+// AddressFamily decides which IP addresses hosts are resolved to
+type AddressFamily string
+
+const (
+	IPv4Only   AddressFamily = "ipv4"
+	IPv6Only   AddressFamily = "ipv6"
+	PreferIPv4 AddressFamily = "prefer-ipv4"
+	PreferIPv6 AddressFamily = "prefer-ipv6"
+)
+
+func ParseAddressFamily(value string) (AddressFamily, error) {
+	switch family := AddressFamily(strings.ToLower(strings.TrimSpace(value))); family {
+	case IPv4Only, IPv6Only, PreferIPv4, PreferIPv6:
+		return family, nil
+	case "":
+		return IPv4Only, nil
+	default:
+		return "", fmt.Errorf("Unknown address family %q, expected one of: %s, %s, %s, %s",
+			value, IPv4Only, IPv6Only, PreferIPv4, PreferIPv6)
+	}
+}
+
 func HostToIPv4(host string) (net.IP, error) {
+	return HostToIP(host, IPv4Only)
+}
+
+// HostToIP resolves host to an IP address of the given family, empty family means IPv4 only
+func HostToIP(host string, family AddressFamily) (net.IP, error) {
 	IPs, err := net.LookupIP(host)
 	if err != nil {
 		return nil, err
 	}
+	return SelectIP(IPs, family)
+}
+
+// SelectIP picks the first address of the given family, empty family means IPv4 only.
+// IPv4 addresses are always returned in 4-byte form so their string representation is the same
+// regardless of how they were obtained.
+func SelectIP(IPs []net.IP, family AddressFamily) (net.IP, error) {
+	var IPv4, IPv6 net.IP
 	for _, IP := range IPs {
-		if IP.To4() != nil {
+		if v4 := IP.To4(); v4 != nil {
+			if IPv4 == nil {
+				IPv4 = v4
+			}
+		} else if IPv6 == nil {
+			IPv6 = IP
+		}
+	}
+
+	var candidates []net.IP
+	switch family {
+	case IPv6Only:
+		candidates = []net.IP{IPv6}
+	case PreferIPv4:
+		candidates = []net.IP{IPv4, IPv6}
+	case PreferIPv6:
+		candidates = []net.IP{IPv6, IPv4}
+	default:
+		candidates = []net.IP{IPv4}
+	}
+	for _, IP := range candidates {
+		if IP != nil {
 			return IP, nil
 		}
 	}
-	return nil, errors.New("Could not resolve host to IPv4")
+	if family == IPv4Only || family == "" {
+		return nil, errors.New("Could not resolve host to IPv4")
+	}
+	return nil, fmt.Errorf("Could not resolve host to %s address", family)
+}
+
+// HostPort joins host and port, IPv6 addresses are enclosed in square brackets
+func HostPort(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
 }
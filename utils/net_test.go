@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"net"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -44,3 +45,80 @@ func TestHostToIPv4_(t *testing.T) {
 	assert.Nil(t, ip)
 	assert.Error(t, err)
 }
+
+func TestSelectIP(t *testing.T) {
+	t.Parallel()
+
+	IPv4 := net.ParseIP("10.0.0.1")
+	IPv6 := net.ParseIP("fd00::1")
+
+	var selectIPTestsData = []struct {
+		IPs        []net.IP
+		family     AddressFamily
+		expectedIP string
+	}{
+		{[]net.IP{IPv6, IPv4}, "", "10.0.0.1"},
+		{[]net.IP{IPv6, IPv4}, IPv4Only, "10.0.0.1"},
+		{[]net.IP{IPv4, IPv6}, IPv6Only, "fd00::1"},
+		{[]net.IP{IPv6, IPv4}, PreferIPv4, "10.0.0.1"},
+		{[]net.IP{IPv6}, PreferIPv4, "fd00::1"},
+		{[]net.IP{IPv4, IPv6}, PreferIPv6, "fd00::1"},
+		{[]net.IP{IPv4}, PreferIPv6, "10.0.0.1"},
+		{[]net.IP{net.ParseIP("::ffff:10.0.0.2")}, IPv4Only, "10.0.0.2"},
+	}
+
+	for _, testData := range selectIPTestsData {
+		IP, err := SelectIP(testData.IPs, testData.family)
+		assert.NoError(t, err)
+		assert.Equal(t, testData.expectedIP, IP.String())
+	}
+}
+
+func TestSelectIP_ShouldFailWhenNoAddressOfFamily(t *testing.T) {
+	t.Parallel()
+
+	// when
+	_, IPv6Err := SelectIP([]net.IP{net.ParseIP("10.0.0.1")}, IPv6Only)
+	_, IPv4Err := SelectIP([]net.IP{net.ParseIP("fd00::1")}, IPv4Only)
+	_, emptyErr := SelectIP(nil, PreferIPv6)
+
+	// then
+	assert.Error(t, IPv6Err)
+	assert.Error(t, IPv4Err)
+	assert.Error(t, emptyErr)
+}
+
+func TestHostToIP_IPv6(t *testing.T) {
+	t.Parallel()
+
+	// when
+	ip, err := HostToIP("2001:cdba:0000:0000:0000:0000:3257:9652", IPv6Only)
+
+	// then
+	assert.NoError(t, err)
+	assert.Equal(t, "2001:cdba::3257:9652", ip.String())
+}
+
+func TestParseAddressFamily(t *testing.T) {
+	t.Parallel()
+
+	// expect
+	family, err := ParseAddressFamily(" Prefer-IPv6 ")
+	assert.NoError(t, err)
+	assert.Equal(t, PreferIPv6, family)
+
+	family, err = ParseAddressFamily("")
+	assert.NoError(t, err)
+	assert.Equal(t, IPv4Only, family)
+
+	_, err = ParseAddressFamily("ipx")
+	assert.Error(t, err)
+}
+
+func TestHostPort(t *testing.T) {
+	t.Parallel()
+
+	// expect
+	assert.Equal(t, "10.0.0.1:8080", HostPort("10.0.0.1", 8080))
+	assert.Equal(t, "[fd00::1]:8080", HostPort("fd00::1", 8080))
+}
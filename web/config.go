@@ -1,8 +1,28 @@
 package web
 
+import "github.com/allegro/marathon-consul/time"
+
 type Config struct {
-	Listen       string
-	QueueSize    int
-	WorkersCount int
-	MaxEventSize int64
+	Listen              string
+	QueueSize           int
+	QueueOverflowPolicy string
+	QueueBlockTimeout   time.Interval
+	QueueSpillFile      string
+	RetryMaxAttempts    int
+	RetryBackoff        time.Interval
+	RetryMaxBackoff     time.Interval
+	DeadLettersSize     int
+	WorkersCount        int
+	MaxEventSize        int64
+	ShutdownTimeout     time.Interval
+	UnhealthyTaskPolicy string
+	AppCacheTTL         time.Interval
+	Health              HealthConfig
+}
+
+type HealthConfig struct {
+	Readiness           bool
+	MaxSSEDisconnection time.Interval
+	MaxQueueUtilization int
+	MaxFailedSyncs      int
 }
@@ -5,6 +5,31 @@ import (
 	"net/http"
 )
 
+// HealthCheck returns an error describing why instance is not ready, nil otherwise
+type HealthCheck func() error
+
 func HealthHandler(w http.ResponseWriter, _ *http.Request) {
 	fmt.Fprintln(w, "OK")
 }
+
+// NewReadinessHandler creates health handler responding with 503 and reasons of failing checks
+// when any of the given checks fails, and the same way HealthHandler does otherwise
+func NewReadinessHandler(checks ...HealthCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var failures []error
+		for _, check := range checks {
+			if err := check(); err != nil {
+				failures = append(failures, err)
+			}
+		}
+		if len(failures) == 0 {
+			HealthHandler(w, r)
+			return
+		}
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+		for _, failure := range failures {
+			fmt.Fprintln(w, failure.Error())
+		}
+	}
+}
@@ -2,6 +2,7 @@ package web
 
 import (
 	"bytes"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -21,3 +22,33 @@ func TestHealthHandler(t *testing.T) {
 	assert.Equal(t, 200, recorder.Code)
 	assert.Equal(t, "OK\n", recorder.Body.String())
 }
+
+func TestReadinessHandler(t *testing.T) {
+	t.Parallel()
+
+	req, err := http.NewRequest("GET", "http://example.com/health", bytes.NewBuffer([]byte{}))
+	assert.Nil(t, err)
+	passing := func() error { return nil }
+
+	recorder := httptest.NewRecorder()
+	NewReadinessHandler(passing, passing)(recorder, req)
+
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "OK\n", recorder.Body.String())
+}
+
+func TestReadinessHandler_WithFailingChecks(t *testing.T) {
+	t.Parallel()
+
+	req, err := http.NewRequest("GET", "http://example.com/health", bytes.NewBuffer([]byte{}))
+	assert.Nil(t, err)
+	passing := func() error { return nil }
+	streamFailing := func() error { return errors.New("SSE stream disconnected for 5m0s") }
+	syncFailing := func() error { return errors.New("Last 3 syncs failed") }
+
+	recorder := httptest.NewRecorder()
+	NewReadinessHandler(streamFailing, passing, syncFailing)(recorder, req)
+
+	assert.Equal(t, 503, recorder.Code)
+	assert.Equal(t, "SSE stream disconnected for 5m0s\nLast 3 syncs failed\n", recorder.Body.String())
+}
@@ -0,0 +1,27 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// StatusProvider returns JSON serializable state of a component
+type StatusProvider func() interface{}
+
+// NewStatusHandler creates handler responding with JSON object
+// containing status of every given component under its name
+func NewStatusHandler(providers map[string]StatusProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		status := make(map[string]interface{}, len(providers))
+		for name, provide := range providers {
+			status[name] = provide()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			log.WithError(err).Error("Could not write status")
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusHandler(t *testing.T) {
+	t.Parallel()
+
+	// given
+	handler := NewStatusHandler(map[string]StatusProvider{
+		"leader": func() interface{} { return map[string]bool{"leader": true} },
+		"queue":  func() interface{} { return struct{ Length int }{Length: 3} },
+	})
+	req, err := http.NewRequest("GET", "http://example.com/status", nil)
+	assert.Nil(t, err)
+	recorder := httptest.NewRecorder()
+
+	// when
+	handler(recorder, req)
+
+	// then
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"leader": {"leader": true}, "queue": {"Length": 3}}`, recorder.Body.String())
+}